@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	emailtemplates "github.com/darinmilner/goserver/email-templates"
+	"github.com/darinmilner/goserver/internal/assets"
+	"github.com/darinmilner/goserver/internal/config"
+	"github.com/darinmilner/goserver/static"
+	"github.com/darinmilner/goserver/templates"
+)
+
+//setAssets points the app at the templates, mail templates and static files built into the
+//binary, or at the same directories under AssetsDir so edits show up without a rebuild.
+//Embedded static files are fingerprinted, files on disk are served as they are
+func setAssets(a *config.AppConfig) error {
+	if a.AssetsDir == "" {
+		a.Templates = templates.FS
+		a.EmailTemplates = emailtemplates.FS
+		a.Static = static.FS
+
+		m, err := assets.New(a.Static)
+		if err != nil {
+			return err
+		}
+		a.Assets = m
+		return nil
+	}
+
+	a.Templates = os.DirFS(filepath.Join(a.AssetsDir, "templates"))
+	a.EmailTemplates = os.DirFS(filepath.Join(a.AssetsDir, "email-templates"))
+	a.Static = os.DirFS(filepath.Join(a.AssetsDir, "static"))
+	a.Assets = assets.Live(a.Static)
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/darinmilner/goserver/internal/driver"
+	"github.com/darinmilner/goserver/internal/logging"
+)
+
+//Build metadata, set at link time with
+//go build -ldflags "-X main.version=1.2.0 -X main.commit=$(git rev-parse --short HEAD) -X main.buildTime=$(date -u +%FT%TZ)"
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildTime = "unknown"
+)
+
+//readyCheckTimeout bounds how long a single readiness check may take
+const readyCheckTimeout = 2 * time.Second
+
+//readyCheck is one dependency checked by /readyz
+type readyCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+//readyChecks are run by /readyz, they are registered in main once the app is set up
+var readyChecks []readyCheck
+
+//mailWorkerRunning is 1 while the mail listener goroutine is running
+var mailWorkerRunning int32
+
+//readyResponse only says which checks pass, why one failed is logged rather than shown
+type readyResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+//registerReadyChecks sets up the dependencies /readyz reports on
+func registerReadyChecks(db *driver.DB) {
+	readyChecks = []readyCheck{
+		{"database", db.Ping},
+		{"templates", func(context.Context) error {
+			if len(app.TemplateCache) == 0 {
+				return errors.New("template cache is empty")
+			}
+			return nil
+		}},
+		{"mail", func(context.Context) error {
+			if atomic.LoadInt32(&mailWorkerRunning) == 0 {
+				return errors.New("mail worker is not running")
+			}
+			return nil
+		}},
+	}
+}
+
+//Healthz reports that the process is alive
+func Healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+//Readyz reports whether the app can serve traffic, with the result of every check
+func Readyz(w http.ResponseWriter, r *http.Request) {
+	resp := readyResponse{
+		Status: "ok",
+		Checks: make(map[string]string),
+	}
+	status := http.StatusOK
+
+	for _, c := range readyChecks {
+		ctx, cancel := context.WithTimeout(r.Context(), readyCheckTimeout)
+		err := c.check(ctx)
+		cancel()
+
+		if err != nil {
+			logging.FromContext(r.Context()).Warn("readiness check failed", slog.String("check", c.name), slog.Any("error", err))
+			resp.Checks[c.name] = "fail"
+			resp.Status = "fail"
+			status = http.StatusServiceUnavailable
+			continue
+		}
+		resp.Checks[c.name] = "ok"
+	}
+
+	writeJSON(w, status, resp)
+}
+
+//Version reports the build metadata
+func Version(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"version":   version,
+		"commit":    commit,
+		"buildTime": buildTime,
+		"goVersion": runtime.Version(),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	out, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(out)
+}
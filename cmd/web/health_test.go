@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/darinmilner/goserver/internal/config"
+	"github.com/go-chi/chi"
+)
+
+func TestHealthz(t *testing.T) {
+	rr := httptest.NewRecorder()
+	Healthz(rr, httptest.NewRequest("GET", "/healthz", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200 but got %d", rr.Code)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	defer func(c []readyCheck) { readyChecks = c }(readyChecks)
+
+	readyChecks = []readyCheck{
+		{"ok", func(context.Context) error { return nil }},
+		{"broken", func(context.Context) error { return errors.New("down") }},
+	}
+
+	rr := httptest.NewRecorder()
+	Readyz(rr, httptest.NewRequest("GET", "/readyz", nil))
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 but got %d", rr.Code)
+	}
+
+	var resp readyResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Checks["ok"] != "ok" || resp.Checks["broken"] != "fail" {
+		t.Errorf("unexpected checks %+v", resp.Checks)
+	}
+	if strings.Contains(rr.Body.String(), "down") {
+		t.Errorf("the check's error should only be logged, got %s", rr.Body)
+	}
+
+	readyChecks = readyChecks[:1]
+	rr = httptest.NewRecorder()
+	Readyz(rr, httptest.NewRequest("GET", "/readyz", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200 but got %d", rr.Code)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	rr := httptest.NewRecorder()
+	Version(rr, httptest.NewRequest("GET", "/version", nil))
+
+	var info map[string]string
+	if err := json.Unmarshal(rr.Body.Bytes(), &info); err != nil {
+		t.Fatal(err)
+	}
+
+	if info["version"] != version || info["commit"] != commit {
+		t.Errorf("unexpected build info %v", info)
+	}
+}
+
+func TestHealthRoutesSkipSession(t *testing.T) {
+	var app config.AppConfig
+	mux := routes(&app)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest("GET", "/healthz", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200 but got %d", rr.Code)
+	}
+	if rr.Header().Get("Set-Cookie") != "" {
+		t.Error("/healthz should not set cookies")
+	}
+}
+
+func TestOpsRoutes(t *testing.T) {
+	var app config.AppConfig
+	public := routes(&app)
+	ops := opsRoutes()
+
+	for _, path := range []string{"/version", "/metrics"} {
+		rr := httptest.NewRecorder()
+		ops.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: expected 200 on the ops listener but got %d", path, rr.Code)
+		}
+	}
+
+	for _, path := range []string{"/readyz", "/version", "/metrics"} {
+		if public.(chi.Routes).Match(chi.NewRouteContext(), "GET", path) {
+			t.Errorf("%s should not be served on the public listener", path)
+		}
+	}
+}
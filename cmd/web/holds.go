@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/darinmilner/goserver/internal/handlers"
+	"github.com/darinmilner/goserver/internal/metrics"
+)
+
+//holdSweepInterval is how often holds that ran out are deleted
+const holdSweepInterval = time.Minute
+
+//sweepHolds deletes the holds of guests who left the reservation form until ctx is cancelled.
+//Searches already ignore a hold once it runs out. A payment left on one, by a checkout that
+//couldn't tell whether it went through, is given back since nothing was booked with it
+func sweepHolds(ctx context.Context) {
+	ticker := time.NewTicker(holdSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, intents, err := handlers.Repo.DB.DeleteExpiredHolds(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					app.Logger.Error("sweeping holds", slog.Any("error", err))
+				}
+				continue
+			}
+			metrics.HoldsExpired.Add(float64(n))
+
+			for _, id := range intents {
+				//the hold is gone, so a failure is only logged with the reference to settle by hand
+				if err := handlers.Repo.Payments.Cancel(ctx, id); err != nil {
+					app.Logger.Error("giving back the payment of an expired hold", slog.String("reference", id), slog.Any("error", err))
+					continue
+				}
+				app.Logger.Info("gave back the payment of an expired hold", slog.String("reference", id))
+			}
+		}
+	}
+}
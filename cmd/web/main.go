@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
 	"encoding/gob"
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/alexedwards/scs/v2"
@@ -14,16 +18,21 @@ import (
 	"github.com/darinmilner/goserver/internal/driver"
 	"github.com/darinmilner/goserver/internal/handlers"
 	"github.com/darinmilner/goserver/internal/helpers"
+	"github.com/darinmilner/goserver/internal/logging"
+	"github.com/darinmilner/goserver/internal/metrics"
 	"github.com/darinmilner/goserver/internal/models"
 	"github.com/darinmilner/goserver/internal/render"
+	"github.com/darinmilner/goserver/internal/tracing"
 )
 
-const portNumber = ":8080"
-
 var app config.AppConfig
 var session *scs.SessionManager
-var infoLog *log.Logger
-var errorLog *log.Logger
+
+//templateCheckInterval is how often templates are checked for changes when the cache is off
+const templateCheckInterval = time.Second
+
+//mailQueueSize is how many messages can wait for the mail worker before handlers block
+const mailQueueSize = 100
 
 //main function
 func main() {
@@ -34,31 +43,90 @@ func main() {
 		log.Fatal(err)
 	}
 
-	defer db.SQL.Close()
+	if flag.NArg() > 0 {
+		err = runCommand(db, flag.Args())
+		db.SQL.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-	defer close(app.MailChan)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	log.Println("Starting Email listener...")
-	//helpers.HashPassword("password123")
-	listenForMail()
+	app.Logger.Info("Starting email listener")
+	mailDone := listenForMail(sendMsg)
 
-	//Email from Go Standard Library
-	// from := "me@here.com"
-	// auth := smtp.PlainAuth("", from, "", "localhost")
+	registerReadyChecks(db)
 
-	// err = smtp.SendMail("localhost:1025", auth, from, []string{"you@there.com"}, []byte("Hello, Test"))
+	metrics.RegisterDB(db.SQL)
+	metrics.RegisterMailQueue(func() int {
+		return len(app.MailChan)
+	})
 
+	flushTraces, err := tracing.Setup(context.Background(), app.Tracing, version)
 	if err != nil {
-		log.Print("Email Error")
+		app.Logger.Error("Can not set up tracing", slog.Any("error", err))
+		os.Exit(1)
 	}
-	fmt.Println(fmt.Sprintf("Starting app on port %s", portNumber))
+
+	workers := newBackground()
+	workers.Go("rate limit sweeper", sweepRateLimits)
+	workers.Go("hold sweeper", sweepHolds)
+	if !app.UseCache {
+		workers.Go("template reloader", func(ctx context.Context) {
+			render.Watch(ctx, templateCheckInterval)
+		})
+	}
+
+	app.Logger.Info("Starting app", slog.String("addr", app.ListenAddr))
 
 	srv := &http.Server{
-		Addr:    portNumber,
+		Addr:    app.ListenAddr,
 		Handler: routes(&app),
 	}
-	err = srv.ListenAndServe()
-	log.Fatal(err)
+
+	app.Logger.Info("Starting ops listener", slog.String("addr", app.OpsAddr))
+
+	opsSrv := &http.Server{
+		Addr:    app.OpsAddr,
+		Handler: opsRoutes(),
+	}
+
+	serverErr := make(chan error, 2)
+	go func() {
+		serverErr <- srv.ListenAndServe()
+	}()
+	go func() {
+		serverErr <- opsSrv.ListenAndServe()
+	}()
+
+	select {
+	case err = <-serverErr:
+		app.Logger.Error("server stopped", slog.Any("error", err))
+	case <-ctx.Done():
+		app.Logger.Info("Shutdown signal received")
+	}
+	stop()
+
+	err = shutdown(srv, app.ShutdownTimeout, workers, mailDone, db.SQL)
+
+	//the ops listener stays up while draining, so readiness and metrics can be watched
+	opsSrv.Close()
+
+	//spans from the drained requests and the mail flush are exported last
+	flushCtx, cancel := context.WithTimeout(context.Background(), app.ShutdownTimeout)
+	if ferr := flushTraces(flushCtx); ferr != nil {
+		app.Logger.Error("Flushing traces failed", slog.Any("error", ferr))
+	}
+	cancel()
+
+	if err != nil {
+		app.Logger.Error("Shutdown failed", slog.Any("error", err))
+		os.Exit(1)
+	}
+	app.Logger.Info("Shutdown complete")
 }
 
 func run() (*driver.DB, error) {
@@ -70,65 +138,70 @@ func run() (*driver.DB, error) {
 	gob.Register(models.Restriction{})
 	gob.Register(map[string]int{})
 
-	//read flags
-	inProduction := flag.Bool("production", true, "Application is in production")
-	useCache := flag.Bool("cache", true, "Use template cache")
-	dbUser := flag.String("dbuser", "", "Database Username")
-	dbHost := flag.String("dbhost", "localhost", "Database host")
-	dbName := flag.String("dbname", "", "Database name")
-	dbPass := flag.String("dbpass", "", "Database password")
-	dbPort := flag.String("dbport", "5432", "Database port")
-	dbSSL := flag.String("dbssl", "disable", "Database ssl settings (disable, prefer, require)")
-
-	flag.Parse()
-
-	if *dbName == "" || *dbUser == "" {
-		fmt.Println("Missing required flags")
-		os.Exit(1)
+	err := config.Load(&app, flag.CommandLine, os.Args[1:])
+	if err != nil {
+		return nil, err
 	}
 
-	mailChan := make(chan models.MailData)
+	mailChan := make(chan models.MailData, mailQueueSize)
 	app.MailChan = mailChan
 
-	app.InProduction = *inProduction
-	app.UseCache = *useCache
+	app.Logger = logging.New(app.InProduction, os.Stdout)
+	slog.SetDefault(app.Logger)
 
-	infoLog = log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
-
-	app.InfoLog = infoLog
-
-	errorLog = log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
-	app.ErrorLog = errorLog
+	err = setAssets(&app)
+	if err != nil {
+		return nil, fmt.Errorf("can not load static files: %w", err)
+	}
+	if app.AssetsDir != "" {
+		app.Logger.Info("Serving assets from disk", slog.String("dir", app.AssetsDir))
+	}
 
 	session = scs.New()
-	session.Lifetime = 24 * time.Hour
+	session.Lifetime = app.SessionLifetime
 
-	session.Cookie.Persist = true
-	session.Cookie.SameSite = http.SameSiteLaxMode
-	session.Cookie.Secure = app.InProduction //True in Production
+	session.Cookie.Name = app.Cookie.Name
+	session.Cookie.Domain = app.Cookie.Domain
+	session.Cookie.Persist = app.Cookie.Persist
+	session.Cookie.SameSite = app.Cookie.SameSiteMode()
+	session.Cookie.Secure = app.Cookie.Secure //True in Production
 
 	app.Session = session
 
 	//connect to db
-	log.Println("Connecting to database")
-	connectionString := fmt.Sprintf("host=%s port=%s dbname=%s user=%s password=%s, sslmode=%s", *dbHost, *dbPort, *dbName, *dbUser, *dbPass, *dbSSL)
-	db, err := driver.ConnectSQL(connectionString)
+	app.Logger.Info("Connecting to database", slog.String("host", app.DB.Host), slog.String("name", app.DB.Name))
+	db, err := driver.ConnectSQL(app.DB.ConnectionString())
 	if err != nil {
-		log.Fatal("Can not connect to DB", err)
-		return nil, err
+		return nil, fmt.Errorf("can not connect to DB: %w", err)
 	}
 
-	log.Println("Connected to DB")
+	app.Logger.Info("Connected to DB")
+
+	//commands such as migrate only need the config and the database
+	if flag.NArg() > 0 {
+		return db, nil
+	}
+
+	rateStore = newRateStore(app.RateLimit, db)
+
+	if app.AutoMigrate {
+		err = autoMigrate(db)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	tc, err := render.CreateTemplateCache()
+	tc, err := render.CreateTemplateCache(app.Templates, !app.InProduction)
 	if err != nil {
-		log.Fatal("Can not create template cache", err)
-		return nil, err
+		return nil, fmt.Errorf("can not create template cache: %w", err)
 	}
 
 	app.TemplateCache = tc
 
-	repo := handlers.NewRepo(&app, db)
+	repo, err := handlers.NewRepo(&app, db)
+	if err != nil {
+		return nil, err
+	}
 
 	handlers.NewHandlers(repo)
 
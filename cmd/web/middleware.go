@@ -1,21 +1,171 @@
 package main
 
 import (
-	"fmt"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
 	"net/http"
+	"regexp"
+	"strconv"
+	"time"
 
 	"github.com/darinmilner/goserver/internal/helpers"
+	"github.com/darinmilner/goserver/internal/i18n"
+	"github.com/darinmilner/goserver/internal/logging"
+	"github.com/darinmilner/goserver/internal/metrics"
+	"github.com/darinmilner/goserver/internal/security"
+	"github.com/darinmilner/goserver/internal/tracing"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
 	"github.com/justinas/nosurf"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
-//WriteToConsole middleware--USELESS
-func WriteToConsole(next http.Handler) http.Handler {
+//requestIDHeader carries the request ID to and from proxies and clients
+const requestIDHeader = "X-Request-ID"
+
+//validRequestID limits which incoming request IDs are trusted, anything else is replaced
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+//publicCSP allows the CDNs base.layout.html loads from. Styles allow 'unsafe-inline' because
+//notie, sweetalert2 and the datepicker inject style elements at run time
+var publicCSP = security.Policy{
+	"default-src": {"'self'"},
+	"script-src": {"'self'", security.NonceSource,
+		"https://code.jquery.com", "https://cdnjs.cloudflare.com", "https://stackpath.bootstrapcdn.com",
+		"https://cdn.jsdelivr.net", "https://unpkg.com"},
+	"style-src":       {"'self'", "'unsafe-inline'", "https://cdn.jsdelivr.net", "https://unpkg.com"},
+	"img-src":         {"'self'", "data:"},
+	"font-src":        {"'self'", "data:"},
+	"connect-src":     {"'self'"},
+	"object-src":      {"'none'"},
+	"base-uri":        {"'self'"},
+	"form-action":     {"'self'"},
+	"frame-ancestors": {"'none'"},
+}
+
+//adminCSP is for admin.layout.html. The admin theme bundles jQuery and Bootstrap under
+///static/admin, so only the notie, sweetalert2 and simple-datatables CDNs are needed
+var adminCSP = publicCSP.
+	With("script-src", "'self'", security.NonceSource, "https://cdn.jsdelivr.net", "https://unpkg.com")
+
+//RequestID stamps each request with an ID, reusing a well formed incoming X-Request-ID.
+//The ID is set on the response and on the logger put into the request context
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(requestIDHeader, id)
+
+		ctx := logging.WithRequestID(r.Context(), id)
+		ctx = logging.WithLogger(ctx, app.Logger.With(slog.String("request_id", id)))
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
+//RequestLogger logs one line per request with its route, status and duration
+func RequestLogger(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Println("Hit the page")
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		logging.FromContext(r.Context()).Info("request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("route", chi.RouteContext(r.Context()).RoutePattern()),
+			slog.Int("status", status),
+			slog.Int("bytes", ww.BytesWritten()),
+			slog.Duration("duration", time.Since(start)),
+		)
+	})
+}
+
+//LogUser adds the logged in user's ID to the request logger. It must run after SessionLoad
+func LogUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id := session.GetInt(r.Context(), "userId"); id > 0 {
+			l := logging.FromContext(r.Context()).With(slog.Int("user_id", id))
+			r = r.WithContext(logging.WithLogger(r.Context(), l))
+		}
 		next.ServeHTTP(w, r)
 	})
 }
 
+//Trace starts a span for each request, continuing the caller's trace from the traceparent header.
+//The trace and span IDs are added to the request logger, and once chi has routed the request
+//the span is named after the route pattern
+func Trace(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracing.Tracer().Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+				attribute.String("request.id", logging.RequestID(ctx)),
+			),
+		)
+		defer span.End()
+
+		if sc := span.SpanContext(); sc.IsValid() {
+			l := logging.FromContext(ctx).With(
+				slog.String("trace_id", sc.TraceID().String()),
+				slog.String("span_id", sc.SpanID().String()),
+			)
+			ctx = logging.WithLogger(ctx, l)
+		}
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		route := routeLabel(r)
+		span.SetName(r.Method + " " + route)
+		span.SetAttributes(semconv.HTTPRoute(route), semconv.HTTPResponseStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
+
+//routeLabel returns the chi route pattern of r. The pattern is only known once chi has routed
+//the request. Unmatched paths share one label so scanners can't create a series or span name per URL
+func routeLabel(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+		return rctx.RoutePattern()
+	}
+	return "unmatched"
+}
+
 //NoSurf adds CSRF to all POST requests
 func NoSurf(next http.Handler) http.Handler {
 	csrfHandler := nosurf.New(next)
@@ -23,9 +173,13 @@ func NoSurf(next http.Handler) http.Handler {
 	csrfHandler.SetBaseCookie(http.Cookie{
 		HttpOnly: true,
 		Path:     "/",
-		Secure:   app.InProduction,
-		SameSite: http.SameSiteLaxMode,
+		Domain:   app.Cookie.Domain,
+		Secure:   app.Cookie.Secure,
+		SameSite: app.Cookie.SameSiteMode(),
 	})
+	csrfHandler.SetFailureHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		helpers.ClientError(w, r, http.StatusForbidden)
+	}))
 	return csrfHandler
 }
 
@@ -34,14 +188,56 @@ func SessionLoad(next http.Handler) http.Handler {
 	return session.LoadAndSave(next)
 }
 
+//Locale puts the visitor's locale in the request context: the one they picked with the
+//language switcher, or the best match for their Accept-Language header
+func Locale(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		locale := session.GetString(r.Context(), "locale")
+		if !i18n.IsSupported(locale) {
+			locale = i18n.Negotiate(r.Header.Get("Accept-Language"))
+		}
+
+		w.Header().Set("Content-Language", locale)
+		w.Header().Add("Vary", "Accept-Language")
+		next.ServeHTTP(w, r.WithContext(i18n.WithLocale(r.Context(), locale)))
+	})
+}
+
 //Auth checks to see if someone is logged in
 func Auth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if !helpers.IsAuthenticated(r) {
-			session.Put(r.Context(), "error", "Must be logged in!")
+			session.Put(r.Context(), "error", i18n.T(i18n.Locale(r.Context()), "flash.login_required"))
 			http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 			return
 		}
 		next.ServeHTTP(w, r)
 	})
 }
+
+//Metrics records the count and latency of every request by chi route pattern and status
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		//deferred, so a request that panics is counted too, as the 500 it gets
+		returned := false
+		defer func() {
+			status := ww.Status()
+			switch {
+			case !returned && status == 0:
+				status = http.StatusInternalServerError
+			case status == 0:
+				status = http.StatusOK
+			}
+
+			labels := []string{r.Method, routeLabel(r), strconv.Itoa(status)}
+			metrics.HTTPRequests.WithLabelValues(labels...).Inc()
+			metrics.HTTPDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+		}()
+
+		next.ServeHTTP(ww, r)
+		returned = true
+	})
+}
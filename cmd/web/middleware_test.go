@@ -2,8 +2,22 @@ package main
 
 import (
 	"fmt"
+	"log/slog"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+
+	"github.com/darinmilner/goserver/internal/logging"
+	"github.com/darinmilner/goserver/internal/metrics"
+	"github.com/darinmilner/goserver/internal/tracing"
+	"github.com/go-chi/chi"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestNoSurf(t *testing.T) {
@@ -29,3 +43,117 @@ func TestSessionLoad(t *testing.T) {
 		t.Error(fmt.Sprintf("Type is not http.Handler, it is %t", v))
 	}
 }
+
+func TestMetrics(t *testing.T) {
+	mux := chi.NewRouter()
+	mux.Use(Metrics)
+	mux.Get("/rooms/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	mux.Get("/panics", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	for _, path := range []string{"/rooms/1", "/rooms/2", "/no/such/page", "/panics"} {
+		func() {
+			defer func() { recover() }()
+			mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+		}()
+	}
+
+	got := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues("GET", "/rooms/{id}", "418"))
+	if got != 2 {
+		t.Errorf("expected 2 requests for the route pattern but got %v", got)
+	}
+
+	got = testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues("GET", "unmatched", "404"))
+	if got != 1 {
+		t.Errorf("expected 1 unmatched request but got %v", got)
+	}
+
+	got = testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues("GET", "/panics", "500"))
+	if got != 1 {
+		t.Errorf("expected the panicking request to be counted but got %v", got)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var gotID string
+	h := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotID = logging.RequestID(r.Context())
+	}))
+
+	tests := []struct {
+		name     string
+		incoming string
+		reused   bool
+	}{
+		{"none", "", false},
+		{"valid", "abc-123.XYZ_9", true},
+		{"invalid", "bad id\nwith newline", false},
+		{"too long", strings.Repeat("a", 65), false},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		if e.incoming != "" {
+			req.Header.Set(requestIDHeader, e.incoming)
+		}
+		rr := httptest.NewRecorder()
+
+		h.ServeHTTP(rr, req)
+
+		header := rr.Header().Get(requestIDHeader)
+		if header == "" {
+			t.Errorf("%s: no %s on the response", e.name, requestIDHeader)
+		}
+		if header != gotID {
+			t.Errorf("%s: response has ID %q but the context has %q", e.name, header, gotID)
+		}
+		if e.reused && header != e.incoming {
+			t.Errorf("%s: expected incoming ID %q to be reused but got %q", e.name, e.incoming, header)
+		}
+		if !e.reused && header == e.incoming {
+			t.Errorf("%s: expected incoming ID %q to be replaced", e.name, e.incoming)
+		}
+	}
+}
+
+func TestTrace(t *testing.T) {
+	exp := tracetest.NewInMemoryExporter()
+	defer otel.SetTracerProvider(otel.GetTracerProvider())
+	otel.SetTracerProvider(tracing.NewProvider(sdktrace.NewSimpleSpanProcessor(exp), 1, "test"))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var logged bool
+	mux := chi.NewRouter()
+	mux.Use(Trace)
+	mux.Get("/rooms/{id}", func(w http.ResponseWriter, r *http.Request) {
+		logged = logging.FromContext(r.Context()) != slog.Default()
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	const parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req := httptest.NewRequest("GET", "/rooms/7", nil)
+	req.Header.Set("traceparent", parent)
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := exp.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span but got %d", len(spans))
+	}
+
+	s := spans[0]
+	if s.Name != "GET /rooms/{id}" {
+		t.Errorf("expected span named after the route pattern but got %q", s.Name)
+	}
+	if s.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("expected the incoming trace to be continued but got trace %s", s.SpanContext.TraceID())
+	}
+	if s.Status.Code != codes.Error {
+		t.Errorf("expected a 500 to mark the span as an error but got %v", s.Status.Code)
+	}
+	if !logged {
+		t.Error("expected the request logger to carry the trace ID")
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/darinmilner/goserver/internal/driver"
+	"github.com/darinmilner/goserver/internal/migrate"
+	"github.com/darinmilner/goserver/migrations"
+)
+
+const migrateUsage = "usage: migrate up | down [steps] | status"
+
+//runCommand runs a command given after the flags instead of starting the server
+func runCommand(db *driver.DB, args []string) error {
+	switch args[0] {
+	case "migrate":
+		return migrateCommand(db, args[1:])
+	default:
+		return fmt.Errorf("unknown command %q, %s", args[0], migrateUsage)
+	}
+}
+
+func migrateCommand(db *driver.DB, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	m, err := migrate.New(db.SQL, migrations.FS, app.Logger)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		n, err := m.Up(ctx)
+		app.Logger.Info("Applied migrations", slog.Int("count", n))
+		return err
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("steps must be a positive number, got %q", args[1])
+			}
+		}
+		n, err := m.Down(ctx, steps)
+		app.Logger.Info("Rolled back migrations", slog.Int("count", n))
+		return err
+
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.Applied {
+				applied = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%d  %-70s %s\n", s.Version, s.Name, applied)
+		}
+		return nil
+
+	default:
+		return errors.New(migrateUsage)
+	}
+}
+
+//autoMigrate applies pending migrations on start up
+func autoMigrate(db *driver.DB) error {
+	m, err := migrate.New(db.SQL, migrations.FS, app.Logger)
+	if err != nil {
+		return err
+	}
+
+	n, err := m.Up(context.Background())
+	if err != nil {
+		return err
+	}
+
+	app.Logger.Info("Applied migrations", slog.Int("count", n))
+	return nil
+}
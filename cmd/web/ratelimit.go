@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/darinmilner/goserver/internal/config"
+	"github.com/darinmilner/goserver/internal/driver"
+	"github.com/darinmilner/goserver/internal/helpers"
+	"github.com/darinmilner/goserver/internal/ratelimit"
+)
+
+//rateLimitSweepInterval is how often idle rate limit buckets are removed
+const rateLimitSweepInterval = time.Minute
+
+//rateStore holds the rate limit buckets, it is set up in run from the ratelimit.backend setting
+var rateStore ratelimit.Store
+
+//newRateStore returns the store for the configured backend
+func newRateStore(c config.RateLimitConfig, db *driver.DB) ratelimit.Store {
+	if c.Backend == "postgres" {
+		return ratelimit.NewPostgresStore(db.SQL)
+	}
+	return ratelimit.NewMemoryStore()
+}
+
+//rateLimit returns middleware limiting a route group to limit per client IP
+func rateLimit(a *config.AppConfig, group string, limit config.RateLimit) func(http.Handler) http.Handler {
+	if rateStore == nil {
+		rateStore = ratelimit.NewMemoryStore()
+	}
+
+	l := &ratelimit.Limiter{
+		Store:          rateStore,
+		Group:          group,
+		Limit:          limit,
+		TrustedProxies: a.RateLimit.TrustedProxies,
+		Rejected: func(w http.ResponseWriter, r *http.Request) {
+			helpers.ClientError(w, r, http.StatusTooManyRequests)
+		},
+	}
+	return l.Handler
+}
+
+//sweepRateLimits removes idle buckets until ctx is cancelled. A bucket idle for the longest
+//period of any limit is full again, so forgetting it changes nothing
+func sweepRateLimits(ctx context.Context) {
+	idle := time.Minute
+	for _, l := range []config.RateLimit{app.RateLimit.Availability, app.RateLimit.Reservation, app.RateLimit.Login} {
+		if l.Per > idle {
+			idle = l.Per
+		}
+	}
+
+	ticker := time.NewTicker(rateLimitSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := rateStore.Sweep(ctx, idle); err != nil && ctx.Err() == nil {
+				app.Logger.Error("sweeping rate limits", slog.Any("error", err))
+			}
+		}
+	}
+}
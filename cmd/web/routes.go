@@ -3,61 +3,113 @@ package main
 import (
 	"net/http"
 
+	"github.com/darinmilner/goserver/internal/assets"
 	"github.com/darinmilner/goserver/internal/config"
 	"github.com/darinmilner/goserver/internal/handlers"
+	"github.com/darinmilner/goserver/internal/helpers"
+	"github.com/darinmilner/goserver/internal/metrics"
+	"github.com/darinmilner/goserver/internal/security"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 )
 
+//opsRoutes serves health, readiness, build info and metrics on the ops listener, which is
+//kept off the public network
+func opsRoutes() http.Handler {
+	mux := chi.NewRouter()
+
+	mux.Get("/healthz", Healthz)
+	mux.Get("/readyz", Readyz)
+	mux.Get("/version", Version)
+	mux.Handle("/metrics", metrics.Handler())
+
+	return mux
+}
+
 func routes(app *config.AppConfig) http.Handler {
 
 	mux := chi.NewRouter()
 
+	mux.Use(RequestID)
+	mux.Use(Trace)
+	//outside the recoverer, so a request that panics is counted with the 500 it gets
+	mux.Use(Metrics)
 	mux.Use(middleware.Recoverer)
-	mux.Use(WriteToConsole)
-	mux.Use(NoSurf)
-	mux.Use(SessionLoad)
-	//mux.Use(middleware.Logger)
-
-	mux.Get("/", handlers.Repo.Home)
-	mux.Get("/about", handlers.Repo.About)
-	mux.Get("/generals-quarters", handlers.Repo.Generals)
-	mux.Get("/majors-suite", handlers.Repo.Majors)
-
-	mux.Get("/search-availability", handlers.Repo.Availability)
-	mux.Post("/search-availability", handlers.Repo.PostAvailability)
-	mux.Post("/search-availability-json", handlers.Repo.AvailabilityJSON)
-	mux.Get("/choose-room/{id}", handlers.Repo.ChooseRoom)
-	mux.Get("/book-room", handlers.Repo.BookRoom)
-
-	mux.Get("/contact", handlers.Repo.Contact)
-	mux.Get("/make-reservation", handlers.Repo.Reservation)
-	mux.Post("/make-reservation", handlers.Repo.PostReservation)
-	mux.Get("/reservation-summary", handlers.Repo.ReservationSummary)
-
-	mux.Get("/user/login", handlers.Repo.ShowLogin)
-	mux.Post("/user/login", handlers.Repo.PostShowLogin)
-
-	mux.Get("/user/logout", handlers.Repo.Logout)
-
-	mux.Route("/admin", func(mux chi.Router) {
-		mux.Use(Auth)
-		mux.Get("/dashboard", handlers.Repo.AdminDashboard)
-
-		mux.Get("/new-reservations", handlers.Repo.AdminNewReservations)
-		mux.Get("/all-reservations", handlers.Repo.AdminAllReservations)
-		mux.Get("/calendar", handlers.Repo.AdminReservationsCalendar)
-		mux.Post("/calendar", handlers.Repo.AdminPostReservationsCalendar)
-
-		mux.Get("/process-reservation/{src}/{id}/do", handlers.Repo.AdminProcessReservation)
-		mux.Get("/delete-reservation/{src}/{id}/do", handlers.Repo.AdminDeleteReservation)
-
-		mux.Get("/reservations/{src}/{id}/show", handlers.Repo.AdminShowReservation)
-		mux.Post("/reservations/{src}/{id}", handlers.Repo.AdminPostShowReservation)
+	mux.Use(security.Headers(publicCSP, app.InProduction))
+
+	//liveness is polled by the load balancer, it needs no session or CSRF protection. Readiness,
+	//build info and metrics are on the ops listener
+	mux.Get("/healthz", Healthz)
+
+	//the payment provider signs its webhooks, it has no session or CSRF token to send
+	mux.With(RequestLogger).Post("/payments/webhook", handlers.Repo.PaymentWebhook)
+
+	limitAvailability := rateLimit(app, "availability", app.RateLimit.Availability)
+	limitReservation := rateLimit(app, "reservation", app.RateLimit.Reservation)
+	limitLogin := rateLimit(app, "login", app.RateLimit.Login)
+
+	mux.Group(func(mux chi.Router) {
+		mux.Use(RequestLogger)
+		mux.Use(SessionLoad)
+		mux.Use(Locale)
+		mux.Use(NoSurf)
+		mux.Use(LogUser)
+
+		mux.Method(http.MethodGet, "/", helpers.Handler(handlers.Repo.Home))
+		mux.Method(http.MethodGet, "/about", helpers.Handler(handlers.Repo.About))
+		mux.Method(http.MethodGet, "/generals-quarters", helpers.Handler(handlers.Repo.Generals))
+		mux.Method(http.MethodGet, "/majors-suite", helpers.Handler(handlers.Repo.Majors))
+
+		mux.Method(http.MethodGet, "/search-availability", helpers.Handler(handlers.Repo.Availability))
+		mux.With(limitAvailability).Method(http.MethodPost, "/search-availability", helpers.Handler(handlers.Repo.PostAvailability))
+		mux.With(limitAvailability).Post("/search-availability-json", handlers.Repo.AvailabilityJSON)
+		mux.Get("/choose-room/{id}", handlers.Repo.ChooseRoom)
+		mux.Method(http.MethodGet, "/book-room", helpers.Handler(handlers.Repo.BookRoom))
+
+		mux.Method(http.MethodGet, "/contact", helpers.Handler(handlers.Repo.Contact))
+		mux.Method(http.MethodGet, "/make-reservation", helpers.Handler(handlers.Repo.Reservation))
+		mux.With(limitReservation).Method(http.MethodPost, "/make-reservation", helpers.Handler(handlers.Repo.PostReservation))
+		mux.Post("/make-reservation/hold", handlers.Repo.RenewHold)
+		mux.Method(http.MethodGet, "/checkout", helpers.Handler(handlers.Repo.Checkout))
+		mux.With(limitReservation).Method(http.MethodPost, "/checkout", helpers.Handler(handlers.Repo.PostCheckout))
+		mux.Method(http.MethodGet, "/reservation-summary", helpers.Handler(handlers.Repo.ReservationSummary))
+		mux.Method(http.MethodGet, "/my-reservation/{token}", helpers.Handler(handlers.Repo.MyReservation))
+		mux.Method(http.MethodGet, "/my-reservation/{token}/invoice", helpers.Handler(handlers.Repo.MyInvoice))
+		mux.Method(http.MethodPost, "/my-reservation/{token}/cancel", helpers.Handler(handlers.Repo.MyCancelReservation))
+
+		mux.Method(http.MethodGet, "/user/login", helpers.Handler(handlers.Repo.ShowLogin))
+		mux.With(limitLogin).Method(http.MethodPost, "/user/login", helpers.Handler(handlers.Repo.PostShowLogin))
+
+		mux.Get("/user/logout", handlers.Repo.Logout)
+
+		mux.Get("/language/{locale}", handlers.Repo.SetLanguage)
+
+		mux.Route("/admin", func(mux chi.Router) {
+			mux.Use(Auth)
+			mux.Use(security.Override(adminCSP))
+			mux.Method(http.MethodGet, "/dashboard", helpers.Handler(handlers.Repo.AdminDashboard))
+
+			mux.Method(http.MethodGet, "/new-reservations", helpers.Handler(handlers.Repo.AdminNewReservations))
+			mux.Method(http.MethodGet, "/all-reservations", helpers.Handler(handlers.Repo.AdminAllReservations))
+			mux.Method(http.MethodGet, "/calendar", helpers.Handler(handlers.Repo.AdminReservationsCalendar))
+			mux.Method(http.MethodPost, "/calendar", helpers.Handler(handlers.Repo.AdminPostReservationsCalendar))
+
+			mux.Get("/process-reservation/{src}/{id}/do", handlers.Repo.AdminProcessReservation)
+			mux.Get("/delete-reservation/{src}/{id}/do", handlers.Repo.AdminDeleteReservation)
+
+			mux.Method(http.MethodGet, "/reservations/{src}/{id}/show", helpers.Handler(handlers.Repo.AdminShowReservation))
+			mux.Method(http.MethodPost, "/reservations/{src}/{id}", helpers.Handler(handlers.Repo.AdminPostShowReservation))
+			mux.Method(http.MethodPost, "/reservations/{src}/{id}/cancel", helpers.Handler(handlers.Repo.AdminCancelReservation))
+			mux.Method(http.MethodGet, "/reservations/{src}/{id}/invoice", helpers.Handler(handlers.Repo.AdminInvoice))
+			mux.Method(http.MethodPost, "/reservations/{src}/{id}/invoice", helpers.Handler(handlers.Repo.AdminIssueInvoice))
+		})
 	})
-	fileServer := http.FileServer(http.Dir("./static/"))
 
-	mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
+	//error pages render through the layout, which reads flash messages from the session
+	mux.NotFound(RequestLogger(SessionLoad(Locale(http.HandlerFunc(handlers.Repo.NotFound)))).ServeHTTP)
+	mux.MethodNotAllowed(RequestLogger(SessionLoad(Locale(http.HandlerFunc(handlers.Repo.MethodNotAllowed)))).ServeHTTP)
+
+	mux.Handle(assets.Prefix+"*", http.StripPrefix(assets.Prefix, app.Assets))
 
 	return mux
 }
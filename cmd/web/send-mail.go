@@ -1,31 +1,56 @@
 package main
 
 import (
-	"fmt"
-	"io/ioutil"
-	"log"
+	"context"
+	"io/fs"
+	"log/slog"
+	"path"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/darinmilner/goserver/internal/i18n"
+	"github.com/darinmilner/goserver/internal/metrics"
 	"github.com/darinmilner/goserver/internal/models"
+	"github.com/darinmilner/goserver/internal/tracing"
 	mail "github.com/xhit/go-simple-mail/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func listenForMail() {
+//listenForMail passes every message on the mail channel to send. The returned channel is closed
+//once app.MailChan has been closed and the queued messages have been sent
+func listenForMail(send func(models.MailData)) <-chan struct{} {
+	done := make(chan struct{})
 	go func() {
-		for {
-			msg := <-app.MailChan
-			sendMsg(msg)
+		atomic.StoreInt32(&mailWorkerRunning, 1)
+		defer atomic.StoreInt32(&mailWorkerRunning, 0)
+		defer close(done)
+		for msg := range app.MailChan {
+			send(msg)
 		}
 	}()
+	return done
 }
 
+//sendMsg sends one message. The mail worker runs outside any request, so the span starts
+//a new trace linked to the request that queued the message
 func sendMsg(m models.MailData) {
-	server := mail.NewSMTPClient()
-	//Change values when server is deployed to the cloud  mailgun.com?
-	server.Host = "localhost"
+	_, span := tracing.Tracer().Start(context.Background(), "sendMsg",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithLinks(trace.Link{SpanContext: m.SpanContext}),
+		trace.WithAttributes(attribute.String("mail.template", m.Template)),
+	)
+	defer span.End()
+
+	log := app.Logger.With(slog.String("trace_id", span.SpanContext().TraceID().String()))
 
-	server.Port = 1025
+	server := mail.NewSMTPClient()
+	server.Host = app.SMTP.Host
+	server.Port = app.SMTP.Port
+	server.Username = app.SMTP.Username
+	server.Password = app.SMTP.Password
 	server.KeepAlive = false
 
 	server.ConnectTimeout = 10 * time.Second
@@ -33,7 +58,11 @@ func sendMsg(m models.MailData) {
 
 	client, err := server.Connect()
 	if err != nil {
-		errorLog.Println(err)
+		log.Error("connecting to mail server", slog.Any("error", err), slog.String("to", m.To))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "connecting to mail server")
+		metrics.MailFailures.Inc()
+		return
 	}
 
 	email := mail.NewMSG()
@@ -42,21 +71,39 @@ func sendMsg(m models.MailData) {
 	if m.Template == "" {
 		email.SetBody(mail.TextHTML, m.Content)
 	} else {
-		data, err := ioutil.ReadFile(fmt.Sprintf("./email-templates/%s", m.Template))
+		data, err := fs.ReadFile(app.EmailTemplates, mailTemplate(app.EmailTemplates, m.Template, m.Locale))
 		if err != nil {
-			app.ErrorLog.Println(err)
+			log.Error("reading mail template", slog.Any("error", err), slog.String("template", m.Template))
 		}
 
-		mailTemplate := string(data)
-		msgToSend := strings.Replace(mailTemplate, "[%body%]", m.Content, 1)
+		msgToSend := strings.Replace(string(data), "[%body%]", m.Content, 1)
 		email.SetBody(mail.TextHTML, msgToSend)
 	}
 
 	err = email.Send(client)
 
 	if err != nil {
-		log.Println(err)
+		log.Error("sending mail", slog.Any("error", err), slog.String("to", m.To))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "sending mail")
+		metrics.MailFailures.Inc()
 	} else {
-		log.Println("Email Sent")
+		log.Info("Email sent", slog.String("to", m.To), slog.String("subject", m.Subject))
+		metrics.MailSent.Inc()
+	}
+}
+
+//mailTemplate returns the translation of name for locale, basic.es.html for basic.html, or name
+//itself when there is no translation
+func mailTemplate(fsys fs.FS, name, locale string) string {
+	if locale == "" || locale == i18n.Default {
+		return name
+	}
+
+	ext := path.Ext(name)
+	translated := strings.TrimSuffix(name, ext) + "." + locale + ext
+	if _, err := fs.Stat(fsys, translated); err == nil {
+		return translated
 	}
+	return name
 }
@@ -4,9 +4,12 @@ import (
 	"net/http"
 	"os"
 	"testing"
+
+	"github.com/darinmilner/goserver/internal/logging"
 )
 
 func TestMain(m *testing.M) {
+	app.Logger = logging.New(false, os.Stdout)
 
 	os.Exit(m.Run())
 }
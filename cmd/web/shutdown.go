@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+//background tracks long running goroutines so they can be stopped together on shutdown
+type background struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+//newBackground returns an empty set of background workers
+func newBackground() *background {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &background{
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+//Go starts fn in its own goroutine. fn must return once its context is cancelled
+func (b *background) Go(name string, fn func(ctx context.Context)) {
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		fn(b.ctx)
+		app.Logger.Info("Stopped background worker", slog.String("worker", name))
+	}()
+}
+
+//Stop cancels every worker and waits for them to return or for ctx to expire
+func (b *background) Stop(ctx context.Context) error {
+	b.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("background workers: %w", ctx.Err())
+	}
+}
+
+//shutdown stops the app in order: stop accepting connections and drain in-flight requests,
+//stop the background workers, flush the mail queue, then close the database pool.
+//Every step shares one deadline of timeout
+func shutdown(srv *http.Server, timeout time.Duration, workers *background, mailDone <-chan struct{}, db io.Closer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var errs []error
+
+	app.Logger.Info("Draining in-flight requests")
+	drained := true
+	if err := srv.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("http server: %w", err))
+		_ = srv.Close()
+		drained = false
+	}
+
+	app.Logger.Info("Stopping background workers")
+	if err := workers.Stop(ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	//handlers that are still running could send on the mail channel, so it is only
+	//closed once every request has finished
+	if drained {
+		app.Logger.Info("Flushing mail queue", slog.Int("waiting", len(app.MailChan)))
+		close(app.MailChan)
+		select {
+		case <-mailDone:
+		case <-ctx.Done():
+			errs = append(errs, fmt.Errorf("mail queue: %w, %d messages not sent", ctx.Err(), len(app.MailChan)))
+		}
+	} else {
+		errs = append(errs, fmt.Errorf("mail queue: not flushed, %d messages not sent", len(app.MailChan)))
+	}
+
+	app.Logger.Info("Closing database pool")
+	if err := db.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("database: %w", err))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("unclean shutdown: %v", errs)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/darinmilner/goserver/internal/models"
+)
+
+type closer struct {
+	closed bool
+}
+
+func (c *closer) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestShutdown(t *testing.T) {
+	app.MailChan = make(chan models.MailData, mailQueueSize)
+
+	var sent int32
+	mailDone := listenForMail(func(models.MailData) {
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&sent, 1)
+	})
+
+	started := make(chan struct{})
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			time.Sleep(100 * time.Millisecond)
+			app.MailChan <- models.MailData{To: "guest@here.com"}
+			w.WriteHeader(http.StatusOK)
+		}),
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(l)
+
+	workers := newBackground()
+	var workerStopped int32
+	workers.Go("test", func(ctx context.Context) {
+		<-ctx.Done()
+		atomic.StoreInt32(&workerStopped, 1)
+	})
+
+	status := make(chan int, 1)
+	go func() {
+		resp, err := http.Get("http://" + l.Addr().String())
+		if err != nil {
+			status <- 0
+			return
+		}
+		resp.Body.Close()
+		status <- resp.StatusCode
+	}()
+
+	<-started
+	db := &closer{}
+	err = shutdown(srv, 5*time.Second, workers, mailDone, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := <-status; got != http.StatusOK {
+		t.Errorf("in-flight request was not drained, got status %d", got)
+	}
+	if atomic.LoadInt32(&sent) != 1 {
+		t.Error("queued mail was not flushed")
+	}
+	if atomic.LoadInt32(&workerStopped) != 1 {
+		t.Error("background worker was not stopped")
+	}
+	if !db.closed {
+		t.Error("database was not closed")
+	}
+}
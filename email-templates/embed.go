@@ -0,0 +1,9 @@
+//Package emailtemplates holds the HTML mail templates that are embedded into the binary.
+//A template's [%body%] placeholder is replaced with the message content
+package emailtemplates
+
+import "embed"
+
+//FS holds every mail template
+//go:embed *.html
+var FS embed.FS
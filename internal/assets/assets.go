@@ -0,0 +1,225 @@
+//Package assets serves the static files. Every file gets a content hashed URL so browsers can
+//cache it forever, and text files are kept gzip and brotli compressed
+package assets
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+//Prefix is the URL path the static files are served under
+const Prefix = "/static/"
+
+//hashLength is how many hex characters of the content hash go into a fingerprinted name
+const hashLength = 10
+
+//minCompressSize is the smallest file worth compressing
+const minCompressSize = 1024
+
+//compressible lists the extensions of files that shrink when compressed. Images and woff fonts
+//are compressed already
+var compressible = map[string]bool{
+	".css":  true,
+	".js":   true,
+	".map":  true,
+	".json": true,
+	".svg":  true,
+	".txt":  true,
+	".html": true,
+	".ttf":  true,
+	".eot":  true,
+	".otf":  true,
+}
+
+const (
+	cacheForever    = "public, max-age=31536000, immutable"
+	cacheRevalidate = "no-cache"
+)
+
+type file struct {
+	hash   string
+	data   []byte
+	gzip   []byte
+	brotli []byte
+}
+
+//Manifest knows the content hash of every static file and serves them
+type Manifest struct {
+	fsys fs.FS
+	live bool
+
+	//files is keyed by the file's path in fsys, hashed maps a fingerprinted path back to it
+	files  map[string]*file
+	hashed map[string]string
+}
+
+//New reads every file in fsys, hashes it and compresses the text files
+func New(fsys fs.FS) (*Manifest, error) {
+	m := &Manifest{
+		fsys:   fsys,
+		files:  make(map[string]*file),
+		hashed: make(map[string]string),
+	}
+
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+
+		sum := sha256.Sum256(data)
+		f := &file{hash: hex.EncodeToString(sum[:])[:hashLength], data: data}
+
+		if compressible[strings.ToLower(path.Ext(name))] && len(data) >= minCompressSize {
+			if f.gzip, err = compress(data, gzipWriter); err != nil {
+				return fmt.Errorf("assets: compressing %s: %w", name, err)
+			}
+			if f.brotli, err = compress(data, brotliWriter); err != nil {
+				return fmt.Errorf("assets: compressing %s: %w", name, err)
+			}
+		}
+
+		m.files[name] = f
+		m.hashed[fingerprint(name, f.hash)] = name
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+//Live serves fsys as it is when each request arrives, without fingerprints or compression,
+//so edits to the files show up straight away
+func Live(fsys fs.FS) *Manifest {
+	return &Manifest{fsys: fsys, live: true}
+}
+
+//Path returns the URL of the static file name, such as css/styles.css. The URL is fingerprinted
+//unless the manifest is live or doesn't know the file
+func (m *Manifest) Path(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	if m == nil || m.live {
+		return Prefix + name
+	}
+
+	f, ok := m.files[name]
+	if !ok {
+		return Prefix + name
+	}
+	return Prefix + fingerprint(name, f.hash)
+}
+
+//ServeHTTP serves the file at r.URL.Path, which must already have Prefix stripped.
+//Fingerprinted paths are cached forever, plain paths are revalidated with their ETag
+func (m *Manifest) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+
+	if m.live {
+		w.Header().Set("Cache-Control", cacheRevalidate)
+		http.ServeFileFS(w, r, m.fsys, name)
+		return
+	}
+
+	cacheControl := cacheRevalidate
+	if original, ok := m.hashed[name]; ok {
+		name = original
+		cacheControl = cacheForever
+	}
+
+	f, ok := m.files[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	h := w.Header()
+	h.Set("Cache-Control", cacheControl)
+	if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+		h.Set("Content-Type", ctype)
+	}
+
+	body, etag := f.data, f.hash
+	if f.gzip != nil || f.brotli != nil {
+		h.Add("Vary", "Accept-Encoding")
+
+		switch {
+		case f.brotli != nil && accepts(r, "br"):
+			body, etag = f.brotli, f.hash+"-br"
+			h.Set("Content-Encoding", "br")
+		case f.gzip != nil && accepts(r, "gzip"):
+			body, etag = f.gzip, f.hash+"-gzip"
+			h.Set("Content-Encoding", "gzip")
+		}
+	}
+	h.Set("ETag", `"`+etag+`"`)
+
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(body))
+}
+
+//fingerprint puts hash before the extension of name, css/styles.css becomes css/styles.<hash>.css
+func fingerprint(name, hash string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hash + ext
+}
+
+//accepts reports whether the Accept-Encoding header of r allows encoding
+func accepts(r *http.Request, encoding string) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(name), encoding) {
+			continue
+		}
+		q := strings.ReplaceAll(params, " ", "")
+		return q != "q=0" && q != "q=0.0" && q != "q=0.00" && q != "q=0.000"
+	}
+	return false
+}
+
+type compressor interface {
+	Write([]byte) (int, error)
+	Close() error
+}
+
+func gzipWriter(buf *bytes.Buffer) compressor {
+	w, _ := gzip.NewWriterLevel(buf, gzip.BestCompression)
+	return w
+}
+
+//brotliWriter uses the default level, the best level takes many seconds for the admin theme
+func brotliWriter(buf *bytes.Buffer) compressor {
+	return brotli.NewWriterLevel(buf, brotli.DefaultCompression)
+}
+
+//compress returns data compressed with the writer from newWriter, or nil if that doesn't make it smaller
+func compress(data []byte, newWriter func(*bytes.Buffer) compressor) ([]byte, error) {
+	var buf bytes.Buffer
+	w := newWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	if buf.Len() >= len(data) {
+		return nil, nil
+	}
+	return buf.Bytes(), nil
+}
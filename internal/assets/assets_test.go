@@ -0,0 +1,129 @@
+package assets
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var testFS = fstest.MapFS{
+	"css/styles.css": {Data: []byte(strings.Repeat("body { margin: 0; }\n", 100))},
+	"img/logo.png":   {Data: []byte("not really a png")},
+}
+
+func serve(t *testing.T, m *Manifest, url string, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest("GET", url, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rr := httptest.NewRecorder()
+	http.StripPrefix(Prefix, m).ServeHTTP(rr, req)
+	return rr
+}
+
+func TestPath(t *testing.T) {
+	m, err := New(testFS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := m.Path("css/styles.css")
+	if !strings.HasPrefix(p, "/static/css/styles.") || !strings.HasSuffix(p, ".css") || len(p) != len("/static/css/styles..css")+hashLength {
+		t.Errorf("unexpected fingerprinted path %s", p)
+	}
+
+	if p := m.Path("css/missing.css"); p != "/static/css/missing.css" {
+		t.Errorf("unknown files should keep their path, got %s", p)
+	}
+
+	if p := Live(testFS).Path("css/styles.css"); p != "/static/css/styles.css" {
+		t.Errorf("live manifests should not fingerprint, got %s", p)
+	}
+
+	var nilManifest *Manifest
+	if p := nilManifest.Path("js/app.js"); p != "/static/js/app.js" {
+		t.Errorf("nil manifest returned %s", p)
+	}
+}
+
+func TestServeFingerprinted(t *testing.T) {
+	m, err := New(testFS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := serve(t, m, m.Path("img/logo.png"), nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 but got %d", rr.Code)
+	}
+	if cc := rr.Header().Get("Cache-Control"); !strings.Contains(cc, "immutable") {
+		t.Errorf("fingerprinted path should be immutable, got %q", cc)
+	}
+	if rr.Body.String() != "not really a png" {
+		t.Errorf("wrong body %q", rr.Body.String())
+	}
+
+	rr = serve(t, m, "/static/img/logo.png", nil)
+	if cc := rr.Header().Get("Cache-Control"); cc != "no-cache" {
+		t.Errorf("plain path should be revalidated, got %q", cc)
+	}
+
+	etag := rr.Header().Get("ETag")
+	rr = serve(t, m, "/static/img/logo.png", http.Header{"If-None-Match": {etag}})
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("expected 304 for a matching ETag but got %d", rr.Code)
+	}
+
+	rr = serve(t, m, "/static/img/", nil)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("directories should not be listed, got %d", rr.Code)
+	}
+}
+
+func TestServeCompressed(t *testing.T) {
+	m, err := New(testFS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		acceptEncoding string
+		want           string
+	}{
+		{"gzip, deflate, br", "br"},
+		{"gzip", "gzip"},
+		{"br;q=0, gzip", "gzip"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		rr := serve(t, m, m.Path("css/styles.css"), http.Header{"Accept-Encoding": {tt.acceptEncoding}})
+		if got := rr.Header().Get("Content-Encoding"); got != tt.want {
+			t.Errorf("Accept-Encoding %q: expected encoding %q but got %q", tt.acceptEncoding, tt.want, got)
+		}
+		if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/css") {
+			t.Errorf("Accept-Encoding %q: wrong content type %q", tt.acceptEncoding, ct)
+		}
+		if rr.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("Accept-Encoding %q: missing Vary header", tt.acceptEncoding)
+		}
+
+		if tt.want == "gzip" {
+			zr, err := gzip.NewReader(rr.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(zr)
+			if !bytes.Equal(body, testFS["css/styles.css"].Data) {
+				t.Error("gzip body does not match the file")
+			}
+		}
+	}
+}
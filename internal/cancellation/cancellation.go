@@ -0,0 +1,48 @@
+//Package cancellation works out what a guest gets back when a reservation is cancelled under
+//its room type's policy. Amounts are cents, as in package pricing
+package cancellation
+
+import (
+	"time"
+
+	"github.com/darinmilner/goserver/internal/dates"
+)
+
+//Who asked for a cancellation
+const (
+	ActorOwner = "owner"
+	ActorGuest = "guest"
+)
+
+//Policy lets a guest cancel for free until FreeDays before arrival. After that
+//PenaltyPercent of the total is kept
+type Policy struct {
+	FreeDays       int
+	PenaltyPercent int
+}
+
+//Outcome is what cancelling costs. Penalty is kept from the total and Refund is what is
+//given back of what the guest has paid
+type Outcome struct {
+	Free       bool
+	DaysBefore int
+	Penalty    int64
+	Refund     int64
+}
+
+//Calculate returns the outcome of cancelling, on now, a stay arriving on start that costs
+//total, of which paid has been paid. The penalty is rounded down, and a guest who paid less
+//than it gets nothing back but isn't asked for the rest
+func Calculate(p Policy, total, paid int64, start, now time.Time) Outcome {
+	o := Outcome{DaysBefore: dates.Between(now, start)}
+	if o.DaysBefore >= p.FreeDays || p.PenaltyPercent <= 0 {
+		o.Free = true
+	} else if total > 0 {
+		o.Penalty = total * int64(min(p.PenaltyPercent, 100)) / 100
+	}
+
+	if paid > o.Penalty {
+		o.Refund = paid - o.Penalty
+	}
+	return o
+}
@@ -0,0 +1,40 @@
+package cancellation
+
+import (
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	t, _ := time.Parse("2006-01-02", s)
+	return t
+}
+
+func TestCalculate(t *testing.T) {
+	standard := Policy{FreeDays: 14, PenaltyPercent: 50}
+	arrival := date("2040-01-15")
+
+	tests := []struct {
+		name   string
+		policy Policy
+		total  int64
+		paid   int64
+		now    time.Time
+		want   Outcome
+	}{
+		{"well ahead", standard, 20000, 6000, date("2039-12-01"), Outcome{Free: true, DaysBefore: 45, Refund: 6000}},
+		{"last free day", standard, 20000, 6000, date("2040-01-01").Add(23 * time.Hour), Outcome{Free: true, DaysBefore: 14, Refund: 6000}},
+		{"inside the window", standard, 20000, 16000, date("2040-01-02"), Outcome{DaysBefore: 13, Penalty: 10000, Refund: 6000}},
+		{"paid less than the penalty", standard, 20000, 6000, date("2040-01-10"), Outcome{DaysBefore: 5, Penalty: 10000}},
+		{"after arrival", standard, 20000, 20000, date("2040-01-16"), Outcome{DaysBefore: -1, Penalty: 10000, Refund: 10000}},
+		{"rounded down", standard, 10001, 10001, date("2040-01-10"), Outcome{DaysBefore: 5, Penalty: 5000, Refund: 5001}},
+		{"no penalty", Policy{FreeDays: 14}, 20000, 6000, date("2040-01-10"), Outcome{Free: true, DaysBefore: 5, Refund: 6000}},
+		{"nothing paid", standard, 20000, 0, date("2039-12-01"), Outcome{Free: true, DaysBefore: 45}},
+	}
+
+	for _, tt := range tests {
+		if got := Calculate(tt.policy, tt.total, tt.paid, arrival, tt.now); got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
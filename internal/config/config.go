@@ -2,9 +2,13 @@ package config
 
 import (
 	"html/template"
-	"log"
+	"io/fs"
+	"log/slog"
+	"net"
+	"time"
 
 	"github.com/alexedwards/scs/v2"
+	"github.com/darinmilner/goserver/internal/assets"
 	"github.com/darinmilner/goserver/internal/models"
 )
 
@@ -12,9 +16,104 @@ import (
 type AppConfig struct {
 	UseCache      bool
 	TemplateCache map[string]*template.Template
-	InfoLog       *log.Logger
-	ErrorLog      *log.Logger
+	Logger        *slog.Logger
 	InProduction  bool
 	Session       *scs.SessionManager
 	MailChan      chan models.MailData
+
+	//Templates, EmailTemplates and Static are the embedded files, or AssetsDir on disk when set
+	AssetsDir      string
+	Templates      fs.FS
+	EmailTemplates fs.FS
+	Static         fs.FS
+	Assets         *assets.Manifest
+
+	ListenAddr      string
+	OpsAddr         string
+	PublicURL       string
+	ShutdownTimeout time.Duration
+	DB              DBConfig
+	AutoMigrate     bool
+	SMTP            SMTPConfig
+	SessionLifetime time.Duration
+	HoldLifetime    time.Duration
+	Cookie          CookieConfig
+	Tracing         TracingConfig
+	RateLimit       RateLimitConfig
+	Payments        PaymentsConfig
+	Invoice         InvoiceConfig
+}
+
+//DBConfig holds the database connection settings
+type DBConfig struct {
+	DSN      string
+	Host     string
+	Port     int
+	Name     string
+	User     string
+	Password string
+	SSLMode  string
+}
+
+//SMTPConfig holds the outgoing mail server settings
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+//TracingConfig holds the OpenTelemetry trace exporter settings
+type TracingConfig struct {
+	Exporter    string
+	Endpoint    string
+	SampleRatio float64
+}
+
+//RateLimitConfig holds the rate limits for the public routes most likely to be abused
+type RateLimitConfig struct {
+	Backend        string
+	TrustedProxies []*net.IPNet
+	Availability   RateLimit
+	Reservation    RateLimit
+	Login          RateLimit
+}
+
+//RateLimit allows Requests per Per, in bursts of up to Requests. Zero Requests turns the limit off
+type RateLimit struct {
+	Requests int
+	Per      time.Duration
+}
+
+//PerSecond returns how many tokens the bucket gains each second
+func (l RateLimit) PerSecond() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+//PaymentsConfig holds the payment provider settings. DepositPercent of a reservation's total
+//is taken at checkout and the rest is the balance due
+type PaymentsConfig struct {
+	Provider       string
+	Currency       string
+	DepositPercent int
+	WebhookSecret  string
+}
+
+//InvoiceConfig holds who invoices are issued by. Invoice numbers are Prefix followed by a
+//sequence shared by every reservation
+type InvoiceConfig struct {
+	Prefix  string
+	Issuer  string
+	Address string
+	TaxID   string
+}
+
+//CookieConfig holds the session cookie settings
+type CookieConfig struct {
+	Name     string
+	Domain   string
+	Persist  bool
+	Secure   bool
+	SameSite string
 }
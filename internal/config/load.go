@@ -0,0 +1,490 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+//EnvPrefix is prepended to every environment variable the loader reads
+const EnvPrefix = "GOSERVER_"
+
+//DefaultConfigFile is read when no -config flag or GOSERVER_CONFIG is given and the file exists
+const DefaultConfigFile = "config.yml"
+
+//setting describes one configuration key. Keys are dotted paths matching the YAML layout,
+//the environment variable is EnvPrefix + the key upper-cased with dots replaced by underscores
+type setting struct {
+	key    string
+	flag   string
+	def    string
+	usage  string
+	isBool bool
+}
+
+//settings lists every key the loader knows about. Values are resolved with this precedence,
+//lowest first: defaults, YAML config file, environment variables, command line flags
+var settings = []setting{
+	{key: "production", flag: "production", def: "true", usage: "Application is in production", isBool: true},
+	{key: "cache", flag: "cache", def: "true", usage: "Use template cache", isBool: true},
+	{key: "listen_addr", flag: "addr", def: ":8080", usage: "Address the HTTP server listens on"},
+	{key: "ops_addr", flag: "ops-addr", def: "127.0.0.1:9090", usage: "Address readiness, version and metrics are served on, keep it off the public network"},
+	{key: "public_url", flag: "public-url", def: "http://localhost:8080", usage: "Address guests reach the site at, for links in emails"},
+	{key: "shutdown_timeout", flag: "shutdown-timeout", def: "30s", usage: "How long to wait for in-flight requests and queued mail on shutdown"},
+	{key: "assets_dir", flag: "assets-dir", usage: "Read templates, email-templates and static from this directory instead of the binary, for live editing"},
+
+	{key: "database.auto_migrate", flag: "auto-migrate", def: "false", usage: "Apply pending migrations on start up", isBool: true},
+	{key: "database.dsn", flag: "dbdsn", usage: "Database connection string, overrides the other database settings"},
+	{key: "database.host", flag: "dbhost", def: "localhost", usage: "Database host"},
+	{key: "database.port", flag: "dbport", def: "5432", usage: "Database port"},
+	{key: "database.name", flag: "dbname", usage: "Database name"},
+	{key: "database.user", flag: "dbuser", usage: "Database Username"},
+	{key: "database.password", flag: "dbpass", usage: "Database password"},
+	{key: "database.sslmode", flag: "dbssl", def: "disable", usage: "Database ssl settings (disable, prefer, require)"},
+
+	{key: "smtp.host", flag: "smtphost", def: "localhost", usage: "SMTP server host"},
+	{key: "smtp.port", flag: "smtpport", def: "1025", usage: "SMTP server port"},
+	{key: "smtp.username", flag: "smtpuser", usage: "SMTP username"},
+	{key: "smtp.password", flag: "smtppass", usage: "SMTP password"},
+	{key: "smtp.from", flag: "smtpfrom", def: "me@here.com", usage: "Sender address for outgoing mail"},
+
+	{key: "session.lifetime", flag: "session-lifetime", def: "24h", usage: "Session lifetime"},
+	{key: "hold.lifetime", flag: "hold-lifetime", def: "15m", usage: "How long a chosen room is held for a guest filling in the reservation form"},
+
+	{key: "cookie.name", flag: "cookie-name", def: "session", usage: "Session cookie name"},
+	{key: "cookie.domain", flag: "cookie-domain", usage: "Session cookie domain"},
+	{key: "cookie.persist", flag: "cookie-persist", def: "true", usage: "Keep the session cookie after the browser closes", isBool: true},
+	{key: "cookie.secure", flag: "cookie-secure", usage: "Only send cookies over HTTPS (defaults to the production setting)", isBool: true},
+	{key: "cookie.samesite", flag: "cookie-samesite", def: "lax", usage: "Cookie SameSite mode (lax, strict, none)"},
+
+	{key: "tracing.exporter", flag: "trace-exporter", def: "none", usage: "Where to send traces (none, stdout, otlp)"},
+	{key: "tracing.endpoint", flag: "trace-endpoint", usage: "OTLP/HTTP collector URL, defaults to the OTEL_EXPORTER_OTLP_ENDPOINT variable or localhost:4318"},
+	{key: "ratelimit.backend", flag: "ratelimit-backend", def: "memory", usage: "Where rate limit buckets are kept (memory, postgres)"},
+	{key: "ratelimit.trusted_proxies", flag: "trusted-proxies", usage: "Comma separated proxy IPs or CIDRs whose X-Forwarded-For is believed"},
+	{key: "ratelimit.availability", flag: "ratelimit-availability", def: "20/1m", usage: "Availability searches per client, as requests/period or off"},
+	{key: "ratelimit.reservation", flag: "ratelimit-reservation", def: "5/1m", usage: "Reservations per client, as requests/period or off"},
+	{key: "ratelimit.login", flag: "ratelimit-login", def: "5/1m", usage: "Login attempts per client, as requests/period or off"},
+
+	{key: "tracing.sample_ratio", flag: "trace-sample-ratio", def: "1", usage: "Fraction of new traces to sample, between 0 and 1"},
+
+	{key: "payments.provider", flag: "payment-provider", def: "fake", usage: "Payment provider that takes deposits (fake)"},
+	{key: "payments.currency", flag: "payment-currency", def: "usd", usage: "ISO 4217 code of the currency prices are in"},
+	{key: "payments.deposit_percent", flag: "deposit-percent", def: "30", usage: "Share of the total taken as a deposit at checkout, 0 to 100"},
+	{key: "payments.webhook_secret", flag: "payment-webhook-secret", usage: "Secret the provider signs its webhooks with"},
+
+	{key: "invoice.prefix", flag: "invoice-prefix", def: "INV-", usage: "Put before the sequential number of every invoice"},
+	{key: "invoice.issuer", flag: "invoice-issuer", def: "The Fort Hotel", usage: "Business name invoices are issued by"},
+	{key: "invoice.address", flag: "invoice-address", usage: "Address printed under the issuer on invoices"},
+	{key: "invoice.tax_id", flag: "invoice-tax-id", usage: "Tax or VAT number printed on invoices"},
+}
+
+//ValidationError lists every problem found while loading the configuration
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid configuration:\n  - %s", strings.Join(e.Problems, "\n  - "))
+}
+
+//Load fills the settings of a from the config file, the environment and the command line flags in args.
+//The flags are registered on fs, so callers can use fs.Args() afterwards for positional arguments
+func Load(a *AppConfig, fs *flag.FlagSet, args []string) error {
+	return load(a, fs, args, os.LookupEnv)
+}
+
+func load(a *AppConfig, fs *flag.FlagSet, args []string, lookupEnv func(string) (string, bool)) error {
+	configFile := fs.String("config", "", "Path to a YAML config file")
+	for _, s := range settings {
+		if s.isBool {
+			fs.Bool(s.flag, s.def == "true", s.usage)
+		} else {
+			fs.String(s.flag, s.def, s.usage)
+		}
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	values := make(map[string]string)
+	for _, s := range settings {
+		if s.def != "" {
+			values[s.key] = s.def
+		}
+	}
+
+	var problems []string
+
+	//an empty -config or GOSERVER_CONFIG counts as not given
+	path, explicit := *configFile, true
+	if path == "" {
+		path, _ = lookupEnv(EnvPrefix + "CONFIG")
+	}
+	if path == "" {
+		path, explicit = DefaultConfigFile, false
+	}
+
+	fileValues, err := readFile(path, explicit)
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+	for k, v := range fileValues {
+		values[k] = v
+	}
+
+	for _, s := range settings {
+		if v, ok := lookupEnv(envName(s.key)); ok {
+			values[s.key] = v
+		}
+	}
+
+	byFlag := make(map[string]string)
+	for _, s := range settings {
+		byFlag[s.flag] = s.key
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if key, ok := byFlag[f.Name]; ok {
+			values[key] = f.Value.String()
+		}
+	})
+
+	problems = append(problems, apply(a, values)...)
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+
+	return nil
+}
+
+//envName returns the environment variable for a key, database.host becomes GOSERVER_DATABASE_HOST
+func envName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+//readFile reads a YAML file and flattens it into dotted keys. A missing file is only an error
+//when the path was given explicitly
+func readFile(path string, explicit bool) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && !explicit {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("config file: %v", err)
+	}
+
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("config file %s: %v", path, err)
+	}
+
+	values := make(map[string]string)
+	flatten("", raw, values)
+
+	known := make(map[string]bool)
+	for _, s := range settings {
+		known[s.key] = true
+	}
+
+	var unknown []string
+	for k := range values {
+		if !known[k] {
+			unknown = append(unknown, k)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return values, fmt.Errorf("config file %s: unknown keys %s", path, strings.Join(unknown, ", "))
+	}
+
+	return values, nil
+}
+
+func flatten(prefix string, in map[string]interface{}, out map[string]string) {
+	for k, v := range in {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+
+		switch x := v.(type) {
+		case map[interface{}]interface{}:
+			nested := make(map[string]interface{})
+			for nk, nv := range x {
+				nested[fmt.Sprint(nk)] = nv
+			}
+			flatten(key, nested, out)
+		case nil:
+			out[key] = ""
+		default:
+			out[key] = fmt.Sprint(x)
+		}
+	}
+}
+
+//apply converts the resolved values into a and returns every problem it finds
+func apply(a *AppConfig, values map[string]string) []string {
+	var problems []string
+
+	getBool := func(key string) bool {
+		b, err := strconv.ParseBool(values[key])
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %q is not a boolean", key, values[key]))
+		}
+		return b
+	}
+
+	getPort := func(key string) int {
+		p, err := strconv.Atoi(values[key])
+		if err != nil || p < 1 || p > 65535 {
+			problems = append(problems, fmt.Sprintf("%s: %q is not a valid port", key, values[key]))
+		}
+		return p
+	}
+
+	getRateLimit := func(key string) RateLimit {
+		v := strings.TrimSpace(values[key])
+		if v == "off" || v == "0" {
+			return RateLimit{}
+		}
+
+		parts := strings.SplitN(v, "/", 2)
+		if len(parts) == 2 {
+			n, err := strconv.Atoi(parts[0])
+			per, perr := time.ParseDuration(parts[1])
+			if err == nil && perr == nil && n > 0 && per > 0 {
+				return RateLimit{Requests: n, Per: per}
+			}
+		}
+
+		problems = append(problems, fmt.Sprintf("%s: %q must be requests/period such as 20/1m, or off", key, v))
+		return RateLimit{}
+	}
+
+	a.InProduction = getBool("production")
+	a.UseCache = getBool("cache")
+
+	a.ListenAddr = values["listen_addr"]
+	if _, _, err := net.SplitHostPort(a.ListenAddr); err != nil {
+		problems = append(problems, fmt.Sprintf("listen_addr: %q is not a host:port address", a.ListenAddr))
+	}
+
+	a.OpsAddr = values["ops_addr"]
+	if _, _, err := net.SplitHostPort(a.OpsAddr); err != nil {
+		problems = append(problems, fmt.Sprintf("ops_addr: %q is not a host:port address", a.OpsAddr))
+	} else if a.OpsAddr == a.ListenAddr {
+		problems = append(problems, "ops_addr must differ from listen_addr")
+	}
+
+	shutdownTimeout, err := time.ParseDuration(values["shutdown_timeout"])
+	if err != nil || shutdownTimeout <= 0 {
+		problems = append(problems, fmt.Sprintf("shutdown_timeout: %q is not a positive duration", values["shutdown_timeout"]))
+	}
+	a.ShutdownTimeout = shutdownTimeout
+
+	a.AssetsDir = values["assets_dir"]
+	if a.AssetsDir != "" {
+		if info, err := os.Stat(a.AssetsDir); err != nil || !info.IsDir() {
+			problems = append(problems, fmt.Sprintf("assets_dir: %q is not a directory", a.AssetsDir))
+		}
+	}
+
+	a.DB = DBConfig{
+		DSN:      values["database.dsn"],
+		Host:     values["database.host"],
+		Port:     getPort("database.port"),
+		Name:     values["database.name"],
+		User:     values["database.user"],
+		Password: values["database.password"],
+		SSLMode:  values["database.sslmode"],
+	}
+
+	a.AutoMigrate = getBool("database.auto_migrate")
+
+	if a.DB.DSN == "" {
+		if a.DB.Name == "" {
+			problems = append(problems, "database.name is required (flag -dbname, env "+envName("database.name")+")")
+		}
+		if a.DB.User == "" {
+			problems = append(problems, "database.user is required (flag -dbuser, env "+envName("database.user")+")")
+		}
+		switch a.DB.SSLMode {
+		case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+		default:
+			problems = append(problems, fmt.Sprintf("database.sslmode: %q is not a valid ssl mode", a.DB.SSLMode))
+		}
+	}
+
+	a.SMTP = SMTPConfig{
+		Host:     values["smtp.host"],
+		Port:     getPort("smtp.port"),
+		Username: values["smtp.username"],
+		Password: values["smtp.password"],
+		From:     values["smtp.from"],
+	}
+
+	if a.SMTP.Host == "" {
+		problems = append(problems, "smtp.host is required")
+	}
+
+	lifetime, err := time.ParseDuration(values["session.lifetime"])
+	if err != nil || lifetime <= 0 {
+		problems = append(problems, fmt.Sprintf("session.lifetime: %q is not a positive duration", values["session.lifetime"]))
+	}
+	a.SessionLifetime = lifetime
+
+	holdLifetime, err := time.ParseDuration(values["hold.lifetime"])
+	if err != nil || holdLifetime <= 0 {
+		problems = append(problems, fmt.Sprintf("hold.lifetime: %q is not a positive duration", values["hold.lifetime"]))
+	}
+	a.HoldLifetime = holdLifetime
+
+	a.Cookie = CookieConfig{
+		Name:     values["cookie.name"],
+		Domain:   values["cookie.domain"],
+		Persist:  getBool("cookie.persist"),
+		Secure:   a.InProduction,
+		SameSite: strings.ToLower(values["cookie.samesite"]),
+	}
+
+	if _, ok := values["cookie.secure"]; ok {
+		a.Cookie.Secure = getBool("cookie.secure")
+	}
+
+	if a.Cookie.Name == "" {
+		problems = append(problems, "cookie.name is required")
+	}
+
+	switch a.Cookie.SameSite {
+	case "lax", "strict":
+	case "none":
+		if !a.Cookie.Secure {
+			problems = append(problems, "cookie.samesite none requires cookie.secure")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("cookie.samesite: %q must be lax, strict or none", a.Cookie.SameSite))
+	}
+
+	a.Tracing = TracingConfig{
+		Exporter: strings.ToLower(values["tracing.exporter"]),
+		Endpoint: values["tracing.endpoint"],
+	}
+
+	switch a.Tracing.Exporter {
+	case "none", "stdout", "otlp":
+	default:
+		problems = append(problems, fmt.Sprintf("tracing.exporter: %q must be none, stdout or otlp", a.Tracing.Exporter))
+	}
+
+	ratio, err := strconv.ParseFloat(values["tracing.sample_ratio"], 64)
+	if err != nil || ratio < 0 || ratio > 1 {
+		problems = append(problems, fmt.Sprintf("tracing.sample_ratio: %q is not a number between 0 and 1", values["tracing.sample_ratio"]))
+	}
+	a.Tracing.SampleRatio = ratio
+
+	a.RateLimit = RateLimitConfig{
+		Backend:      strings.ToLower(values["ratelimit.backend"]),
+		Availability: getRateLimit("ratelimit.availability"),
+		Reservation:  getRateLimit("ratelimit.reservation"),
+		Login:        getRateLimit("ratelimit.login"),
+	}
+
+	switch a.RateLimit.Backend {
+	case "memory", "postgres":
+	default:
+		problems = append(problems, fmt.Sprintf("ratelimit.backend: %q must be memory or postgres", a.RateLimit.Backend))
+	}
+
+	for _, p := range strings.Split(values["ratelimit.trusted_proxies"], ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if !strings.Contains(p, "/") {
+			if strings.Contains(p, ":") {
+				p += "/128"
+			} else {
+				p += "/32"
+			}
+		}
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("ratelimit.trusted_proxies: %q is not an IP or CIDR", p))
+			continue
+		}
+		a.RateLimit.TrustedProxies = append(a.RateLimit.TrustedProxies, n)
+	}
+
+	a.Payments = PaymentsConfig{
+		Provider:      strings.ToLower(values["payments.provider"]),
+		Currency:      strings.ToLower(values["payments.currency"]),
+		WebhookSecret: values["payments.webhook_secret"],
+	}
+
+	switch a.Payments.Provider {
+	case "fake":
+	default:
+		problems = append(problems, fmt.Sprintf("payments.provider: %q must be fake", a.Payments.Provider))
+	}
+
+	if len(a.Payments.Currency) != 3 {
+		problems = append(problems, fmt.Sprintf("payments.currency: %q is not a three letter currency code", a.Payments.Currency))
+	}
+
+	deposit, err := strconv.Atoi(values["payments.deposit_percent"])
+	if err != nil || deposit < 0 || deposit > 100 {
+		problems = append(problems, fmt.Sprintf("payments.deposit_percent: %q is not a number between 0 and 100", values["payments.deposit_percent"]))
+	}
+	a.Payments.DepositPercent = deposit
+
+	a.PublicURL = strings.TrimSuffix(values["public_url"], "/")
+	if u, err := url.Parse(a.PublicURL); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		problems = append(problems, fmt.Sprintf("public_url: %q is not an http or https URL", values["public_url"]))
+	}
+
+	a.Invoice = InvoiceConfig{
+		Prefix:  values["invoice.prefix"],
+		Issuer:  values["invoice.issuer"],
+		Address: values["invoice.address"],
+		TaxID:   values["invoice.tax_id"],
+	}
+
+	return problems
+}
+
+//ConnectionString returns the DSN if one is set, otherwise it builds one from the individual settings
+func (d DBConfig) ConnectionString() string {
+	if d.DSN != "" {
+		return d.DSN
+	}
+	return fmt.Sprintf("host=%s port=%d dbname=%s user=%s password=%s sslmode=%s",
+		quoteDSN(d.Host), d.Port, quoteDSN(d.Name), quoteDSN(d.User), quoteDSN(d.Password), quoteDSN(d.SSLMode))
+}
+
+//quoteDSN quotes a connection string value so empty values and spaces are kept intact
+func quoteDSN(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	return "'" + strings.ReplaceAll(v, "'", `\'`) + "'"
+}
+
+//SameSiteMode returns the http.SameSite value for the cookie settings
+func (c CookieConfig) SameSiteMode() http.SameSite {
+	switch c.SameSite {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
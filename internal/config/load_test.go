@@ -0,0 +1,184 @@
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func envFrom(m map[string]string) func(string) (string, bool) {
+	return func(k string) (string, bool) {
+		v, ok := m[k]
+		return v, ok
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	var a AppConfig
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+
+	err := load(&a, fs, []string{"-dbname", "bookings", "-dbuser", "postgres"}, envFrom(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !a.InProduction || !a.UseCache {
+		t.Error("production and cache should default to true")
+	}
+	if a.ListenAddr != ":8080" || a.OpsAddr != "127.0.0.1:9090" {
+		t.Errorf("expected :8080 and 127.0.0.1:9090 but got %s and %s", a.ListenAddr, a.OpsAddr)
+	}
+	if a.SessionLifetime != 24*time.Hour {
+		t.Errorf("expected 24h session lifetime but got %s", a.SessionLifetime)
+	}
+	if a.HoldLifetime != 15*time.Minute {
+		t.Errorf("expected 15m hold lifetime but got %s", a.HoldLifetime)
+	}
+	if a.Payments.Provider != "fake" || a.Payments.Currency != "usd" || a.Payments.DepositPercent != 30 {
+		t.Errorf("expected the fake provider taking 30%% in usd but got %+v", a.Payments)
+	}
+	if a.PublicURL != "http://localhost:8080" || a.Invoice.Prefix != "INV-" {
+		t.Errorf("expected the local public URL and INV- invoices but got %s and %+v", a.PublicURL, a.Invoice)
+	}
+	if !a.Cookie.Secure {
+		t.Error("cookie should be secure in production")
+	}
+	if a.DB.Port != 5432 || a.SMTP.Port != 1025 {
+		t.Errorf("wrong default ports %d %d", a.DB.Port, a.SMTP.Port)
+	}
+	if a.RateLimit.Login != (RateLimit{Requests: 5, Per: time.Minute}) {
+		t.Errorf("expected a login limit of 5/1m but got %+v", a.RateLimit.Login)
+	}
+	if a.Tracing.Exporter != "none" || a.Tracing.SampleRatio != 1 {
+		t.Errorf("expected tracing off with a sample ratio of 1 but got %+v", a.Tracing)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yml")
+	yml := `
+production: false
+listen_addr: ":9000"
+database:
+  name: fromfile
+  user: fileuser
+  host: filehost
+smtp:
+  host: mail.example.com
+session:
+  lifetime: 2h
+`
+	if err := ioutil.WriteFile(path, []byte(yml), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	env := map[string]string{
+		"GOSERVER_CONFIG":        path,
+		"GOSERVER_DATABASE_HOST": "envhost",
+		"GOSERVER_LISTEN_ADDR":   ":9100",
+	}
+
+	var a AppConfig
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	err = load(&a, fs, []string{"-addr", ":9200", "migrate", "up"}, envFrom(env))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.InProduction {
+		t.Error("file should turn production off")
+	}
+	if a.Cookie.Secure {
+		t.Error("cookie should follow production when not set")
+	}
+	if a.DB.Name != "fromfile" || a.SMTP.Host != "mail.example.com" {
+		t.Error("file values were not applied")
+	}
+	if a.DB.Host != "envhost" {
+		t.Errorf("env should override file, got %s", a.DB.Host)
+	}
+	if a.ListenAddr != ":9200" {
+		t.Errorf("flag should override env, got %s", a.ListenAddr)
+	}
+	if a.SessionLifetime != 2*time.Hour {
+		t.Errorf("expected 2h but got %s", a.SessionLifetime)
+	}
+	if strings.Join(fs.Args(), " ") != "migrate up" {
+		t.Errorf("positional arguments lost, got %v", fs.Args())
+	}
+}
+
+func TestLoadListsEveryProblem(t *testing.T) {
+	var a AppConfig
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+
+	env := map[string]string{
+		"GOSERVER_SESSION_LIFETIME": "forever",
+		"GOSERVER_COOKIE_SAMESITE":  "sometimes",
+		"GOSERVER_TRACING_EXPORTER": "zipkin",
+		"GOSERVER_RATELIMIT_LOGIN":  "lots",
+		"GOSERVER_ASSETS_DIR":       "does-not-exist",
+		"GOSERVER_PUBLIC_URL":       "example.com",
+	}
+
+	err := load(&a, fs, []string{"-dbport", "abc"}, envFrom(env))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("expected *ValidationError but got %T", err)
+	}
+
+	for _, want := range []string{"database.port", "database.name", "database.user", "session.lifetime", "cookie.samesite", "tracing.exporter", "ratelimit.login", "assets_dir", "public_url"} {
+		if !strings.Contains(verr.Error(), want) {
+			t.Errorf("error does not mention %s: %s", want, verr)
+		}
+	}
+}
+
+func TestLoadMissingExplicitFile(t *testing.T) {
+	var a AppConfig
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+
+	err := load(&a, fs, []string{"-config", "does-not-exist.yml", "-dbdsn", "postgres://localhost/bookings"}, envFrom(nil))
+	if err == nil || !strings.Contains(err.Error(), "does-not-exist.yml") {
+		t.Errorf("expected missing file error, got %v", err)
+	}
+}
+
+func TestLoadEmptyConfigEnv(t *testing.T) {
+	var a AppConfig
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+
+	env := envFrom(map[string]string{"GOSERVER_CONFIG": ""})
+	err := load(&a, fs, []string{"-dbdsn", "postgres://localhost/bookings"}, env)
+	if err != nil {
+		t.Errorf("an empty GOSERVER_CONFIG should fall back to the optional %s, got %v", DefaultConfigFile, err)
+	}
+}
+
+func TestConnectionString(t *testing.T) {
+	d := DBConfig{Host: "localhost", Port: 5432, Name: "bookings", User: "me", SSLMode: "disable"}
+
+	want := "host='localhost' port=5432 dbname='bookings' user='me' password='' sslmode='disable'"
+	if d.ConnectionString() != want {
+		t.Errorf("got %s", d.ConnectionString())
+	}
+
+	d.DSN = "postgres://localhost/bookings"
+	if d.ConnectionString() != d.DSN {
+		t.Error("DSN should win over the individual settings")
+	}
+}
@@ -0,0 +1,15 @@
+//Package dates works with calendar dates, the days stays, rules and policies are counted in
+package dates
+
+import "time"
+
+//Day returns the calendar date of t as midnight UTC, so days between dates are whole
+func Day(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+//Between returns the number of days from the date of from to the date of to
+func Between(from, to time.Time) int {
+	return int(Day(to).Sub(Day(from)).Hours() / 24)
+}
@@ -0,0 +1,25 @@
+package dates
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDay(t *testing.T) {
+	loc := time.FixedZone("UTC+10", 10*60*60)
+	got := Day(time.Date(2050, time.March, 7, 23, 30, 0, 0, loc))
+	if want := time.Date(2050, time.March, 7, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("expected %v but got %v", want, got)
+	}
+}
+
+func TestBetween(t *testing.T) {
+	from := time.Date(2050, time.March, 7, 18, 0, 0, 0, time.UTC)
+	to := time.Date(2050, time.March, 10, 9, 0, 0, 0, time.UTC)
+	if got := Between(from, to); got != 3 {
+		t.Errorf("expected 3 days but got %d", got)
+	}
+	if got := Between(to, from); got != -3 {
+		t.Errorf("expected -3 days but got %d", got)
+	}
+}
@@ -1,6 +1,7 @@
 package driver
 
 import (
+	"context"
 	"database/sql"
 	"time"
 
@@ -66,3 +67,8 @@ func NewDatabase(dsn string) (*sql.DB, error) {
 
 	return db, nil
 }
+
+//Ping checks the database can be reached
+func (d *DB) Ping(ctx context.Context) error {
+	return d.SQL.PingContext(ctx)
+}
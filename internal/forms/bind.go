@@ -0,0 +1,294 @@
+package forms
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/darinmilner/goserver/internal/i18n"
+)
+
+const (
+	//maxJSONBody is the largest JSON body Bind reads, the same limit ParseForm puts on form posts
+	maxJSONBody = 10 << 20
+	//maxMultipartMemory is how much of a multipart post is kept in memory, the rest goes to disk
+	maxMultipartMemory = 32 << 20
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+//Bind decodes the form post or JSON body of r into dst, a pointer to a struct, and validates it.
+//Fields are matched by their form tag and checked with the rules in their validate tag:
+//
+//	type search struct {
+//		Start time.Time `form:"start" validate:"required,notpast"`
+//		End   time.Time `form:"end" validate:"required,after=start,nights=1:30"`
+//	}
+//
+//The rules are required, min=N and max=N for the length of text, email, phone, notpast,
+//after=field, nights=min:max (with after), range=min:max for numbers and matches=field.
+//string, int, int64, bool and time.Time fields are supported, dates posted in DateLayout.
+//
+//The returned Form holds the posted values and the field errors in the request's locale, so
+//it can be passed back to the template. The error is for a body that can't be read, or a dst
+//Decode doesn't understand
+func Bind(r *http.Request, dst interface{}) (*Form, error) {
+	values, err := requestValues(r)
+	if err != nil {
+		return nil, err
+	}
+
+	f := New(values).WithLocale(i18n.Locale(r.Context()))
+	if err := f.Decode(dst); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+//requestValues returns the posted values of r, flattening a JSON object into the same shape
+func requestValues(r *http.Request) (url.Values, error) {
+	ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch ct {
+	case "application/json":
+	case "multipart/form-data":
+		//fetch posts a FormData this way
+		if err := r.ParseMultipartForm(maxMultipartMemory); err != nil {
+			return nil, err
+		}
+		return r.Form, nil
+	default:
+		if err := r.ParseForm(); err != nil {
+			return nil, err
+		}
+		return r.Form, nil
+	}
+
+	if r.Body == nil {
+		return nil, fmt.Errorf("forms: missing JSON body")
+	}
+
+	var body map[string]interface{}
+	dec := json.NewDecoder(io.LimitReader(r.Body, maxJSONBody))
+	dec.UseNumber()
+	if err := dec.Decode(&body); err != nil {
+		return nil, fmt.Errorf("forms: reading JSON body: %w", err)
+	}
+
+	values := url.Values{}
+	for key, v := range body {
+		list, ok := v.([]interface{})
+		if !ok {
+			list = []interface{}{v}
+		}
+		for _, item := range list {
+			switch x := item.(type) {
+			case nil:
+			case string:
+				values.Add(key, x)
+			case json.Number:
+				values.Add(key, x.String())
+			case bool:
+				values.Add(key, strconv.FormatBool(x))
+			default:
+				return nil, fmt.Errorf("forms: JSON field %s is not a string, number or boolean", key)
+			}
+		}
+	}
+	return values, nil
+}
+
+//Decode sets the fields of dst, a pointer to a struct, from the form's values and runs the rules
+//in their validate tags, adding an error for every field that fails. See Bind for the tags.
+//The error is for a dst or tag Decode doesn't understand, which is a bug in the caller
+func (f *Form) Decode(dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("forms: Decode needs a pointer to a struct, not %T", dst)
+	}
+	v = v.Elem()
+
+	for i := 0; i < v.NumField(); i++ {
+		sf := v.Type().Field(i)
+		name := sf.Tag.Get("form")
+		if name == "" || name == "-" || !sf.IsExported() {
+			continue
+		}
+
+		rules, err := parseRules(sf.Tag.Get("validate"))
+		if err != nil {
+			return fmt.Errorf("forms: field %s: %w", sf.Name, err)
+		}
+
+		ok, err := f.set(v.Field(i), name, rules)
+		if err != nil {
+			return fmt.Errorf("forms: field %s: %w", sf.Name, err)
+		}
+		if ok {
+			f.check(name, rules)
+		}
+	}
+	return nil
+}
+
+//rule is one entry of a validate tag, such as max=255
+type rule struct {
+	name string
+	arg  string
+}
+
+func parseRules(tag string) ([]rule, error) {
+	var rules []rule
+	hasAfter := false
+
+	for _, part := range strings.Split(tag, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		name, arg, _ := strings.Cut(part, "=")
+		switch name {
+		case "required", "email", "phone", "notpast":
+			if arg != "" {
+				return nil, fmt.Errorf("rule %s takes no argument", name)
+			}
+		case "min", "max":
+			if _, err := strconv.Atoi(arg); err != nil {
+				return nil, fmt.Errorf("rule %s needs a number", name)
+			}
+		case "after", "matches":
+			if arg == "" {
+				return nil, fmt.Errorf("rule %s needs a field", name)
+			}
+			hasAfter = hasAfter || name == "after"
+		case "nights", "range":
+			if _, _, err := bounds(arg); err != nil {
+				return nil, fmt.Errorf("rule %s: %w", name, err)
+			}
+			if name == "nights" && !hasAfter {
+				return nil, fmt.Errorf("rule nights needs an after rule before it")
+			}
+		default:
+			return nil, fmt.Errorf("unknown rule %q", name)
+		}
+
+		rules = append(rules, rule{name: name, arg: arg})
+	}
+	return rules, nil
+}
+
+//bounds parses the min:max argument of the nights and range rules
+func bounds(arg string) (int, int, error) {
+	lo, hi, ok := strings.Cut(arg, ":")
+	min, err1 := strconv.Atoi(lo)
+	max, err2 := strconv.Atoi(hi)
+	if !ok || err1 != nil || err2 != nil {
+		return 0, 0, fmt.Errorf("expected min:max, got %q", arg)
+	}
+	return min, max, nil
+}
+
+//set converts the value posted for name into field. It reports false when the value couldn't
+//be converted, in which case the field's rules are skipped since it already has an error
+func (f *Form) set(field reflect.Value, name string, rules []rule) (bool, error) {
+	x := f.Get(name)
+
+	if field.Type() == timeType {
+		if x == "" {
+			return true, nil
+		}
+		t, ok := f.Date(name)
+		if ok {
+			field.Set(reflect.ValueOf(t))
+		}
+		return ok, nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		for _, r := range rules {
+			if r.name == "phone" {
+				x = NormalizePhone(x)
+			}
+		}
+		field.SetString(x)
+	case reflect.Int, reflect.Int64:
+		if x == "" {
+			return true, nil
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(x), 10, 64)
+		if err != nil || field.OverflowInt(n) {
+			f.Errors.Add(name, i18n.T(f.locale, "form.integer"))
+			return false, nil
+		}
+		field.SetInt(n)
+	case reflect.Bool:
+		if x == "" {
+			return true, nil
+		}
+		//a checked checkbox posts "on"
+		b, err := strconv.ParseBool(x)
+		if x == "on" {
+			b, err = true, nil
+		}
+		if err != nil {
+			f.Errors.Add(name, i18n.T(f.locale, "form.boolean"))
+			return false, nil
+		}
+		field.SetBool(b)
+	default:
+		return false, fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return true, nil
+}
+
+//check runs the rules of the field posted as name
+func (f *Form) check(name string, rules []rule) {
+	x := f.Get(name)
+	after := ""
+
+	for _, r := range rules {
+		switch r.name {
+		case "required":
+			f.Required(name)
+		case "min":
+			if x != "" {
+				n, _ := strconv.Atoi(r.arg)
+				f.MinLength(name, n)
+			}
+		case "max":
+			n, _ := strconv.Atoi(r.arg)
+			f.MaxLength(name, n)
+		case "email":
+			if x != "" {
+				f.IsEmail(name)
+			}
+		case "phone":
+			f.IsPhone(name)
+		case "notpast":
+			f.NotInPast(name)
+		case "after":
+			//an invalid start date gets its own error when its field is decoded
+			if _, err := time.Parse(DateLayout, f.Get(r.arg)); err == nil && f.EndAfterStart(r.arg, name) {
+				after = r.arg
+			}
+		case "nights":
+			if after != "" {
+				min, max, _ := bounds(r.arg)
+				f.StayLength(after, name, min, max)
+			}
+		case "range":
+			min, max, _ := bounds(r.arg)
+			f.IntRange(name, min, max)
+		case "matches":
+			f.Matches(name, r.arg)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package forms
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/darinmilner/goserver/internal/i18n"
+)
+
+type bindInput struct {
+	Start    time.Time `form:"start" validate:"required"`
+	End      time.Time `form:"end" validate:"required,after=start,nights=1:7"`
+	Guests   int       `form:"guests" validate:"range=1:4"`
+	Name     string    `form:"name" validate:"required,min=3,max=10"`
+	Email    string    `form:"email" validate:"email"`
+	Phone    string    `form:"phone" validate:"phone"`
+	Password string    `form:"password"`
+	Repeat   string    `form:"repeat" validate:"matches=password"`
+	Terms    bool      `form:"terms"`
+	Ignored  string
+}
+
+func validBindValues() url.Values {
+	return url.Values{
+		"start":    {"2050-01-01"},
+		"end":      {"2050-01-03"},
+		"guests":   {"2"},
+		"name":     {"Ali"},
+		"email":    {"ali@abc.com"},
+		"phone":    {"+1 (555) 555-0123"},
+		"password": {"secret"},
+		"repeat":   {"secret"},
+		"terms":    {"on"},
+		"Ignored":  {"x"},
+	}
+}
+
+func TestBindForm(t *testing.T) {
+	r := httptest.NewRequest("POST", "/", strings.NewReader(validBindValues().Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var in bindInput
+	form, err := Bind(r, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !form.Valid() {
+		t.Fatalf("expected a valid form, got %v", form.Errors)
+	}
+
+	if !in.Start.Equal(time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC)) || in.End.Day() != 3 {
+		t.Errorf("dates were not decoded: %v %v", in.Start, in.End)
+	}
+	if in.Guests != 2 || in.Name != "Ali" || !in.Terms || in.Ignored != "" {
+		t.Errorf("fields were not decoded: %+v", in)
+	}
+	if in.Phone != "+15555550123" {
+		t.Errorf("phone was not normalized: %s", in.Phone)
+	}
+}
+
+func TestBindJSON(t *testing.T) {
+	body := `{"start": "2050-01-01", "end": "2050-01-03", "guests": 3, "name": "Ali", "terms": true, "email": null}`
+	r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	var in bindInput
+	form, err := Bind(r, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !form.Valid() {
+		t.Fatalf("expected a valid form, got %v", form.Errors)
+	}
+	if in.Guests != 3 || !in.Terms || form.Get("guests") != "3" {
+		t.Errorf("fields were not decoded: %+v", in)
+	}
+
+	r = httptest.NewRequest("POST", "/", strings.NewReader(`{"name": {"first": "Ali"}}`))
+	r.Header.Set("Content-Type", "application/json")
+	if _, err := Bind(r, &in); err == nil {
+		t.Error("expected an error for a nested object")
+	}
+
+	r = httptest.NewRequest("POST", "/", strings.NewReader(`{"name":`))
+	r.Header.Set("Content-Type", "application/json")
+	if _, err := Bind(r, &in); err == nil {
+		t.Error("expected an error for a broken body")
+	}
+}
+
+func TestBindMultipart(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for key, values := range validBindValues() {
+		_ = mw.WriteField(key, values[0])
+	}
+	_ = mw.Close()
+
+	r := httptest.NewRequest("POST", "/", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+
+	var in bindInput
+	form, err := Bind(r, &in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !form.Valid() || in.Name != "Ali" {
+		t.Errorf("multipart post was not decoded: %+v %v", in, form.Errors)
+	}
+}
+
+func TestBindErrors(t *testing.T) {
+	tests := []struct {
+		field string
+		value string
+		key   string
+		args  []interface{}
+	}{
+		{"start", "", "form.required", nil},
+		{"start", "tomorrow", "form.date", nil},
+		{"end", "2049-12-31", "form.end_before_start", nil},
+		{"end", "2050-02-01", "form.max_stay", []interface{}{7}},
+		{"guests", "two", "form.integer", nil},
+		{"guests", "9", "form.int_range", []interface{}{1, 4}},
+		{"name", "Al", "form.min_length", []interface{}{3}},
+		{"name", "Ali Jamal Jr", "form.max_length", []interface{}{10}},
+		{"email", "ali", "form.email", nil},
+		{"phone", "555-0123", "form.phone", nil},
+		{"repeat", "Secret", "form.matches", nil},
+		{"terms", "maybe", "form.boolean", nil},
+	}
+
+	for _, tt := range tests {
+		values := validBindValues()
+		values.Set(tt.field, tt.value)
+
+		r := httptest.NewRequest("POST", "/", strings.NewReader(values.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r = r.WithContext(i18n.WithLocale(r.Context(), "es"))
+
+		var in bindInput
+		form, err := Bind(r, &in)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(form.Errors) != 1 {
+			t.Errorf("%s=%q: expected one field with an error, got %v", tt.field, tt.value, form.Errors)
+		}
+		if got, want := form.Errors.Get(tt.field), i18n.T("es", tt.key, tt.args...); got != want {
+			t.Errorf("%s=%q: expected %q but got %q", tt.field, tt.value, want, got)
+		}
+	}
+}
+
+func TestDecodeBadTargets(t *testing.T) {
+	form := New(url.Values{})
+
+	var notStruct string
+	if err := form.Decode(&notStruct); err == nil {
+		t.Error("expected an error for a pointer to a string")
+	}
+	if err := form.Decode(bindInput{}); err == nil {
+		t.Error("expected an error for a struct that isn't a pointer")
+	}
+
+	var unknown struct {
+		A string `form:"a" validate:"shiny"`
+	}
+	if err := form.Decode(&unknown); err == nil {
+		t.Error("expected an error for an unknown rule")
+	}
+
+	var nights struct {
+		A time.Time `form:"a" validate:"nights=1:2"`
+	}
+	if err := form.Decode(&nights); err == nil {
+		t.Error("expected an error for nights without after")
+	}
+
+	var unsupported struct {
+		A float64 `form:"a"`
+	}
+	if err := form.Decode(&unsupported); err == nil {
+		t.Error("expected an error for an unsupported type")
+	}
+}
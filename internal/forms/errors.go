@@ -17,3 +17,12 @@ func (e errors) Get(field string) string {
 
 	return es[0]
 }
+
+//Messages returns the first message of every field with an error, keyed by field
+func (e errors) Messages() map[string]string {
+	m := make(map[string]string, len(e))
+	for field := range e {
+		m[field] = e.Get(field)
+	}
+	return m
+}
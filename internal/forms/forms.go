@@ -3,15 +3,23 @@ package forms
 import (
 	"fmt"
 	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/asaskevich/govalidator"
+	"github.com/darinmilner/goserver/internal/i18n"
 )
 
 //Form creates a custom form struct,embeds a url.Value object
 type Form struct {
 	url.Values
 	Errors errors
+
+	locale string
 }
 
 //Valid returns true if there are no errors (valid form)
@@ -19,20 +27,41 @@ func (f *Form) Valid() bool {
 	return len(f.Errors) == 0
 }
 
+//Err returns nil for a valid form, or an error naming the fields that failed
+func (f *Form) Err() error {
+	if f.Valid() {
+		return nil
+	}
+
+	var fields []string
+	for field := range f.Errors {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fmt.Errorf("forms: invalid %s", strings.Join(fields, ", "))
+}
+
 //New initializes a form struct
 func New(data url.Values) *Form {
 	return &Form{
-		data,
-		errors(map[string][]string{}),
+		Values: data,
+		Errors: errors(map[string][]string{}),
+		locale: i18n.Default,
 	}
 }
 
+//WithLocale sets the locale the error messages are written in
+func (f *Form) WithLocale(locale string) *Form {
+	f.locale = locale
+	return f
+}
+
 //Required checks for required fields and sends a message if empty
 func (f *Form) Required(fields ...string) {
 	for _, field := range fields {
 		value := f.Get(field)
 		if strings.TrimSpace(value) == "" {
-			f.Errors.Add(field, "This field can not be empty")
+			f.Errors.Add(field, i18n.T(f.locale, "form.required"))
 		}
 	}
 }
@@ -51,7 +80,7 @@ func (f *Form) HasARequiredField(field string) bool {
 func (f *Form) MinLength(field string, length int) bool {
 	x := f.Get(field)
 	if len(x) < length {
-		f.Errors.Add(field, fmt.Sprintf("This field must be at least %d characters long", length))
+		f.Errors.Add(field, i18n.T(f.locale, "form.min_length", length))
 		return false
 	}
 
@@ -61,6 +90,157 @@ func (f *Form) MinLength(field string, length int) bool {
 //IsEmail checks for a valid email address
 func (f *Form) IsEmail(field string) {
 	if !govalidator.IsEmail(f.Get(field)) {
-		f.Errors.Add(field, "Invalid Email Address")
+		f.Errors.Add(field, i18n.T(f.locale, "form.email"))
 	}
 }
+
+//The validators below leave empty fields alone, so a field can be optional. Use Required
+//for the ones that must be filled in
+
+//DateLayout is the format date fields are posted in
+const DateLayout = "2006-01-02"
+
+//phonePattern is an E.164 number: a plus, a country code that doesn't start with 0 and at
+//most 15 digits in all
+var phonePattern = regexp.MustCompile(`^\+[1-9]\d{1,14}$`)
+
+//now is the clock NotInPast compares against, replaced in tests
+var now = time.Now
+
+//MaxLength checks that a field is at most length characters long
+func (f *Form) MaxLength(field string, length int) bool {
+	if utf8.RuneCountInString(f.Get(field)) > length {
+		f.Errors.Add(field, i18n.T(f.locale, "form.max_length", length))
+		return false
+	}
+	return true
+}
+
+//Date parses a field in DateLayout. The second result is false when the field is empty
+//or isn't a date
+func (f *Form) Date(field string) (time.Time, bool) {
+	x := f.Get(field)
+	if x == "" {
+		return time.Time{}, false
+	}
+
+	t, err := time.Parse(DateLayout, x)
+	if err != nil {
+		f.Errors.Add(field, i18n.T(f.locale, "form.date"))
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+//dates parses the start and end of a date range, reporting only whether both are dates
+//since Date already added the errors
+func (f *Form) dates(start, end string) (time.Time, time.Time, bool) {
+	s, okStart := f.Date(start)
+	e, okEnd := f.Date(end)
+	return s, e, okStart && okEnd
+}
+
+//EndAfterStart checks that the date in end is after the date in start
+func (f *Form) EndAfterStart(start, end string) bool {
+	s, e, ok := f.dates(start, end)
+	if !ok {
+		return true
+	}
+
+	if !e.After(s) {
+		f.Errors.Add(end, i18n.T(f.locale, "form.end_before_start"))
+		return false
+	}
+	return true
+}
+
+//StayLength checks that there are between min and max nights from start to end. A max of 0
+//means there is no upper limit
+func (f *Form) StayLength(start, end string, min, max int) bool {
+	s, e, ok := f.dates(start, end)
+	if !ok {
+		return true
+	}
+
+	nights := int(e.Sub(s).Hours() / 24)
+	switch {
+	case nights < min:
+		f.Errors.Add(end, i18n.T(f.locale, "form.min_stay", min))
+		return false
+	case max > 0 && nights > max:
+		f.Errors.Add(end, i18n.T(f.locale, "form.max_stay", max))
+		return false
+	}
+	return true
+}
+
+//NotInPast checks that the date in a field is today or later
+func (f *Form) NotInPast(field string) bool {
+	t, ok := f.Date(field)
+	if !ok {
+		return true
+	}
+
+	y, m, d := now().Date()
+	if t.Before(time.Date(y, m, d, 0, 0, 0, 0, time.UTC)) {
+		f.Errors.Add(field, i18n.T(f.locale, "form.past"))
+		return false
+	}
+	return true
+}
+
+//IsPhone checks for an E.164 phone number such as +15555550123. Spaces, dashes, dots and
+//brackets are allowed between the digits, see NormalizePhone
+func (f *Form) IsPhone(field string) bool {
+	x := f.Get(field)
+	if x == "" {
+		return true
+	}
+
+	if !phonePattern.MatchString(NormalizePhone(x)) {
+		f.Errors.Add(field, i18n.T(f.locale, "form.phone"))
+		return false
+	}
+	return true
+}
+
+//NormalizePhone strips the spaces, dashes, dots and brackets people type in phone numbers,
+//so +1 (555) 555-0123 is stored as +15555550123
+func NormalizePhone(phone string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '.', '(', ')':
+			return -1
+		}
+		return r
+	}, phone)
+}
+
+//IntRange parses a field as a whole number and checks that it is between min and max
+func (f *Form) IntRange(field string, min, max int) (int, bool) {
+	x := f.Get(field)
+	if x == "" {
+		return 0, false
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(x))
+	if err != nil {
+		f.Errors.Add(field, i18n.T(f.locale, "form.integer"))
+		return 0, false
+	}
+	if n < min || n > max {
+		f.Errors.Add(field, i18n.T(f.locale, "form.int_range", min, max))
+		return n, false
+	}
+	return n, true
+}
+
+//Matches checks that a field has the same value as other, such as a repeated password.
+//Unlike the others it checks empty fields too, so an empty field only matches an empty other
+func (f *Form) Matches(field, other string) bool {
+	if f.Get(field) != f.Get(other) {
+		f.Errors.Add(field, i18n.T(f.locale, "form.matches"))
+		return false
+	}
+	return true
+}
@@ -5,6 +5,7 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 )
 
 func TestFormValid(t *testing.T) {
@@ -150,3 +151,129 @@ func TestIsEmail(t *testing.T) {
 	}
 
 }
+
+func TestForm_WithLocale(t *testing.T) {
+	form := New(url.Values{})
+	form.Required("a")
+	if form.Errors.Get("a") != "This field can not be empty" {
+		t.Errorf("expected the English message but got %q", form.Errors.Get("a"))
+	}
+
+	form = New(url.Values{}).WithLocale("es")
+	form.Required("a")
+	if form.Errors.Get("a") != "Este campo no puede estar vacío" {
+		t.Errorf("expected the Spanish message but got %q", form.Errors.Get("a"))
+	}
+}
+
+func TestFormMaxLength(t *testing.T) {
+	form := New(url.Values{"name": {"Añadir"}})
+	if !form.MaxLength("name", 6) {
+		t.Error("length should count characters, not bytes")
+	}
+	if form.MaxLength("name", 5) {
+		t.Error("expected the field to be too long")
+	}
+	if form.Errors.Get("name") != "This field must be at most 5 characters long" {
+		t.Errorf("got %q", form.Errors.Get("name"))
+	}
+}
+
+func TestFormDate(t *testing.T) {
+	form := New(url.Values{"good": {"2050-01-02"}, "bad": {"01/02/2050"}})
+
+	d, ok := form.Date("good")
+	if !ok || !d.Equal(time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("got %v %v", d, ok)
+	}
+	if _, ok := form.Date("bad"); ok || form.Errors.Get("bad") == "" {
+		t.Error("expected an error for a date in the wrong format")
+	}
+	if _, ok := form.Date("missing"); ok || form.Errors.Get("missing") != "" {
+		t.Error("an empty field is left to Required")
+	}
+}
+
+func TestFormDateRanges(t *testing.T) {
+	now = func() time.Time { return time.Date(2050, 1, 10, 15, 0, 0, 0, time.Local) }
+	defer func() { now = time.Now }()
+
+	tests := []struct {
+		name       string
+		start, end string
+		min, max   int
+		want       string
+	}{
+		{"valid", "2050-01-10", "2050-01-12", 1, 7, ""},
+		{"end before start", "2050-01-12", "2050-01-11", 1, 7, "end"},
+		{"same day", "2050-01-12", "2050-01-12", 1, 7, "end"},
+		{"in the past", "2050-01-09", "2050-01-12", 1, 7, "start"},
+		{"too short", "2050-01-12", "2050-01-13", 2, 7, "end"},
+		{"too long", "2050-01-12", "2050-01-20", 1, 7, "end"},
+		{"no upper limit", "2050-01-12", "2051-01-20", 1, 0, ""},
+		{"not a date", "soon", "2050-01-20", 1, 7, "start"},
+	}
+
+	for _, tt := range tests {
+		form := New(url.Values{"start": {tt.start}, "end": {tt.end}})
+		form.NotInPast("start")
+		if form.EndAfterStart("start", "end") {
+			form.StayLength("start", "end", tt.min, tt.max)
+		}
+
+		for _, field := range []string{"start", "end"} {
+			if got := form.Errors.Get(field) != ""; got != (field == tt.want) {
+				t.Errorf("%s: error on %s is %q", tt.name, field, form.Errors.Get(field))
+			}
+		}
+	}
+}
+
+func TestFormIsPhone(t *testing.T) {
+	tests := map[string]bool{
+		"+15555550123":      true,
+		"+1 (555) 555-0123": true,
+		"+34 612.345.678":   true,
+		"":                  true,
+		"5555550123":        false,
+		"+05555550123":      false,
+		"+1555555012345678": false,
+		"call me":           false,
+	}
+
+	for phone, want := range tests {
+		form := New(url.Values{"phone": {phone}})
+		if got := form.IsPhone("phone"); got != want {
+			t.Errorf("IsPhone(%q) = %v, want %v", phone, got, want)
+		}
+	}
+
+	if got := NormalizePhone("+1 (555) 555-0123"); got != "+15555550123" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestFormIntRange(t *testing.T) {
+	form := New(url.Values{"good": {"3"}, "big": {"30"}, "word": {"three"}})
+
+	if n, ok := form.IntRange("good", 1, 10); !ok || n != 3 {
+		t.Errorf("got %d %v", n, ok)
+	}
+	if _, ok := form.IntRange("big", 1, 10); ok || form.Errors.Get("big") != "This field must be between 1 and 10" {
+		t.Errorf("got %q", form.Errors.Get("big"))
+	}
+	if _, ok := form.IntRange("word", 1, 10); ok || form.Errors.Get("word") == "" {
+		t.Error("expected an error for a value that isn't a number")
+	}
+}
+
+func TestFormMatches(t *testing.T) {
+	form := New(url.Values{"password": {"secret"}, "same": {"secret"}, "other": {"Secret"}})
+
+	if !form.Matches("same", "password") {
+		t.Error("expected equal fields to match")
+	}
+	if form.Matches("other", "password") || form.Matches("missing", "password") {
+		t.Error("expected different fields not to match")
+	}
+}
@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/darinmilner/goserver/internal/cancellation"
+	"github.com/darinmilner/goserver/internal/forms"
+	"github.com/darinmilner/goserver/internal/helpers"
+	"github.com/darinmilner/goserver/internal/i18n"
+	"github.com/darinmilner/goserver/internal/logging"
+	"github.com/darinmilner/goserver/internal/metrics"
+	"github.com/darinmilner/goserver/internal/models"
+	"github.com/darinmilner/goserver/internal/payments"
+	"github.com/darinmilner/goserver/internal/render"
+	"github.com/darinmilner/goserver/internal/repository"
+	"github.com/go-chi/chi"
+	"go.opentelemetry.io/otel/trace"
+)
+
+//AdminCancelReservation cancels a reservation under its room type's policy. The room's dates
+//are freed, what the policy gives back of the guest's payments is refunded and the guest and
+//owner are told
+func (m *Repository) AdminCancelReservation(w http.ResponseWriter, r *http.Request) error {
+	var input adminCancelInput
+	form, err := forms.Bind(r, &input)
+	if err != nil {
+		return helpers.WithStatus(http.StatusBadRequest, err)
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		return helpers.WithStatus(http.StatusNotFound, err)
+	}
+	src := chi.URLParam(r, "src")
+
+	res, err := m.DB.GetReservationByID(r.Context(), id)
+	if err != nil {
+		return err
+	}
+	if res.Cancelled() {
+		m.App.Session.Put(r.Context(), "error", translate(r, "flash.already_cancelled"))
+		redirectAfterAdmin(w, r, src, input.Year, input.Month)
+		return nil
+	}
+
+	view, err := m.adminReservationView(r, res, src, input.Year, input.Month)
+	if err != nil {
+		return err
+	}
+
+	if !form.Valid() {
+		return render.Template(w, r, "admin.reservations.show.page.html", &models.TemplateData{
+			View: view,
+			Form: form,
+		})
+	}
+
+	c := models.Cancellation{
+		ReservationID: id,
+		Reason:        input.Reason,
+		Actor:         cancellation.ActorOwner,
+		UserID:        m.App.Session.GetInt(r.Context(), "userId"),
+		Penalty:       view.Cancel.Penalty,
+		Refund:        view.Cancel.Refund,
+	}
+	unrefunded, err := m.cancel(r, res, view.Payments, c)
+	if errors.Is(err, repository.ErrAlreadyCancelled) {
+		m.App.Session.Put(r.Context(), "error", translate(r, "flash.already_cancelled"))
+		redirectAfterAdmin(w, r, src, input.Year, input.Month)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	locale := i18n.Locale(r.Context())
+	if unrefunded > 0 {
+		m.App.Session.Put(r.Context(), "error", translate(r, "flash.refund_failed", render.Money(locale, unrefunded)))
+	} else {
+		m.App.Session.Put(r.Context(), "flash", translate(r, "flash.cancelled", render.Money(locale, c.Refund)))
+	}
+	redirectAfterAdmin(w, r, src, input.Year, input.Month)
+	return nil
+}
+
+//MyCancelReservation lets a guest cancel their reservation from their own page, under the same
+//policy and with the same refund as the owner would
+func (m *Repository) MyCancelReservation(w http.ResponseWriter, r *http.Request) error {
+	var input myCancelInput
+	form, err := forms.Bind(r, &input)
+	if err != nil {
+		return helpers.WithStatus(http.StatusBadRequest, err)
+	}
+
+	res, err := m.reservationByToken(r)
+	if err != nil {
+		return err
+	}
+	page := "/my-reservation/" + url.PathEscape(res.AccessToken)
+
+	view, records, err := m.myReservationView(r, res)
+	if err != nil {
+		return err
+	}
+	if res.Cancelled() {
+		m.App.Session.Put(r.Context(), "error", translate(r, "flash.already_cancelled"))
+		http.Redirect(w, r, page, http.StatusSeeOther)
+		return nil
+	}
+	if !view.Cancellable() {
+		m.App.Session.Put(r.Context(), "error", translate(r, "flash.too_late_to_cancel"))
+		http.Redirect(w, r, page, http.StatusSeeOther)
+		return nil
+	}
+
+	if !form.Valid() {
+		return render.Template(w, r, "my-reservation.page.html", &models.TemplateData{
+			View: view,
+			Form: form,
+		})
+	}
+
+	c := models.Cancellation{
+		ReservationID: res.ID,
+		Reason:        input.Reason,
+		Actor:         cancellation.ActorGuest,
+		Penalty:       view.Cancel.Penalty,
+		Refund:        view.Cancel.Refund,
+	}
+	unrefunded, err := m.cancel(r, res, records, c)
+	if errors.Is(err, repository.ErrAlreadyCancelled) {
+		m.App.Session.Put(r.Context(), "error", translate(r, "flash.already_cancelled"))
+		http.Redirect(w, r, page, http.StatusSeeOther)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	locale := i18n.Locale(r.Context())
+	if unrefunded > 0 {
+		m.App.Session.Put(r.Context(), "error", translate(r, "flash.guest_refund_failed", render.Money(locale, unrefunded)))
+	} else {
+		m.App.Session.Put(r.Context(), "flash", translate(r, "flash.cancelled", render.Money(locale, c.Refund)))
+	}
+	http.Redirect(w, r, page, http.StatusSeeOther)
+	return nil
+}
+
+//adminReservationView returns the admin page for res, with its payments and what cancelling
+//it now would come to, or its cancellation once cancelled
+func (m *Repository) adminReservationView(r *http.Request, res models.Reservation, src, year, month string) (models.AdminReservationView, error) {
+	view := models.AdminReservationView{
+		Reservation: res,
+		Src:         src,
+		Year:        year,
+		Month:       month,
+	}
+
+	records, err := m.DB.PaymentsForReservation(r.Context(), res.ID)
+	if err != nil {
+		return view, err
+	}
+	view.Payments = records
+	view.Paid = payments.Paid(records)
+	view.Balance = res.Total - view.Paid
+
+	view.Invoice, err = m.DB.GetInvoiceByReservationID(r.Context(), res.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return view, err
+	}
+
+	if res.Cancelled() {
+		view.Cancellation, err = m.DB.GetCancellationByReservationID(r.Context(), res.ID)
+		return view, err
+	}
+
+	view.Policy, view.Cancel, err = m.cancelTerms(r, res, view.Paid)
+	return view, err
+}
+
+//cancelTerms returns the cancellation policy of res's room type and what cancelling it now
+//would come to, paid having been paid
+func (m *Repository) cancelTerms(r *http.Request, res models.Reservation, paid int64) (models.CancellationPolicy, cancellation.Outcome, error) {
+	policy, err := m.DB.GetCancellationPolicyByID(r.Context(), res.RoomType.CancellationPolicyID)
+	if err != nil {
+		return policy, cancellation.Outcome{}, err
+	}
+	return policy, cancellation.Calculate(policy.Policy(), res.Total, paid, res.StartDate, time.Now()), nil
+}
+
+//cancel records the cancellation c of res, refunds what it gives back of the payments in
+//records and tells the guest and owner. It returns what couldn't be refunded, and
+//repository.ErrAlreadyCancelled when res was cancelled meanwhile
+func (m *Repository) cancel(r *http.Request, res models.Reservation, records []models.Payment, c models.Cancellation) (int64, error) {
+	err := m.DB.CancelReservation(r.Context(), c)
+	if err != nil {
+		return 0, err
+	}
+
+	metrics.ReservationsCancelled.Inc()
+
+	//the cancellation stands once recorded, a refund the provider turns down is left to the
+	//owner rather than undoing it
+	unrefunded := m.refundPaid(r, res.ID, records, c.Refund)
+
+	m.notifyCancelled(r, res, c)
+	return unrefunded, nil
+}
+
+//refundPaid gives back amount of a reservation's succeeded charges, oldest first, and records
+//the refunds. It returns what couldn't be refunded, the failures being logged
+func (m *Repository) refundPaid(r *http.Request, reservationID int, records []models.Payment, amount int64) int64 {
+	for _, p := range records {
+		if amount <= 0 {
+			break
+		}
+		if p.Kind != payments.KindCharge || p.Status != payments.StatusSucceeded {
+			continue
+		}
+
+		left := payments.Refundable(records, p)
+		if left == 0 {
+			continue
+		}
+
+		refund, err := m.Payments.Refund(r.Context(), p.Reference, min(amount, left))
+		if err != nil {
+			logging.FromContext(r.Context()).Error("refunding cancelled reservation", slog.Int("reservation_id", reservationID),
+				slog.String("reference", p.Reference), slog.Any("error", err))
+			continue
+		}
+		amount -= refund.Amount
+
+		_, err = m.DB.InsertPayment(r.Context(), models.Payment{
+			ReservationID: reservationID,
+			Provider:      m.Payments.Name(),
+			Reference:     refund.ID,
+			Kind:          payments.KindRefund,
+			Charge:        p.Reference,
+			Amount:        refund.Amount,
+			Currency:      p.Currency,
+			Status:        refund.Status,
+		})
+		if err != nil {
+			logging.FromContext(r.Context()).Error("recording refund", slog.Int("reservation_id", reservationID),
+				slog.String("reference", refund.ID), slog.Any("error", err))
+		}
+	}
+	return amount
+}
+
+//notifyCancelled mails the guest, in the language they booked in, and the owner about a
+//cancellation
+func (m *Repository) notifyCancelled(r *http.Request, res models.Reservation, c models.Cancellation) {
+	m.App.MailChan <- models.MailData{
+		To:      res.Email,
+		From:    m.App.SMTP.From,
+		Subject: i18n.T(res.Locale, "email.cancellation.subject"),
+		Content: i18n.T(res.Locale, "email.cancellation.body", html.EscapeString(res.FirstName),
+			i18n.FormatDate(res.Locale, res.StartDate), i18n.FormatDate(res.Locale, res.EndDate),
+			render.Money(res.Locale, c.Refund)),
+		Template: "basic.html",
+		Locale:   res.Locale,
+
+		SpanContext: trace.SpanContextFromContext(r.Context()),
+	}
+
+	//the owner reads mail in the default locale
+	m.App.MailChan <- models.MailData{
+		To:      "owner@property.com",
+		From:    m.App.SMTP.From,
+		Subject: i18n.T(i18n.Default, "email.cancellation.subject"),
+		Content: i18n.T(i18n.Default, "email.cancellation.owner", html.EscapeString(res.FirstName), html.EscapeString(res.LastName),
+			i18n.FormatDate(i18n.Default, res.StartDate), i18n.FormatDate(i18n.Default, res.EndDate), res.Room.RoomName,
+			c.Actor, html.EscapeString(c.Reason), render.Money(i18n.Default, c.Penalty), render.Money(i18n.Default, c.Refund)),
+		Template: "basic.html",
+
+		SpanContext: trace.SpanContextFromContext(r.Context()),
+	}
+}
+
+//redirectAfterAdmin sends the admin back to the list a reservation was opened from, or to
+//the calendar month
+func redirectAfterAdmin(w http.ResponseWriter, r *http.Request, src, year, month string) {
+	if year == "" {
+		http.Redirect(w, r, fmt.Sprintf("/admin/%s-reservations", src), http.StatusSeeOther)
+	} else {
+		http.Redirect(w, r, fmt.Sprintf("/admin/calendar?y=%s&m=%s", year, month), http.StatusSeeOther)
+	}
+}
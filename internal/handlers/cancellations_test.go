@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/darinmilner/goserver/internal/helpers"
+	"github.com/darinmilner/goserver/internal/payments"
+	"github.com/go-chi/chi"
+)
+
+func TestAdminCancelReservation(t *testing.T) {
+	//the test repository's reservations were paid with fake_pi_1, 3000 of which 1000 was
+	//refunded, so the first cancellation gets 2000 back and the second finds too little left
+	fake := payments.NewFake("test")
+	intent, _ := fake.CreateIntent(context.Background(), 3000, "usd", "")
+	if _, err := fake.Capture(context.Background(), intent.ID, payments.FakeCard); err != nil {
+		t.Fatal(err)
+	}
+	provider := Repo.Payments
+	Repo.Payments = fake
+	defer func() { Repo.Payments = provider }()
+
+	tests := []struct {
+		name             string
+		id               string
+		reason           string
+		year             string
+		expectedCode     int
+		expectedLocation string
+		expectedSession  string
+	}{
+		{"refunded", "1", "Change of plans", "", http.StatusSeeOther, "/admin/new-reservations", "flash"},
+		{"refund failed", "1", "Change of plans", "2040", http.StatusSeeOther, "/admin/calendar?y=2040&m=01", "error"},
+		{"no reason", "1", "", "", http.StatusOK, "", ""},
+		{"already cancelled", "7", "Change of plans", "", http.StatusSeeOther, "/admin/new-reservations", "error"},
+		{"cancelled meanwhile", "2", "Change of plans", "", http.StatusSeeOther, "/admin/new-reservations", "error"},
+		{"cancel fails", "3", "Change of plans", "", http.StatusInternalServerError, "", ""},
+		{"no reservation", "8", "Change of plans", "", http.StatusInternalServerError, "", ""},
+		{"bad id", "x", "Change of plans", "", http.StatusNotFound, "", ""},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("reason", e.reason)
+		postedData.Add("year", e.year)
+		postedData.Add("month", "01")
+
+		req, _ := http.NewRequest("POST", "/admin/reservations/new/"+e.id+"/cancel", strings.NewReader(postedData.Encode()))
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("src", "new")
+		rctx.URLParams.Add("id", e.id)
+		ctx := context.WithValue(getCtx(req), chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		helpers.Handler(Repo.AdminCancelReservation).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode || rr.Header().Get("Location") != e.expectedLocation {
+			t.Errorf("%s: got %d to %q, wanted %d to %q", e.name, rr.Code, rr.Header().Get("Location"), e.expectedCode, e.expectedLocation)
+		}
+		if e.expectedSession != "" && session.GetString(ctx, e.expectedSession) == "" {
+			t.Errorf("%s: expected a message in %s", e.name, e.expectedSession)
+		}
+	}
+}
+
+func TestMyCancelReservation(t *testing.T) {
+	//as for the owner, the first cancellation gets 2000 of fake_pi_1 back and the second finds
+	//too little left
+	fake := payments.NewFake("test")
+	intent, _ := fake.CreateIntent(context.Background(), 3000, "usd", "")
+	if _, err := fake.Capture(context.Background(), intent.ID, payments.FakeCard); err != nil {
+		t.Fatal(err)
+	}
+	provider := Repo.Payments
+	Repo.Payments = fake
+	defer func() { Repo.Payments = provider }()
+
+	tests := []struct {
+		name             string
+		token            string
+		reason           string
+		expectedCode     int
+		expectedLocation string
+		expectedSession  string
+	}{
+		{"refunded", "5L3t0k3n", "", http.StatusSeeOther, "/my-reservation/5L3t0k3n", "flash"},
+		{"refund failed", "5L3t0k3n", "Change of plans", http.StatusSeeOther, "/my-reservation/5L3t0k3n", "error"},
+		{"reason too long", "5L3t0k3n", strings.Repeat("x", 1001), http.StatusOK, "", ""},
+		{"already cancelled", "cancelled", "", http.StatusSeeOther, "/my-reservation/cancelled", "error"},
+		{"arrived", "arrived", "", http.StatusSeeOther, "/my-reservation/arrived", "error"},
+		{"cancelled meanwhile", "uninvoiced", "", http.StatusSeeOther, "/my-reservation/uninvoiced", "error"},
+		{"unknown token", "unknown", "", http.StatusNotFound, "", ""},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("reason", e.reason)
+
+		req, _ := http.NewRequest("POST", "/my-reservation/"+e.token+"/cancel", strings.NewReader(postedData.Encode()))
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("token", e.token)
+		ctx := context.WithValue(getCtx(req), chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		helpers.Handler(Repo.MyCancelReservation).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode || rr.Header().Get("Location") != e.expectedLocation {
+			t.Errorf("%s: got %d to %q, wanted %d to %q", e.name, rr.Code, rr.Header().Get("Location"), e.expectedCode, e.expectedLocation)
+		}
+		if e.expectedSession != "" && session.GetString(ctx, e.expectedSession) == "" {
+			t.Errorf("%s: expected a message in %s", e.name, e.expectedSession)
+		}
+	}
+}
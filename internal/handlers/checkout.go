@@ -0,0 +1,351 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/darinmilner/goserver/internal/forms"
+	"github.com/darinmilner/goserver/internal/i18n"
+	"github.com/darinmilner/goserver/internal/logging"
+	"github.com/darinmilner/goserver/internal/metrics"
+	"github.com/darinmilner/goserver/internal/models"
+	"github.com/darinmilner/goserver/internal/payments"
+	"github.com/darinmilner/goserver/internal/pricing"
+	"github.com/darinmilner/goserver/internal/render"
+	"github.com/darinmilner/goserver/internal/repository"
+	"github.com/darinmilner/goserver/internal/security"
+	"go.opentelemetry.io/otel/trace"
+)
+
+//maxWebhookBytes is the largest webhook body read, provider events are a few hundred bytes
+const maxWebhookBytes = 64 << 10
+
+//paymentClaimTTL is how long a checkout has to take a hold's payment before another try may
+const paymentClaimTTL = 2 * time.Minute
+
+//Checkout shows the reservation with its deposit and asks for the card to pay it with. The
+//guest's room stays held until they pay
+func (m *Repository) Checkout(w http.ResponseWriter, r *http.Request) error {
+	res, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
+	if !ok || res.RoomID == 0 || res.FirstName == "" {
+		m.App.Session.Put(r.Context(), "error", translate(r, "flash.no_reservation"))
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return nil
+	}
+	if res.ID != 0 {
+		//already booked, the summary hasn't been seen yet
+		http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
+		return nil
+	}
+	if booked, err := m.showBookedHold(w, r, res); booked || err != nil {
+		return err
+	}
+
+	held, err := m.renewHold(r, &res)
+	if err != nil {
+		return err
+	}
+	if !held {
+		m.App.Session.Put(r.Context(), "error", translate(r, "flash.hold_lost"))
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return nil
+	}
+	m.App.Session.Put(r.Context(), "reservation", res)
+
+	view := m.checkoutView(res)
+
+	return render.Template(w, r, "checkout.page.html", &models.TemplateData{
+		Form: forms.New(nil),
+		View: view,
+	})
+}
+
+//PostCheckout takes the deposit and makes the reservation. The payment is refunded when the
+//reservation can't be saved after all
+func (m *Repository) PostCheckout(w http.ResponseWriter, r *http.Request) error {
+	var input checkoutInput
+	form, err := forms.Bind(r, &input)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", translate(r, "flash.bad_form"))
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return nil
+	}
+
+	reservation, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
+	if !ok || reservation.RoomID == 0 || reservation.FirstName == "" {
+		m.App.Session.Put(r.Context(), "error", translate(r, "flash.no_reservation"))
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return nil
+	}
+	if reservation.ID != 0 {
+		//already booked, the summary hasn't been seen yet
+		http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
+		return nil
+	}
+	//the form sent again after the first one booked the hold, whose session was overwritten
+	if booked, err := m.showBookedHold(w, r, reservation); booked || err != nil {
+		return err
+	}
+
+	held, err := m.renewHold(r, &reservation)
+	if err != nil {
+		return err
+	}
+	if !held {
+		m.App.Session.Put(r.Context(), "error", translate(r, "flash.hold_lost"))
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return nil
+	}
+	m.App.Session.Put(r.Context(), "reservation", reservation)
+
+	view := m.checkoutView(reservation)
+
+	if reservation.Deposit > 0 && input.PaymentMethod == "" {
+		form.Errors.Add("payment-method", translate(r, "form.required"))
+	}
+	if !form.Valid() {
+		return render.Template(w, r, "checkout.page.html", &models.TemplateData{
+			Form: form,
+			View: view,
+		})
+	}
+
+	holdID := m.App.Session.GetInt(r.Context(), "hold_id")
+
+	var payment models.Payment
+	if reservation.Deposit > 0 {
+		//one checkout at a time takes the hold's payment, so the form sent twice waits for the
+		//first rather than paying too
+		intentID, err := m.DB.ClaimHoldPayment(r.Context(), holdID, paymentClaimTTL)
+		switch {
+		case errors.Is(err, repository.ErrHoldPaying):
+			m.App.Session.Put(r.Context(), "error", translate(r, "flash.payment_in_progress"))
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return nil
+		case errors.Is(err, repository.ErrHoldExpired):
+			if booked, err := m.showBookedHold(w, r, reservation); booked || err != nil {
+				return err
+			}
+			m.App.Session.Remove(r.Context(), "hold_id")
+			m.App.Session.Put(r.Context(), "error", translate(r, "flash.hold_lost"))
+			http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+			return nil
+		case err != nil:
+			return err
+		}
+
+		//a hold is paid with one intent. An earlier try left its intent on the hold, capturing it
+		//again takes nothing more if that try went through after all
+		if intentID == "" {
+			intent, err := m.Payments.CreateIntent(r.Context(), reservation.Deposit, m.App.Payments.Currency, fmt.Sprintf("hold %d", holdID))
+			if err == nil {
+				intentID = intent.ID
+				err = m.DB.SetHoldPaymentIntent(r.Context(), holdID, intentID)
+			}
+			if err != nil {
+				if uerr := m.DB.UnclaimHoldPayment(r.Context(), holdID, intentID); uerr != nil {
+					logging.FromContext(r.Context()).Error("unclaiming hold", slog.Int("hold_id", holdID), slog.Any("error", uerr))
+				}
+				return err
+			}
+		}
+
+		intent, err := m.Payments.Capture(r.Context(), intentID, input.PaymentMethod)
+		if err != nil {
+			//the intent stays on the hold for the next try, and is given back by the hold sweeper
+			//if the guest leaves
+			if err := m.DB.UnclaimHoldPayment(r.Context(), holdID, intentID); err != nil {
+				return err
+			}
+
+			message := "checkout.declined"
+			if !errors.Is(err, payments.ErrDeclined) {
+				logging.FromContext(r.Context()).Error("capturing deposit", slog.String("reference", intentID), slog.Any("error", err))
+				message = "checkout.unconfirmed"
+			}
+			form.Errors.Add("payment-method", translate(r, message))
+			return render.Template(w, r, "checkout.page.html", &models.TemplateData{
+				Form: form,
+				View: view,
+			})
+		}
+
+		payment = models.Payment{
+			Provider:  m.Payments.Name(),
+			Reference: intent.ID,
+			Kind:      payments.KindCharge,
+			Amount:    intent.Amount,
+			Currency:  intent.Currency,
+			Status:    intent.Status,
+		}
+	}
+
+	//the reservation and its room are saved together, so a guest who paid either has both or
+	//gets the money back
+	reservation.AccessToken = security.NewToken()
+	newReservationID, err := m.DB.BookReservation(r.Context(), reservation, holdID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("booking reservation", slog.Any("error", err))
+		if payment.Reference != "" {
+			//a payment that couldn't be given back is left on the hold for the sweeper
+			left := ""
+			if m.refund(r, payment) != nil {
+				left = payment.Reference
+			}
+			if err := m.DB.UnclaimHoldPayment(r.Context(), holdID, left); err != nil {
+				logging.FromContext(r.Context()).Error("unclaiming hold", slog.Int("hold_id", holdID), slog.Any("error", err))
+			}
+		}
+		if errors.Is(err, repository.ErrHoldExpired) {
+			m.App.Session.Remove(r.Context(), "hold_id")
+			m.App.Session.Put(r.Context(), "error", translate(r, "flash.hold_lost"))
+			http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+			return nil
+		}
+		m.App.Session.Put(r.Context(), "error", translate(r, "flash.save_failed"))
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return nil
+	}
+	reservation.ID = newReservationID
+
+	//the hold is the reservation's restriction now, there is nothing left to release
+	m.App.Session.Remove(r.Context(), "hold_id")
+	m.App.Session.Put(r.Context(), "reservation", reservation)
+
+	metrics.ReservationsCreated.Inc()
+
+	//the money was taken, so failing to record it is logged with the reference to look it up
+	//by rather than turning the guest away
+	if payment.Reference != "" {
+		payment.ReservationID = newReservationID
+		if _, err := m.DB.InsertPayment(r.Context(), payment); err != nil {
+			logging.FromContext(r.Context()).Error("recording payment", slog.Int("reservation_id", newReservationID),
+				slog.String("reference", payment.Reference), slog.Any("error", err))
+		}
+	}
+
+	//SEND Notification
+	//First to guest
+
+	htmlMessage := i18n.T(reservation.Locale, "email.confirmation.body", html.EscapeString(reservation.FirstName),
+		i18n.FormatDate(reservation.Locale, reservation.StartDate), i18n.FormatDate(reservation.Locale, reservation.EndDate),
+		m.App.PublicURL+"/my-reservation/"+reservation.AccessToken)
+
+	msg := models.MailData{
+		To:       reservation.Email,
+		From:     m.App.SMTP.From,
+		Subject:  i18n.T(reservation.Locale, "email.confirmation.subject"),
+		Content:  htmlMessage,
+		Template: "basic.html",
+		Locale:   reservation.Locale,
+
+		SpanContext: trace.SpanContextFromContext(r.Context()),
+	}
+
+	m.App.MailChan <- msg
+
+	//Email to property owner
+	//the owner reads mail in the default locale
+	htmlMessageToOwner := i18n.T(i18n.Default, "email.confirmation.owner", html.EscapeString(reservation.FirstName), html.EscapeString(reservation.LastName),
+		i18n.FormatDate(i18n.Default, reservation.StartDate), i18n.FormatDate(i18n.Default, reservation.EndDate), reservation.Room.RoomName,
+		itemize(i18n.Default, view.Quote))
+
+	msgToOwner := models.MailData{
+		To:       "owner@property.com",
+		From:     m.App.SMTP.From,
+		Subject:  i18n.T(i18n.Default, "email.confirmation.subject"),
+		Content:  htmlMessageToOwner,
+		Template: "basic.html",
+
+		SpanContext: trace.SpanContextFromContext(r.Context()),
+	}
+
+	m.App.MailChan <- msgToOwner
+
+	//direct users to a new page after post
+	http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
+
+	return nil
+}
+
+//PaymentWebhook takes the provider's events about charges and refunds and updates their
+//records. An event for a payment not recorded yet gets a 404 so the provider sends it again
+func (m *Repository) PaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBytes))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	event, err := m.Payments.VerifyWebhook(payload, r.Header)
+	if err != nil {
+		logging.FromContext(r.Context()).Warn("rejected payment webhook", slog.Any("error", err))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	status := event.Status()
+	if status == "" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	err = m.DB.UpdatePaymentStatus(r.Context(), m.Payments.Name(), event.Reference, status)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		w.WriteHeader(http.StatusNotFound)
+	case err != nil:
+		logging.FromContext(r.Context()).Error("updating payment", slog.String("reference", event.Reference), slog.Any("error", err))
+		w.WriteHeader(http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+//checkoutView returns the checkout page for res, priced at the quote its total was taken from
+func (m *Repository) checkoutView(res models.Reservation) models.CheckoutView {
+	return models.CheckoutView{
+		Reservation: res,
+		Quote:       res.Quote,
+		Balance:     res.Total - res.Deposit,
+		TestMode:    m.Payments.Name() == "fake",
+	}
+}
+
+//itemize returns the lines and taxes of q as HTML for an email in locale
+func itemize(locale string, q pricing.Quote) string {
+	var b strings.Builder
+	for _, l := range q.Lines {
+		fmt.Fprintf(&b, "%s &times; %s: %s<br>", i18n.T(locale, l.Key, l.Quantity),
+			render.Money(locale, l.Unit), render.Money(locale, l.Amount))
+	}
+	for _, t := range q.Taxes {
+		name := html.EscapeString(t.Name)
+		if t.Inclusive {
+			name = i18n.T(locale, "quote.includes", name)
+		}
+		fmt.Fprintf(&b, "%s: %s<br>", name, render.Money(locale, t.Amount))
+	}
+	fmt.Fprintf(&b, "<strong>%s: %s</strong>", i18n.T(locale, "quote.total"), render.Money(locale, q.Total))
+	return b.String()
+}
+
+//refund gives back a payment taken for a reservation that couldn't be made. Failing is
+//logged, with the reference, since the guest can't do anything about it
+func (m *Repository) refund(r *http.Request, p models.Payment) error {
+	if p.Reference == "" {
+		return nil
+	}
+	_, err := m.Payments.Refund(r.Context(), p.Reference, p.Amount)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("refunding payment", slog.String("reference", p.Reference), slog.Any("error", err))
+	}
+	return err
+}
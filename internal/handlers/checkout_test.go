@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/darinmilner/goserver/internal/helpers"
+	"github.com/darinmilner/goserver/internal/i18n"
+	"github.com/darinmilner/goserver/internal/models"
+	"github.com/darinmilner/goserver/internal/payments"
+	"github.com/darinmilner/goserver/internal/pricing"
+)
+
+//checkoutReservation is a reservation ready to pay for, as PostReservation leaves it in the
+//session with hold 1 on its room
+func checkoutReservation() models.Reservation {
+	return models.Reservation{
+		FirstName:  "Ali",
+		LastName:   "Jamal",
+		Email:      "aJamal@abc.com",
+		StartDate:  time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:    time.Date(2040, 1, 3, 0, 0, 0, 0, time.UTC),
+		RoomTypeID: 1,
+		RoomType:   models.RoomType{ID: 1, Name: "General's Quarters", MaxOccupancy: 2, IncludedGuests: 2, NightlyRate: 10000},
+		RoomID:     1,
+		Room:       models.Room{ID: 1, RoomName: "General's Quarters 1", RoomTypeID: 1},
+		Adults:     1,
+		Total:      20000,
+		Deposit:    6000,
+		Quote: pricing.Quote{
+			Lines: []pricing.Line{{Key: "quote.room", Quantity: 2, Unit: 10000, Amount: 20000}},
+			Total: 20000,
+		},
+	}
+}
+
+func TestCheckout(t *testing.T) {
+	booked := checkoutReservation()
+	booked.ID = 5
+
+	//the tax rules of 2048 can't be read, the page shows the quote the total was taken from
+	quoted := checkoutReservation()
+	quoted.StartDate = time.Date(2048, 1, 1, 0, 0, 0, 0, time.UTC)
+	quoted.EndDate = time.Date(2048, 1, 3, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name             string
+		reservation      *models.Reservation
+		holdID           int
+		expectedCode     int
+		expectedLocation string
+	}{
+		{"ready to pay", ptr(checkoutReservation()), 1, http.StatusOK, ""},
+		{"no reservation", nil, 1, http.StatusSeeOther, "/"},
+		{"already booked", &booked, 1, http.StatusSeeOther, "/reservation-summary"},
+		{"hold booked by another tab", ptr(checkoutReservation()), 8, http.StatusSeeOther, "/reservation-summary"},
+		{"priced as quoted", &quoted, 1, http.StatusOK, ""},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/checkout", nil)
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		rr := httptest.NewRecorder()
+
+		if e.reservation != nil {
+			session.Put(ctx, "reservation", *e.reservation)
+			session.Put(ctx, "hold_id", e.holdID)
+		}
+
+		helpers.Handler(Repo.Checkout).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode || rr.Header().Get("Location") != e.expectedLocation {
+			t.Errorf("%s: got %d to %q", e.name, rr.Code, rr.Header().Get("Location"))
+		}
+	}
+}
+
+func TestPostCheckout(t *testing.T) {
+	insertFails := checkoutReservation()
+	insertFails.RoomID = 2
+
+	restrictionFails := checkoutReservation()
+	restrictionFails.RoomID = 200_000
+
+	holdRanOut := checkoutReservation()
+	holdRanOut.RoomID = 300_000
+
+	noDeposit := checkoutReservation()
+	noDeposit.Deposit = 0
+
+	holdLost := checkoutReservation()
+	holdLost.StartDate = time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC)
+	holdLost.EndDate = time.Date(2050, 1, 3, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name             string
+		reservation      *models.Reservation
+		holdID           int
+		method           string
+		expectedCode     int
+		expectedLocation string
+	}{
+		{"paid", ptr(checkoutReservation()), 1, payments.FakeCard, http.StatusSeeOther, "/reservation-summary"},
+		{"declined", ptr(checkoutReservation()), 1, payments.FakeDeclined, http.StatusOK, ""},
+		{"no card", ptr(checkoutReservation()), 1, "", http.StatusOK, ""},
+		{"no deposit", &noDeposit, 1, "", http.StatusSeeOther, "/reservation-summary"},
+		{"no reservation", nil, 1, payments.FakeCard, http.StatusSeeOther, "/"},
+		{"hold lost", &holdLost, 2, payments.FakeCard, http.StatusSeeOther, "/search-availability"},
+		{"already paying", ptr(checkoutReservation()), 4, payments.FakeCard, http.StatusSeeOther, "/"},
+		{"sent again after booking", ptr(checkoutReservation()), 8, payments.FakeCard, http.StatusSeeOther, "/reservation-summary"},
+		{"capture unconfirmed", ptr(checkoutReservation()), 6, payments.FakeCard, http.StatusOK, ""},
+		{"insert fails", &insertFails, 1, payments.FakeCard, http.StatusSeeOther, "/"},
+		{"restriction fails", &restrictionFails, 1, payments.FakeCard, http.StatusSeeOther, "/"},
+		{"hold ran out while paying", &holdRanOut, 1, payments.FakeCard, http.StatusSeeOther, "/search-availability"},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("payment-method", e.method)
+
+		req, _ := http.NewRequest("POST", "/checkout", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		if e.reservation != nil {
+			session.Put(ctx, "reservation", *e.reservation)
+		}
+		session.Put(ctx, "hold_id", e.holdID)
+
+		helpers.Handler(Repo.PostCheckout).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode || rr.Header().Get("Location") != e.expectedLocation {
+			t.Errorf("%s: got %d to %q, wanted %d to %q", e.name, rr.Code, rr.Header().Get("Location"), e.expectedCode, e.expectedLocation)
+		}
+
+		if e.expectedLocation == "/reservation-summary" {
+			res, _ := session.Get(ctx, "reservation").(models.Reservation)
+			if res.ID != 1 || session.GetInt(ctx, "hold_id") != 0 {
+				t.Errorf("%s: expected reservation 1 with its hold released, got %d", e.name, res.ID)
+			}
+			if len(res.AccessToken) != 32 {
+				t.Errorf("%s: expected a guest access token, got %q", e.name, res.AccessToken)
+			}
+		}
+	}
+}
+
+func TestPostCheckoutRefunds(t *testing.T) {
+	insertFails := checkoutReservation()
+	insertFails.RoomID = 2
+
+	restrictionFails := checkoutReservation()
+	restrictionFails.RoomID = 200_000
+
+	tests := []struct {
+		name        string
+		reservation models.Reservation
+	}{
+		{"insert fails", insertFails},
+		{"restriction fails", restrictionFails},
+	}
+
+	for _, e := range tests {
+		fake := payments.NewFake("test")
+		provider := Repo.Payments
+		Repo.Payments = fake
+
+		postedData := url.Values{}
+		postedData.Add("payment-method", payments.FakeCard)
+
+		req, _ := http.NewRequest("POST", "/checkout", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		session.Put(ctx, "reservation", e.reservation)
+		session.Put(ctx, "hold_id", 1)
+
+		helpers.Handler(Repo.PostCheckout).ServeHTTP(rr, req)
+		Repo.Payments = provider
+
+		//the fake's first intent is the deposit
+		if got := fake.Refunded("fake_pi_1"); got != e.reservation.Deposit {
+			t.Errorf("%s: expected the deposit of %d refunded but got %d", e.name, e.reservation.Deposit, got)
+		}
+		if session.GetString(ctx, "error") == "" {
+			t.Errorf("%s: expected the guest to be told", e.name)
+		}
+	}
+}
+
+func TestPostCheckoutReusesIntent(t *testing.T) {
+	fake := payments.NewFake("test")
+	provider := Repo.Payments
+	Repo.Payments = fake
+	defer func() { Repo.Payments = provider }()
+
+	postedData := url.Values{}
+	postedData.Add("payment-method", payments.FakeCard)
+
+	req, _ := http.NewRequest("POST", "/checkout", strings.NewReader(postedData.Encode()))
+	ctx := getCtx(req)
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+
+	//hold 6 was left with an intent by an earlier try, one the provider doesn't know
+	session.Put(ctx, "reservation", checkoutReservation())
+	session.Put(ctx, "hold_id", 6)
+
+	helpers.Handler(Repo.PostCheckout).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the checkout page again but got %d", rr.Code)
+	}
+	if !strings.Contains(html.UnescapeString(rr.Body.String()), i18n.T(i18n.Default, "checkout.unconfirmed")) {
+		t.Error("expected the guest to be told the payment couldn't be confirmed")
+	}
+	//a new intent would have been the fake's first
+	if _, err := fake.Capture(context.Background(), "fake_pi_1", payments.FakeCard); err == nil {
+		t.Error("expected the hold's intent to be captured again rather than a new one made")
+	}
+}
+
+func TestPaymentWebhook(t *testing.T) {
+	fake := Repo.Payments.(*payments.Fake)
+
+	tests := []struct {
+		name         string
+		payload      string
+		signature    string
+		expectedCode int
+	}{
+		{"payment succeeded", `{"type":"payment.succeeded","reference":"fake_pi_1","amount":6000}`, "", http.StatusNoContent},
+		{"refund failed", `{"type":"refund.failed","reference":"fake_re_2","amount":6000}`, "", http.StatusNoContent},
+		{"unknown event", `{"type":"payment.created","reference":"fake_pi_1"}`, "", http.StatusNoContent},
+		{"not recorded yet", `{"type":"payment.succeeded","reference":"unknown"}`, "", http.StatusNotFound},
+		{"bad signature", `{"type":"payment.succeeded","reference":"fake_pi_1"}`, "00", http.StatusBadRequest},
+		{"no reference", `{"type":"payment.succeeded"}`, "", http.StatusBadRequest},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/payments/webhook", bytes.NewBufferString(e.payload))
+		sig := e.signature
+		if sig == "" {
+			sig = fake.Sign([]byte(e.payload))
+		}
+		req.Header.Set(payments.FakeSignatureHeader, sig)
+		rr := httptest.NewRecorder()
+
+		http.HandlerFunc(Repo.PaymentWebhook).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected %d but got %d", e.name, e.expectedCode, rr.Code)
+		}
+	}
+}
+
+func TestItemize(t *testing.T) {
+	q := pricing.Quote{
+		Lines: []pricing.Line{{Key: "quote.room", Quantity: 2, Unit: 10000, Amount: 20000}},
+		Taxes: []pricing.TaxLine{{Name: "Tourist <tax>", Amount: 800}, {Name: "VAT", Amount: 1818, Inclusive: true}},
+		Total: 20800,
+	}
+
+	got := itemize("en", q)
+	for _, want := range []string{"Room, 2 nights &times; $100.00: $200.00", "Tourist &lt;tax&gt;: $8.00", "Includes VAT: $18.18", "Total: $208.00"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in %q", want, got)
+		}
+	}
+}
+
+func ptr(res models.Reservation) *models.Reservation {
+	return &res
+}
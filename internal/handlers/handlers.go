@@ -1,10 +1,13 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -13,10 +16,16 @@ import (
 	"github.com/darinmilner/goserver/internal/driver"
 	"github.com/darinmilner/goserver/internal/forms"
 	"github.com/darinmilner/goserver/internal/helpers"
+	"github.com/darinmilner/goserver/internal/i18n"
+	"github.com/darinmilner/goserver/internal/logging"
+	"github.com/darinmilner/goserver/internal/metrics"
 	"github.com/darinmilner/goserver/internal/models"
+	"github.com/darinmilner/goserver/internal/payments"
+	"github.com/darinmilner/goserver/internal/pricing"
 	"github.com/darinmilner/goserver/internal/render"
 	"github.com/darinmilner/goserver/internal/repository"
 	"github.com/darinmilner/goserver/internal/repository/dbrepo"
+	"github.com/darinmilner/goserver/internal/stayrules"
 	"github.com/go-chi/chi"
 )
 
@@ -25,23 +34,30 @@ var Repo *Repository
 
 //Repository is the repository type struct
 type Repository struct {
-	App *config.AppConfig
-	DB  repository.DatabaseRepo
+	App      *config.AppConfig
+	DB       repository.DatabaseRepo
+	Payments payments.Provider
 }
 
-//NewRepo creates a new repository
-func NewRepo(a *config.AppConfig, db *driver.DB) *Repository {
-	return &Repository{
-		App: a,
-		DB:  dbrepo.NewPostgresRepo(db.SQL, a),
+//NewRepo creates a new repository, it fails when the payment provider can't be used
+func NewRepo(a *config.AppConfig, db *driver.DB) (*Repository, error) {
+	provider, err := payments.New(a.Payments, a.InProduction)
+	if err != nil {
+		return nil, err
 	}
+	return &Repository{
+		App:      a,
+		DB:       dbrepo.NewPostgresRepo(db.SQL, a),
+		Payments: provider,
+	}, nil
 }
 
 //NewTestRepo creates a new test repository
 func NewTestRepo(a *config.AppConfig) *Repository {
 	return &Repository{
-		App: a,
-		DB:  dbrepo.NewTestingRepo(a),
+		App:      a,
+		DB:       dbrepo.NewTestingRepo(a),
+		Payments: payments.NewFake("test"),
 	}
 }
 
@@ -51,285 +67,271 @@ func NewHandlers(r *Repository) {
 }
 
 //Home page function
-func (m *Repository) Home(w http.ResponseWriter, r *http.Request) {
+func (m *Repository) Home(w http.ResponseWriter, r *http.Request) error {
 
-	render.Template(w, r, "home.page.html", &models.TemplateData{})
+	return render.Template(w, r, "home.page.html", &models.TemplateData{})
 }
 
 //Reservation route handler
-func (m *Repository) Reservation(w http.ResponseWriter, r *http.Request) {
+func (m *Repository) Reservation(w http.ResponseWriter, r *http.Request) error {
 
 	//Pull reservation out of the session
 	res, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
 	if !ok {
-		//helpers.ServerError(w, errors.New("can not get reservation from session."))
-		m.App.Session.Put(r.Context(), "error", "can't get reservation from session")
+		//helpers.ServerError(w, r, errors.New("can not get reservation from session."))
+		m.App.Session.Put(r.Context(), "error", translate(r, "flash.no_reservation"))
 		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
+		return nil
 	}
 
-	room, err := m.DB.GetRoomByID(res.RoomID)
+	roomType, err := m.DB.GetRoomTypeByID(r.Context(), res.RoomTypeID)
 
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't find a room")
+		m.App.Session.Put(r.Context(), "error", translate(r, "flash.no_room"))
 		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
+		return nil
 	}
 
-	res.Room.RoomName = room.RoomName
+	res.RoomType = roomType
+	res.Adults, res.Children = party(res.Adults, res.Children)
 
-	m.App.Session.Put(r.Context(), "reservation", res)
-
-	sd := res.StartDate.Format("2006-01-02")
-	ed := res.EndDate.Format("2006-01-02")
+	held, err := m.renewHold(r, &res)
+	if err != nil {
+		return err
+	}
+	if !held {
+		m.App.Session.Put(r.Context(), "error", translate(r, "flash.no_rooms"))
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return nil
+	}
 
-	stringMap := make(map[string]string)
-	stringMap["start-date"] = sd
-	stringMap["end-date"] = ed
+	m.App.Session.Put(r.Context(), "reservation", res)
 
-	data := make(map[string]interface{})
-	data["reservation"] = res
+	quote, err := m.quote(r.Context(), roomType, res.Stay())
+	if err != nil {
+		return err
+	}
 
-	render.Template(w, r, "make-reservation.page.html", &models.TemplateData{
-		Form:      forms.New(nil),
-		Data:      data,
-		StringMap: stringMap,
+	return render.Template(w, r, "make-reservation.page.html", &models.TemplateData{
+		Form: forms.New(nil),
+		View: models.ReservationView{
+			Reservation: res,
+			Quote:       quote,
+			HoldSeconds: int(m.App.HoldLifetime.Seconds()),
+		},
 	})
 }
 
 //PostReservation handles posting of reservation form
-func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
-
+func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) error {
+	var input reservationInput
+	form, err := forms.Bind(r, &input)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't parse form")
+		m.App.Session.Put(r.Context(), "error", translate(r, "flash.bad_form"))
 		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
+		return nil
 	}
 
-	sd := r.Form.Get("start-date")
-	ed := r.Form.Get("end-date")
-
-	layout := "2006-01-02"
-	startDate, err := time.Parse(layout, sd)
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't parse start date")
+	//the page can't be shown again without its room type
+	roomType, err := m.DB.GetRoomTypeByID(r.Context(), input.RoomTypeID)
+	if err != nil || form.Errors.Get("room-type-id") != "" {
+		m.App.Session.Put(r.Context(), "error", translate(r, "flash.bad_room"))
 		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
+		return nil
 	}
-	endDate, err := time.Parse(layout, ed)
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't parse end date")
-		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
+
+	reservation := models.Reservation{
+		FirstName: input.FirstName,
+		LastName:  input.LastName,
+		Phone:     input.Phone,
+		Email:     input.Email,
+		StartDate: input.StartDate,
+		EndDate:   input.EndDate,
+		Locale:    i18n.Locale(r.Context()),
+
+		RoomTypeID: roomType.ID,
+		RoomType:   roomType,
 	}
+	reservation.Adults, reservation.Children = party(input.Adults, input.Children)
 
-	roomID, err := strconv.Atoi(r.Form.Get("room-id"))
-	log.Print(roomID)
+	if form.Errors.Get("adults") == "" && form.Errors.Get("children") == "" &&
+		reservation.Adults+reservation.Children > roomType.MaxOccupancy {
+		form.Errors.Add("adults", translate(r, "form.max_occupancy", roomType.MaxOccupancy))
+	}
 
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't get room id")
-		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
+	if form.Errors.Get("start-date") == "" && form.Errors.Get("end-date") == "" {
+		rules, err := m.DB.StayRulesForDates(r.Context(), reservation.StartDate, reservation.EndDate)
+		if err != nil {
+			return err
+		}
+		if v := stayrules.Check(rules, roomType.ID, reservation.StartDate, reservation.EndDate, time.Now()); v != nil {
+			form.Errors.Add(violationField(v, "start-date", "end-date"), explain(r, v))
+		}
 	}
 
-	room, err := m.DB.GetRoomByID(roomID)
+	quote, err := m.quote(r.Context(), roomType, reservation.Stay())
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't get room id")
-		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
-	}
-	reservation := models.Reservation{
-		FirstName: r.Form.Get("first-name"),
-		LastName:  r.Form.Get("last-name"),
-		Phone:     r.Form.Get("phone"),
-		Email:     r.Form.Get("email"),
-		StartDate: startDate,
-		EndDate:   endDate,
-		RoomID:    roomID,
-		Room:      room,
+		return err
 	}
-
-	form := forms.New(r.PostForm)
-
-	form.HasARequiredField("first-name")
-
-	form.Required("first-name", "last-name", "email")
-
-	form.MinLength("first-name", 3)
-
-	form.IsEmail("email")
+	reservation.Total = quote.Total
+	reservation.Quote = quote
 
 	if !form.Valid() {
-		data := make(map[string]interface{})
-		data["reservation"] = reservation
-		render.Template(w, r, "make-reservation.page.html", &models.TemplateData{
+		return render.Template(w, r, "make-reservation.page.html", &models.TemplateData{
 			Form: form,
-			Data: data,
+			View: models.ReservationView{Reservation: reservation, Quote: quote, HoldSeconds: int(m.App.HoldLifetime.Seconds())},
 		})
-		return
-	}
-
-	newReservationID, err := m.DB.InsertReservation(reservation)
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't insert data into the database")
-		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
 	}
 
-	//SEND Notification
-	//First to guest
-
-	htmlMessage := fmt.Sprintf(`
-		<strong>Reservation Confirmation</strong><br>
-		Dear %s, <br>
-		This email is to confirm your reservation from %s to %s.
-	`, reservation.FirstName, reservation.StartDate.Format("2006-01-02"), reservation.EndDate.Format("2006-01-02"))
-
-	msg := models.MailData{
-		To:       reservation.Email,
-		From:     "me@here.com",
-		Subject:  "Reservation Confirmation",
-		Content:  htmlMessage,
-		Template: "basic.html",
-	}
-
-	m.App.MailChan <- msg
-
-	//Email to property owner
-	htmlMessageToOwner := fmt.Sprintf(`
-		<strong>Reservation Confirmation</strong> <br>
-		Dear Owner, <br>
-		This email is to confirm that %s %s has booked a reservation from %s to %s for room %s.
-	`, reservation.FirstName, reservation.LastName, reservation.StartDate.Format("2006-01-02"), reservation.EndDate.Format("2006-01-02"), reservation.Room.RoomName)
-
-	msgToOwner := models.MailData{
-		To:       "owner@property.com",
-		From:     "me@here.com",
-		Subject:  "Reservation Confirmation",
-		Content:  htmlMessageToOwner,
-		Template: "basic.html",
+	//the guest keeps the room held for them while they filled in the form, unless they changed
+	//the stay or the hold ran out, then they get a new hold on a room of the type if one is free
+	held, _ := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
+	holdID := m.App.Session.GetInt(r.Context(), "hold_id")
+	if holdID != 0 && held.RoomID != 0 && held.RoomTypeID == roomType.ID &&
+		held.StartDate.Equal(reservation.StartDate) && held.EndDate.Equal(reservation.EndDate) &&
+		m.DB.ExtendHold(r.Context(), holdID, m.App.HoldLifetime) == nil {
+		reservation.RoomID = held.RoomID
+		reservation.Room = held.Room
+	} else {
+		ok, err := m.holdRoom(r, &reservation)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			m.App.Session.Put(r.Context(), "error", translate(r, "flash.no_rooms"))
+			http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+			return nil
+		}
 	}
 
-	m.App.MailChan <- msgToOwner
-
+	reservation.Deposit = payments.Deposit(reservation.Total, m.App.Payments.DepositPercent)
 	m.App.Session.Put(r.Context(), "reservation", reservation)
-	restriction := models.RoomRestriction{
-		StartDate:     reservation.StartDate,
-		EndDate:       reservation.EndDate,
-		RoomID:        reservation.RoomID,
-		ReservationID: newReservationID,
-		RestrictionID: 1,
-	}
 
-	err = m.DB.InsertRoomRestriction(restriction)
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't insert room restriction")
-		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
-	}
-	m.App.Session.Put(r.Context(), "reservation", reservation)
+	//the reservation is only made once the deposit is paid
+	http.Redirect(w, r, "/checkout", http.StatusSeeOther)
 
-	log.Println("Room reservation", reservation)
-	//direct users to a new page after post
-	http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
+	return nil
 }
 
 //Generals room route
-func (m *Repository) Generals(w http.ResponseWriter, r *http.Request) {
+func (m *Repository) Generals(w http.ResponseWriter, r *http.Request) error {
 
-	render.Template(w, r, "generals.page.html", &models.TemplateData{})
+	return render.Template(w, r, "generals.page.html", &models.TemplateData{})
 }
 
 //Majors room route
-func (m *Repository) Majors(w http.ResponseWriter, r *http.Request) {
+func (m *Repository) Majors(w http.ResponseWriter, r *http.Request) error {
 
-	render.Template(w, r, "majors.page.html", &models.TemplateData{})
+	return render.Template(w, r, "majors.page.html", &models.TemplateData{})
 }
 
 //Availability renders the search availability page
-func (m *Repository) Availability(w http.ResponseWriter, r *http.Request) {
+func (m *Repository) Availability(w http.ResponseWriter, r *http.Request) error {
 
-	render.Template(w, r, "search-availability.page.html", &models.TemplateData{})
+	return render.Template(w, r, "search-availability.page.html", &models.TemplateData{
+		Form: forms.New(nil),
+	})
 }
 
 //PostAvailability posts the availabilty form
-func (m *Repository) PostAvailability(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
-
+func (m *Repository) PostAvailability(w http.ResponseWriter, r *http.Request) error {
+	var input searchInput
+	form, err := forms.Bind(r, &input)
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't parse form date")
+		m.App.Session.Put(r.Context(), "error", translate(r, "flash.bad_form"))
 		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
+		return nil
 	}
 
-	start := r.Form.Get("start")
-	end := r.Form.Get("end")
-
-	//convert from string to time.Time
-	//2021-01-01 --date format 01/02 03:04:05PM '06 -0700
-	layout := "2006-01-02"
-	startDate, err := time.Parse(layout, start)
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't parse form")
-		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
+	if !form.Valid() {
+		return render.Template(w, r, "search-availability.page.html", &models.TemplateData{
+			Form: form,
+		})
 	}
 
-	endDate, err := time.Parse(layout, end)
-	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "can't parse end date")
-		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
-	}
+	//a guest searching again is done with the room they had chosen
+	m.releaseHold(r)
 
-	rooms, err := m.DB.SearchAvailabilityForAllRooms(startDate, endDate)
+	startDate, endDate := input.Start, input.End
+	adults, children := party(input.Adults, input.Children)
 
-	if err != nil {
-		helpers.ServerError(w, err)
-		return
-	}
+	types, err := m.DB.SearchAvailabilityForAllRooms(r.Context(), startDate, endDate, adults+children)
 
-	for _, i := range rooms {
-		m.App.InfoLog.Println("Room: ", i.ID, i.RoomName)
+	if err != nil {
+		return err
 	}
 
-	if len(rooms) == 0 {
+	if len(types) == 0 {
 		//No Availability
-		m.App.InfoLog.Println("No Rooms available")
-		m.App.Session.Put(r.Context(), "error", "No Rooms are available")
+		logging.FromContext(r.Context()).Info("no rooms available", slog.String("start", form.Get("start")), slog.String("end", form.Get("end")))
+		m.App.Session.Put(r.Context(), "error", translate(r, "flash.no_rooms"))
 		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
-		return
+		return nil
 	}
 
-	data := make(map[string]interface{})
+	rules, err := m.DB.StayRulesForDates(r.Context(), startDate, endDate)
+	if err != nil {
+		return err
+	}
+	taxRules, err := m.DB.TaxRulesForDates(r.Context(), startDate, endDate)
+	if err != nil {
+		return err
+	}
 
 	res := models.Reservation{
 		StartDate: startDate,
 		EndDate:   endDate,
+		Adults:    adults,
+		Children:  children,
+	}
+
+	//types whose stay rules the dates break aren't offered, and when that leaves none the
+	//guest is told the first rule broken
+	var view models.ChooseRoomView
+	var violation *stayrules.Violation
+	for _, t := range types {
+		if v := stayrules.Check(rules, t.RoomType.ID, startDate, endDate, time.Now()); v != nil {
+			if violation == nil {
+				violation = v
+			}
+			continue
+		}
+		view.Choices = append(view.Choices, models.RoomChoice{
+			RoomType: t.RoomType,
+			Free:     t.Free,
+			Quote:    pricing.Calculate(t.RoomType.Rate(), res.Stay(), taxes(taxRules, t.RoomType.ID)...),
+		})
+	}
+
+	if len(view.Choices) == 0 {
+		form.Errors.Add(violationField(violation, "start", "end"), explain(r, violation))
+		return render.Template(w, r, "search-availability.page.html", &models.TemplateData{
+			Form: form,
+		})
 	}
 
 	m.App.Session.Put(r.Context(), "reservation", res)
 
-	data["rooms"] = rooms
-	render.Template(w, r, "choose-room.page.html", &models.TemplateData{
-		Data: data,
+	return render.Template(w, r, "choose-room.page.html", &models.TemplateData{
+		View: view,
 	})
 	//w.Write([]byte(fmt.Sprintf("Start date is %s and end date is %s", start, end)))
 }
 
 type jsonResponse struct {
-	OK        bool   `json:"ok"`
-	Message   string `json:"message"`
-	RoomID    string `json:"roomId"`
-	StartDate string `json:"startDate"`
-	EndDate   string `json:"endDate"`
+	OK         bool              `json:"ok"`
+	Message    string            `json:"message"`
+	RoomTypeID string            `json:"roomTypeId"`
+	StartDate  string            `json:"startDate"`
+	EndDate    string            `json:"endDate"`
+	Errors     map[string]string `json:"errors,omitempty"`
 }
 
 //AvailabilityJSON handles request for availability and returns JSON
 func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
 
-	err := r.ParseForm()
+	var input roomAvailabilityInput
+	form, err := forms.Bind(r, &input)
 	if err != nil {
 		resp := jsonResponse{
 			OK:      false,
@@ -341,21 +343,83 @@ func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sd := r.Form.Get("start")
-	ed := r.Form.Get("end")
+	sd := form.Get("start")
+	ed := form.Get("end")
 
-	layout := "2006-01-02"
+	if !form.Valid() {
+		resp := jsonResponse{
+			OK:        false,
+			Message:   translate(r, "flash.bad_form"),
+			StartDate: sd,
+			EndDate:   ed,
+			Errors:    form.Errors.Messages(),
+		}
+		out, _ := json.MarshalIndent(resp, "", "\t")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(out)
+		return
+	}
 
-	startDate, _ := time.Parse(layout, sd)
-	endDate, _ := time.Parse(layout, ed)
-	roomId, _ := strconv.Atoi(r.Form.Get("room-id"))
+	roomTypeID := input.RoomTypeID
+
+	roomType, err := m.DB.GetRoomTypeByID(r.Context(), roomTypeID)
+	if err != nil {
+		resp := jsonResponse{
+			OK:      false,
+			Message: "Error querying database",
+		}
+		out, _ := json.MarshalIndent(resp, "", "\t")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(out)
+		return
+	}
+
+	adults, children := party(input.Adults, input.Children)
+	if adults+children > roomType.MaxOccupancy {
+		resp := jsonResponse{
+			OK:         false,
+			Message:    translate(r, "form.max_occupancy", roomType.MaxOccupancy),
+			StartDate:  sd,
+			EndDate:    ed,
+			RoomTypeID: strconv.Itoa(roomTypeID),
+		}
+		out, _ := json.MarshalIndent(resp, "", "\t")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(out)
+		return
+	}
+
+	rules, err := m.DB.StayRulesForDates(r.Context(), input.Start, input.End)
+	if err != nil {
+		resp := jsonResponse{
+			OK:      false,
+			Message: "Error querying database",
+		}
+		out, _ := json.MarshalIndent(resp, "", "\t")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(out)
+		return
+	}
+	if v := stayrules.Check(rules, roomTypeID, input.Start, input.End, time.Now()); v != nil {
+		resp := jsonResponse{
+			OK:         false,
+			Message:    explain(r, v),
+			StartDate:  sd,
+			EndDate:    ed,
+			RoomTypeID: strconv.Itoa(roomTypeID),
+		}
+		out, _ := json.MarshalIndent(resp, "", "\t")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(out)
+		return
+	}
 
-	available, _ := m.DB.SearchAvailabilityByDatesByRoomID(startDate, endDate, roomId)
+	rooms, err := m.DB.FreeRoomsOfType(r.Context(), roomTypeID, input.Start, input.End)
 
 	if err != nil {
 		resp := jsonResponse{
 			OK:      false,
-			Message: "Error connecting to Database",
+			Message: "Error querying database",
 		}
 		out, _ := json.MarshalIndent(resp, "", "\t")
 		w.Header().Set("Content-Type", "application/json")
@@ -363,11 +427,11 @@ func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	resp := jsonResponse{
-		OK:        available,
-		Message:   "",
-		StartDate: sd,
-		EndDate:   ed,
-		RoomID:    strconv.Itoa(roomId),
+		OK:         len(rooms) > 0,
+		Message:    "",
+		StartDate:  sd,
+		EndDate:    ed,
+		RoomTypeID: strconv.Itoa(roomTypeID),
 	}
 
 	out, _ := json.MarshalIndent(resp, "", "     ")
@@ -378,158 +442,168 @@ func (m *Repository) AvailabilityJSON(w http.ResponseWriter, r *http.Request) {
 }
 
 //Contact renders the contact page
-func (m *Repository) Contact(w http.ResponseWriter, r *http.Request) {
+func (m *Repository) Contact(w http.ResponseWriter, r *http.Request) error {
 
-	render.Template(w, r, "contact.page.html", &models.TemplateData{})
+	return render.Template(w, r, "contact.page.html", &models.TemplateData{})
 }
 
 //About page function
-func (m *Repository) About(w http.ResponseWriter, r *http.Request) {
+func (m *Repository) About(w http.ResponseWriter, r *http.Request) error {
 	//perform some logic
 
-	render.Template(w, r, "about.page.html", &models.TemplateData{})
+	return render.Template(w, r, "about.page.html", &models.TemplateData{})
 
 }
 
 //ReservationSummary summarizes the reservation
-func (m *Repository) ReservationSummary(w http.ResponseWriter, r *http.Request) {
+func (m *Repository) ReservationSummary(w http.ResponseWriter, r *http.Request) error {
 	reservation, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
 	if !ok {
-		m.App.ErrorLog.Println("Can not get item from session")
-		m.App.Session.Put(r.Context(), "error", "Can't get reservation from session")
+		logging.FromContext(r.Context()).Warn("can not get reservation from session")
+		m.App.Session.Put(r.Context(), "error", translate(r, "flash.no_reservation"))
 		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
+		return nil
 	}
 
 	m.App.Session.Remove(r.Context(), "reservation")
-	data := make(map[string]interface{})
-	data["reservation"] = reservation
-
-	sd := reservation.StartDate.Format("2006-01-02")
-	ed := reservation.EndDate.Format("2006-01-02")
-
-	stringMap := make(map[string]string)
-
-	stringMap["start-date"] = sd
-	stringMap["end-date"] = ed
 
-	render.Template(w, r, "reservation-summary.page.html", &models.TemplateData{
-		Data:      data,
-		StringMap: stringMap,
+	return render.Template(w, r, "reservation-summary.page.html", &models.TemplateData{
+		View: models.SummaryView{
+			Reservation: reservation,
+			Quote:       reservation.Quote,
+			Balance:     reservation.Total - reservation.Deposit,
+		},
 	})
 }
 
-//ChooseRoom allows users to choose a room
+//ChooseRoom allows users to choose a room type, the room itself is picked when they book
 func (m *Repository) ChooseRoom(w http.ResponseWriter, r *http.Request) {
 	// roomID, err := strconv.Atoi(chi.URLParam(r, "id"))
 	// if err != nil {
-	// 	helpers.ServerError(w, err)
+	// 	helpers.ServerError(w, r, err)
 	// 	return
 	// }
 
 	//Makes testing easier
 	exploded := strings.Split(r.RequestURI, "/")
 
-	roomID, err := strconv.Atoi(exploded[2])
+	roomTypeID, err := strconv.Atoi(exploded[2])
 	if err != nil {
-		m.App.Session.Put(r.Context(), "error", "missing url parameter")
+		m.App.Session.Put(r.Context(), "error", translate(r, "flash.missing_parameter"))
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 	res, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
 	if !ok {
-		m.App.ErrorLog.Println("Can not get item from session")
-		m.App.Session.Put(r.Context(), "error", "Can't get reservation from session")
+		logging.FromContext(r.Context()).Warn("can not get reservation from session")
+		m.App.Session.Put(r.Context(), "error", translate(r, "flash.no_reservation"))
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
-	res.RoomID = roomID
+	res.RoomTypeID = roomTypeID
+
+	held, err := m.holdRoom(r, &res)
+	if err != nil {
+		helpers.ServerError(w, r, err)
+		return
+	}
+	if !held {
+		m.App.Session.Put(r.Context(), "error", translate(r, "flash.no_rooms"))
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
 	m.App.Session.Put(r.Context(), "reservation", res)
 
 	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
 }
 
 //BookRoom takes URL parameters to build a session var and redirects to make reservation
-func (m *Repository) BookRoom(w http.ResponseWriter, r *http.Request) {
-	roomID, err := strconv.Atoi(r.URL.Query().Get("id"))
-	sd := r.URL.Query().Get("s")
-	ed := r.URL.Query().Get("e")
+func (m *Repository) BookRoom(w http.ResponseWriter, r *http.Request) error {
+	var input bookRoomInput
+	form, err := forms.Bind(r, &input)
 	if err != nil {
-		helpers.ServerError(w, err)
-		return
+		return helpers.WithStatus(http.StatusBadRequest, err)
+	}
+	if !form.Valid() {
+		return helpers.WithStatus(http.StatusBadRequest, form.Err())
 	}
-	var res models.Reservation
-
-	layout := "2006-01-02"
 
-	startDate, _ := time.Parse(layout, sd)
-	endDate, _ := time.Parse(layout, ed)
+	var res models.Reservation
 
-	room, err := m.DB.GetRoomByID(roomID)
+	roomType, err := m.DB.GetRoomTypeByID(r.Context(), input.RoomTypeID)
 
 	if err != nil {
-		helpers.ServerError(w, err)
-		return
+		return err
 	}
 
-	res.Room.RoomName = room.RoomName
+	res.RoomType = roomType
+	res.RoomTypeID = roomType.ID
+	res.Adults = 1
+	res.StartDate = input.Start
+	res.EndDate = input.End
 
-	res.RoomID = roomID
-	res.StartDate = startDate
-	res.EndDate = endDate
+	held, err := m.holdRoom(r, &res)
+	if err != nil {
+		return err
+	}
+	if !held {
+		m.App.Session.Put(r.Context(), "error", translate(r, "flash.no_rooms"))
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return nil
+	}
 
 	m.App.Session.Put(r.Context(), "reservation", res)
 
-	log.Println(roomID, startDate, endDate)
-
 	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
+
+	return nil
 }
 
-func (m *Repository) ShowLogin(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "login.page.html", &models.TemplateData{
+func (m *Repository) ShowLogin(w http.ResponseWriter, r *http.Request) error {
+	return render.Template(w, r, "login.page.html", &models.TemplateData{
 		Form: forms.New(nil),
 	})
 }
 
 //PostShowLogin handles logging the user in
-func (m *Repository) PostShowLogin(w http.ResponseWriter, r *http.Request) {
+func (m *Repository) PostShowLogin(w http.ResponseWriter, r *http.Request) error {
 	//Renew token when logging in and out
 	_ = m.App.Session.RenewToken(r.Context())
 
 	err := r.ParseForm()
 	if err != nil {
-		log.Println(err)
+		logging.FromContext(r.Context()).Warn("parsing login form", slog.Any("error", err))
 	}
 
 	email := r.Form.Get("email")
 	password := r.Form.Get("password")
 
-	form := forms.New(r.PostForm)
+	form := forms.New(r.PostForm).WithLocale(i18n.Locale(r.Context()))
 	form.Required("email", "password")
 	form.IsEmail("email")
 	if !form.Valid() {
 		//Take user back
-		render.Template(w, r, "login.page.html", &models.TemplateData{
+		return render.Template(w, r, "login.page.html", &models.TemplateData{
 			Form: form,
 		})
-		return
 	}
 
-	id, _, err := m.DB.Authenticate(email, password)
+	id, _, err := m.DB.Authenticate(r.Context(), email, password)
 
 	if err != nil {
-		log.Println(err)
-		m.App.Session.Put(r.Context(), "error", "Invalid login credentials")
+		logging.FromContext(r.Context()).Info("login failed", slog.Any("error", err))
+		m.App.Session.Put(r.Context(), "error", translate(r, "flash.bad_login"))
 		http.Redirect(w, r, "/user/login", http.StatusSeeOther)
-		return
+		return nil
 	}
 
 	m.App.Session.Put(r.Context(), "userId", id)
 
-	m.App.Session.Put(r.Context(), "flash", "Logged in successfully")
+	m.App.Session.Put(r.Context(), "flash", translate(r, "flash.logged_in"))
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 
+	return nil
 }
 
 //Logout logs a user out
@@ -541,89 +615,70 @@ func (m *Repository) Logout(w http.ResponseWriter, r *http.Request) {
 }
 
 //AdminDashboard shows the admin dashboard
-func (m *Repository) AdminDashboard(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "admin.dashboard.page.html", &models.TemplateData{})
+func (m *Repository) AdminDashboard(w http.ResponseWriter, r *http.Request) error {
+	return render.Template(w, r, "admin.dashboard.page.html", &models.TemplateData{})
 }
-func (m *Repository) AdminNewReservations(w http.ResponseWriter, r *http.Request) {
-	reservations, err := m.DB.AllNewReservations()
+func (m *Repository) AdminNewReservations(w http.ResponseWriter, r *http.Request) error {
+	reservations, err := m.DB.AllNewReservations(r.Context())
 
 	if err != nil {
-		helpers.ServerError(w, err)
-		return
+		return err
 	}
 
-	data := make(map[string]interface{})
-	data["reservations"] = reservations
-
-	render.Template(w, r, "admin.new-reservations.page.html", &models.TemplateData{
-		Data: data,
+	return render.Template(w, r, "admin.new-reservations.page.html", &models.TemplateData{
+		View: models.ReservationsView{Reservations: reservations},
 	})
 }
 
-func (m *Repository) AdminAllReservations(w http.ResponseWriter, r *http.Request) {
+func (m *Repository) AdminAllReservations(w http.ResponseWriter, r *http.Request) error {
 
-	reservations, err := m.DB.AllReservations()
+	reservations, err := m.DB.AllReservations(r.Context())
 
 	if err != nil {
-		helpers.ServerError(w, err)
-		return
+		return err
 	}
 
-	data := make(map[string]interface{})
-	data["reservations"] = reservations
-
-	render.Template(w, r, "admin.all-reservations.page.html", &models.TemplateData{
-		Data: data,
+	return render.Template(w, r, "admin.all-reservations.page.html", &models.TemplateData{
+		View: models.ReservationsView{Reservations: reservations},
 	})
 }
 
 //AdminShowReservation shows the reservation details
-func (m *Repository) AdminShowReservation(w http.ResponseWriter, r *http.Request) {
+func (m *Repository) AdminShowReservation(w http.ResponseWriter, r *http.Request) error {
 
 	// /admin/reservations/new/12/show
 	exploded := strings.Split(r.RequestURI, "/")
-	log.Print(exploded)
 
 	id, err := strconv.Atoi(exploded[4])
-	log.Print(id)
 
 	if err != nil {
-		helpers.ServerError(w, err)
-		return
+		return helpers.WithStatus(http.StatusNotFound, err)
 	}
 
-	log.Print(id)
-
 	src := exploded[3]
 
-	stringMap := make(map[string]string)
-	stringMap["src"] = src
-
 	year := r.URL.Query().Get("y")
 	month := r.URL.Query().Get("m")
 
-	stringMap["month"] = month
-	stringMap["year"] = year
-
 	//Get reservation from the Database
-	res, err := m.DB.GetReservationByID(id)
+	res, err := m.DB.GetReservationByID(r.Context(), id)
 	if err != nil {
-		helpers.ServerError(w, err)
-		return
+		return err
 	}
 
-	data := make(map[string]interface{})
-	data["reservation"] = res
+	view, err := m.adminReservationView(r, res, src, year, month)
+	if err != nil {
+		return err
+	}
 
-	render.Template(w, r, "admin.reservations.show.page.html", &models.TemplateData{
-		StringMap: stringMap,
-		Data:      data,
-		Form:      forms.New(nil),
+	return render.Template(w, r, "admin.reservations.show.page.html", &models.TemplateData{
+		View: view,
+		Form: forms.New(nil),
 	})
 }
 
 //AdminReservationsCalender display the reservation calender
-func (m *Repository) AdminReservationsCalendar(w http.ResponseWriter, r *http.Request) {
+func (m *Repository) AdminReservationsCalendar(w http.ResponseWriter, r *http.Request) error {
 
 	//assume there is no month/year specified
 	now := time.Now()
@@ -635,28 +690,6 @@ func (m *Repository) AdminReservationsCalendar(w http.ResponseWriter, r *http.Re
 		now = time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.Local)
 	}
 
-	data := make(map[string]interface{})
-
-	data["now"] = now
-
-	next := now.AddDate(0, 1, 0)
-	last := now.AddDate(0, -1, 0)
-
-	nextMonth := next.Format("01")
-	nextMonthYear := next.Format("2006")
-
-	lastMonth := last.Format("01")
-	lastMonthYear := last.Format("2006")
-
-	stringMap := make(map[string]string)
-	stringMap["nextMonth"] = nextMonth
-	stringMap["nextMonthYear"] = nextMonthYear
-	stringMap["lastMonth"] = lastMonth
-	stringMap["lastMonthYear"] = lastMonthYear
-
-	stringMap["thisMonth"] = now.Format("01")
-	stringMap["thisMonthYear"] = now.Format("2006")
-
 	//get the first and last days of the month
 	currentYear, currentMonth, _ := now.Date()
 	currentLocation := now.Location()
@@ -664,24 +697,23 @@ func (m *Repository) AdminReservationsCalendar(w http.ResponseWriter, r *http.Re
 	firstOfMonth := time.Date(currentYear, currentMonth, 1, 0, 0, 0, 0, currentLocation)
 	lastOfMonth := firstOfMonth.AddDate(0, 1, -1)
 
-	intMap := make(map[string]int)
-	intMap["daysInMonth"] = lastOfMonth.Day()
-
-	rooms, err := m.DB.AllRooms()
+	view := models.CalendarView{
+		Month:    now,
+		Previous: now.AddDate(0, -1, 0),
+		Next:     now.AddDate(0, 1, 0),
+	}
 
-	log.Print(rooms)
+	rooms, err := m.DB.AllRooms(r.Context())
 
 	if err != nil {
-		helpers.ServerError(w, err)
-		return
+		return err
 	}
 
-	data["rooms"] = rooms
-
 	for _, x := range rooms {
 		//create maps
 		reservationMap := make(map[string]int)
 		blockMap := make(map[string]int)
+		holdMap := make(map[string]bool)
 
 		for d := firstOfMonth; d.After(lastOfMonth) == false; d = d.AddDate(0, 0, 1) {
 			reservationMap[d.Format("2006-01-2")] = 0
@@ -689,85 +721,115 @@ func (m *Repository) AdminReservationsCalendar(w http.ResponseWriter, r *http.Re
 		}
 
 		//Get All restrictions for the current room
-		restrictions, err := m.DB.GetRestrictionsForRoomByDate(x.ID, firstOfMonth, lastOfMonth)
+		restrictions, err := m.DB.GetRestrictionsForRoomByDate(r.Context(), x.ID, firstOfMonth, lastOfMonth)
 		if err != nil {
-			helpers.ServerError(w, err)
-			return
+			return err
 		}
 
+		row := models.CalendarRoom{Room: x}
+
 		for _, y := range restrictions {
 			if y.ReservationID > 0 {
 				//Reservation
 				for d := y.StartDate; d.After(y.EndDate) == false; d = d.AddDate(0, 0, 1) {
 					reservationMap[d.Format("2006-01-2")] = y.ReservationID
 				}
+				row.Reservations = append(row.Reservations, models.CalendarReservation{
+					ID:        y.ReservationID,
+					StartDate: y.StartDate,
+					EndDate:   y.EndDate,
+				})
+			} else if y.RestrictionID == models.RestrictionHold {
+				//Hold, a guest is booking the room and the owner can't block or release it
+				for d := y.StartDate; d.Before(y.EndDate); d = d.AddDate(0, 0, 1) {
+					holdMap[d.Format("2006-01-2")] = true
+				}
 			} else {
 				//Block
 				blockMap[y.StartDate.Format("2006-01-2")] = y.ID
 			}
 		}
 
-		data[fmt.Sprintf("reservation_map_%d", x.ID)] = reservationMap
-		data[fmt.Sprintf("block_map_%d", x.ID)] = blockMap
-		//log.Print(data[fmt.Sprintf("block_map_%d", x.ID)])
+		//a reservation can be moved to any other room of the same type
+		for _, other := range rooms {
+			if other.RoomTypeID == x.RoomTypeID && other.ID != x.ID {
+				row.Moves = append(row.Moves, other)
+			}
+		}
+		for d := firstOfMonth; d.After(lastOfMonth) == false; d = d.AddDate(0, 0, 1) {
+			date := d.Format("2006-01-2")
+			row.Days = append(row.Days, models.CalendarDay{
+				Day:           d.Day(),
+				Date:          date,
+				ReservationID: reservationMap[date],
+				BlockID:       blockMap[date],
+				Held:          holdMap[date],
+			})
+		}
+		view.Rooms = append(view.Rooms, row)
 
 		m.App.Session.Put(r.Context(), fmt.Sprintf("block_map_%d", x.ID), blockMap)
 
 	}
 
-	render.Template(w, r, "admin.reservations.calendar.page.html", &models.TemplateData{
-		StringMap: stringMap,
-		Data:      data,
-		IntMap:    intMap,
+	return render.Template(w, r, "admin.reservations.calendar.page.html", &models.TemplateData{
+		View: view,
 	})
 }
 
 //AdminPostShowReservation shows the reservation details
-func (m *Repository) AdminPostShowReservation(w http.ResponseWriter, r *http.Request) {
-
-	err := r.ParseForm()
+func (m *Repository) AdminPostShowReservation(w http.ResponseWriter, r *http.Request) error {
+	var input adminReservationInput
+	form, err := forms.Bind(r, &input)
 	if err != nil {
-		helpers.ServerError(w, err)
-		return
+		return helpers.WithStatus(http.StatusBadRequest, err)
 	}
 	exploded := strings.Split(r.RequestURI, "/")
 
 	id, err := strconv.Atoi(exploded[4])
 
 	if err != nil {
-		helpers.ServerError(w, err)
-		return
+		return helpers.WithStatus(http.StatusNotFound, err)
 	}
 
-	log.Print(id)
-
 	src := exploded[3]
 
-	stringMap := make(map[string]string)
-	stringMap["src"] = src
-
 	//Get reservation from the Database
-	res, err := m.DB.GetReservationByID(id)
+	res, err := m.DB.GetReservationByID(r.Context(), id)
 	if err != nil {
-		helpers.ServerError(w, err)
-		return
+		return err
 	}
 
-	res.FirstName = r.Form.Get("first-name")
-	res.LastName = r.Form.Get("last-name")
-	res.Email = r.Form.Get("email")
-	res.Phone = r.Form.Get("phone")
+	//phones saved before they were checked are kept as typed, so older reservations can still
+	//be edited. A changed phone has to be a valid number
+	if input.Phone != res.Phone && form.IsPhone("phone") {
+		input.Phone = forms.NormalizePhone(input.Phone)
+	}
+
+	res.FirstName = input.FirstName
+	res.LastName = input.LastName
+	res.Email = input.Email
+	res.Phone = input.Phone
+
+	if !form.Valid() {
+		view, err := m.adminReservationView(r, res, src, input.Year, input.Month)
+		if err != nil {
+			return err
+		}
+		return render.Template(w, r, "admin.reservations.show.page.html", &models.TemplateData{
+			View: view,
+			Form: form,
+		})
+	}
 
-	err = m.DB.UpdateReservation(res)
+	err = m.DB.UpdateReservation(r.Context(), res)
 	if err != nil {
-		helpers.ServerError(w, err)
-		return
+		return err
 	}
 
-	//month := r.Form.Get("month")
-	year := r.Form.Get("year")
+	year := input.Year
 
-	m.App.Session.Put(r.Context(), "flash", "changes saved")
+	m.App.Session.Put(r.Context(), "flash", translate(r, "flash.saved"))
 
 	if year == "" {
 		http.Redirect(w, r, fmt.Sprintf("/admin/%s-reservations", src), http.StatusSeeOther)
@@ -775,6 +837,8 @@ func (m *Repository) AdminPostShowReservation(w http.ResponseWriter, r *http.Req
 		//http.Redirect(w, r, fmt.Sprintf("/admin/reservations?y=%s&m=%s", year, month), http.StatusSeeOther)
 		http.Redirect(w, r, fmt.Sprintf("/admin/%s-reservations", src), http.StatusSeeOther)
 	}
+
+	return nil
 }
 
 //AdminProcessReservation processes the reservation
@@ -782,51 +846,46 @@ func (m *Repository) AdminProcessReservation(w http.ResponseWriter, r *http.Requ
 	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
 	src := chi.URLParam(r, "src")
 
-	err := m.DB.UpdateProcessedForReservation(id, 1)
+	err := m.DB.UpdateProcessedForReservation(r.Context(), id, 1)
 	if err != nil {
-		log.Println(err)
+		logging.FromContext(r.Context()).Error("marking reservation processed", slog.Int("reservation_id", id), slog.Any("error", err))
 	}
 
 	year := r.URL.Query().Get("y")
 	month := r.URL.Query().Get("m")
 
-	m.App.Session.Put(r.Context(), "flash", "Reservation marked as complete")
-
-	if year == "" {
-		http.Redirect(w, r, fmt.Sprintf("/admin/%s-reservations", src), http.StatusSeeOther)
-	} else {
-		http.Redirect(w, r, fmt.Sprintf("/admin/calendar?y=%s&m=%s", year, month), http.StatusSeeOther)
-	}
+	m.App.Session.Put(r.Context(), "flash", translate(r, "flash.processed"))
+	redirectAfterAdmin(w, r, src, year, month)
 }
 
-//AdminProcessReservation deletes a reservation
+//AdminDeleteReservation deletes a reservation outright, for ones made by mistake. Guests'
+//reservations are cancelled instead, see AdminCancelReservation
 func (m *Repository) AdminDeleteReservation(w http.ResponseWriter, r *http.Request) {
 	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
 	src := chi.URLParam(r, "src")
 
-	err := m.DB.DeleteReservation(id)
-	if err != nil {
-		log.Println(err)
+	err := m.DB.DeleteReservation(r.Context(), id)
+	switch {
+	case errors.Is(err, repository.ErrReservationBilled):
+		m.App.Session.Put(r.Context(), "error", translate(r, "flash.delete_billed"))
+	case err != nil:
+		logging.FromContext(r.Context()).Error("deleting reservation", slog.Int("reservation_id", id), slog.Any("error", err))
+		m.App.Session.Put(r.Context(), "error", translate(r, "flash.delete_failed"))
+	default:
+		m.App.Session.Put(r.Context(), "flash", translate(r, "flash.deleted"))
 	}
 
 	year := r.URL.Query().Get("y")
 	month := r.URL.Query().Get("m")
 
-	m.App.Session.Put(r.Context(), "flash", "Reservation marked as complete")
-
-	if year == "" {
-		http.Redirect(w, r, fmt.Sprintf("/admin/%s-reservations", src), http.StatusSeeOther)
-	} else {
-		http.Redirect(w, r, fmt.Sprintf("/admin/calendar?y=%s&m=%s", year, month), http.StatusSeeOther)
-	}
+	redirectAfterAdmin(w, r, src, year, month)
 }
 
 //AdminPostReservationsCalendar handles posts to the calendar
-func (m *Repository) AdminPostReservationsCalendar(w http.ResponseWriter, r *http.Request) {
+func (m *Repository) AdminPostReservationsCalendar(w http.ResponseWriter, r *http.Request) error {
 	err := r.ParseForm()
 	if err != nil {
-		helpers.ServerError(w, err)
-		return
+		return helpers.WithStatus(http.StatusBadRequest, err)
 	}
 
 	year, _ := strconv.Atoi(r.Form.Get("y"))
@@ -834,13 +893,12 @@ func (m *Repository) AdminPostReservationsCalendar(w http.ResponseWriter, r *htt
 
 	//Process Blocks
 
-	rooms, err := m.DB.AllRooms()
+	rooms, err := m.DB.AllRooms(r.Context())
 	if err != nil {
-		helpers.ServerError(w, err)
-		return
+		return err
 	}
 
-	form := forms.New(r.PostForm)
+	form := forms.New(r.PostForm).WithLocale(i18n.Locale(r.Context()))
 
 	for _, x := range rooms {
 		//Get block map from the session, Loop through map
@@ -853,10 +911,11 @@ func (m *Repository) AdminPostReservationsCalendar(w http.ResponseWriter, r *htt
 				if val > 0 {
 					if !form.HasARequiredField(fmt.Sprintf("remove_block_%d_%s", x.ID, name)) {
 						//delete restriction by ID
-						log.Println("Delete block value: ", value)
-						err := m.DB.DeleteBlockByID(value)
+						err := m.DB.DeleteBlockByID(r.Context(), value)
 						if err != nil {
-							log.Println(err)
+							logging.FromContext(r.Context()).Error("removing block", slog.Int("restriction_id", value), slog.Any("error", err))
+						} else {
+							metrics.BlocksRemoved.Inc()
 						}
 					}
 				}
@@ -866,25 +925,129 @@ func (m *Repository) AdminPostReservationsCalendar(w http.ResponseWriter, r *htt
 
 	//handle new blocks
 	for name, _ := range r.PostForm {
-		log.Println("Form has name", name)
 		if strings.HasPrefix(name, "add_block") {
 			exploded := strings.Split(name, "_")
 			roomID, _ := strconv.Atoi(exploded[2])
 			date := exploded[3]
-			log.Println("Expoloded", exploded)
-			log.Println("Would insert block for room Id", roomID)
-			log.Println("Would insert block for date", date)
 
 			t, _ := time.Parse("2006-01-2", exploded[3])
-			err := m.DB.InsertBlockForRoom(roomID, t)
+			err := m.DB.InsertBlockForRoom(r.Context(), roomID, t)
 
 			if err != nil {
-				log.Println(err)
+				logging.FromContext(r.Context()).Error("adding block", slog.Int("room_id", roomID), slog.String("date", date), slog.Any("error", err))
+			} else {
+				metrics.BlocksAdded.Inc()
 			}
 		}
 	}
 
-	m.App.Session.Put(r.Context(), "flash", "changes saved")
+	//handle reservations moved to another room, posted as move_<reservation id>_<room id>
+	//with the new room id as the value
+	for name := range r.PostForm {
+		if !strings.HasPrefix(name, "move_") {
+			continue
+		}
+		exploded := strings.Split(name, "_")
+		if len(exploded) != 3 {
+			continue
+		}
+		reservationID, _ := strconv.Atoi(exploded[1])
+		currentID, _ := strconv.Atoi(exploded[2])
+		roomID, err := strconv.Atoi(r.PostForm.Get(name))
+		if err != nil || roomID == currentID {
+			continue
+		}
+
+		err = m.DB.ReassignRoom(r.Context(), reservationID, roomID)
+		switch {
+		case errors.Is(err, repository.ErrRoomNotFree), errors.Is(err, repository.ErrRoomTypeMismatch):
+			m.App.Session.Put(r.Context(), "error", translate(r, "flash.room_not_free", reservationID))
+		case err != nil:
+			logging.FromContext(r.Context()).Error("moving reservation", slog.Int("reservation_id", reservationID), slog.Int("room_id", roomID), slog.Any("error", err))
+			m.App.Session.Put(r.Context(), "error", translate(r, "flash.save_failed"))
+		}
+	}
+
+	m.App.Session.Put(r.Context(), "flash", translate(r, "flash.saved"))
 	http.Redirect(w, r, fmt.Sprintf("/admin/calendar?y=%d&m=%d", year, month), http.StatusSeeOther)
 
+	return nil
+}
+
+//SetLanguage stores the locale picked with the language switcher and goes back to the page
+//the switcher was on
+func (m *Repository) SetLanguage(w http.ResponseWriter, r *http.Request) {
+	locale := chi.URLParam(r, "locale")
+	if i18n.IsSupported(locale) {
+		m.App.Session.Put(r.Context(), "locale", locale)
+	}
+
+	back := "/"
+	if ref, err := url.Parse(r.Referer()); err == nil && ref.Host == r.Host && strings.HasPrefix(ref.Path, "/") {
+		back = ref.RequestURI()
+	}
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+//quote returns the price of stay in rt with the taxes charged on it
+func (m *Repository) quote(ctx context.Context, rt models.RoomType, stay pricing.Stay) (pricing.Quote, error) {
+	rules, err := m.DB.TaxRulesForDates(ctx, stay.Start, stay.End)
+	if err != nil {
+		return pricing.Quote{}, err
+	}
+	return pricing.Calculate(rt.Rate(), stay, taxes(rules, rt.ID)...), nil
+}
+
+//taxes returns the taxes of rules charged on stays in the room type
+func taxes(rules []models.TaxRule, roomTypeID int) []pricing.Tax {
+	var taxes []pricing.Tax
+	for _, rule := range rules {
+		if rule.RoomTypeID == 0 || rule.RoomTypeID == roomTypeID {
+			taxes = append(taxes, rule.Tax())
+		}
+	}
+	return taxes
+}
+
+//translate returns the message for key in the locale of r
+func translate(r *http.Request, key string, args ...interface{}) string {
+	return i18n.T(i18n.Locale(r.Context()), key, args...)
+}
+
+//explain returns the message for a broken stay rule in the locale of r, with its dates and
+//weekdays spelled out in that locale
+func explain(r *http.Request, v *stayrules.Violation) string {
+	locale := i18n.Locale(r.Context())
+
+	args := make([]interface{}, len(v.Args))
+	for i, arg := range v.Args {
+		switch x := arg.(type) {
+		case time.Time:
+			args[i] = i18n.FormatDate(locale, x)
+		case time.Weekday:
+			args[i] = i18n.T(locale, fmt.Sprintf("weekday.%d", x))
+		default:
+			args[i] = x
+		}
+	}
+	return i18n.T(locale, v.Key, args...)
+}
+
+//violationField returns which of a form's date fields a broken stay rule is about
+func violationField(v *stayrules.Violation, start, end string) string {
+	switch v.Key {
+	case "stay_rule.no_departure", "stay_rule.min_nights", "stay_rule.max_nights":
+		return end
+	}
+	return start
+}
+
+//NotFound renders the 404 page for paths no route matches
+func (m *Repository) NotFound(w http.ResponseWriter, r *http.Request) {
+	helpers.ClientError(w, r, http.StatusNotFound)
+}
+
+//MethodNotAllowed renders the 405 page for a known path requested with the wrong method
+func (m *Repository) MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	helpers.ClientError(w, r, http.StatusMethodNotAllowed)
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"html"
 	"log"
 	"net/http"
 	"net/http/httptest"
@@ -14,7 +15,12 @@ import (
 	"time"
 
 	"github.com/darinmilner/goserver/internal/driver"
+	"github.com/darinmilner/goserver/internal/helpers"
+	"github.com/darinmilner/goserver/internal/i18n"
 	"github.com/darinmilner/goserver/internal/models"
+	"github.com/darinmilner/goserver/internal/payments"
+	"github.com/darinmilner/goserver/internal/pricing"
+	"github.com/go-chi/chi"
 )
 
 type postData struct {
@@ -41,6 +47,9 @@ var theTests = []struct {
 	{"new reservation", "/admin/new-reservations", "GET", http.StatusOK},
 	{"all reservation", "/admin/all-reservations", "GET", http.StatusOK},
 	{"show one reservation", "/admin/reservations/new/1/show", "GET", http.StatusOK},
+	{"show missing reservation", "/admin/reservations/new/invalid/show", "GET", http.StatusNotFound},
+	{"show cancelled reservation", "/admin/reservations/all/7/show", "GET", http.StatusOK},
+	{"not found", "/no-such-page", "GET", http.StatusNotFound},
 }
 
 func TestHandlers(t *testing.T) {
@@ -75,20 +84,70 @@ var testAvailabilityJSONData = []struct {
 	{
 		name: "rooms not available",
 		postedData: url.Values{
-			"start":   {"2050-01-01"},
-			"end":     {"2050-01-02"},
-			"room_id": {"1"},
+			"start":        {"2050-01-01"},
+			"end":          {"2050-01-02"},
+			"room-type-id": {"1"},
 		},
 		expectedOK: false,
 	}, {
 		name: "rooms are available",
 		postedData: url.Values{
-			"start":   {"2040-01-01"},
-			"end":     {"2040-01-02"},
-			"room_id": {"1"},
+			"start":        {"2040-01-01"},
+			"end":          {"2040-01-02"},
+			"room-type-id": {"1"},
 		},
 		expectedOK: true,
 	},
+	{
+		name: "end before start",
+		postedData: url.Values{
+			"start":        {"2040-01-02"},
+			"end":          {"2040-01-01"},
+			"room-type-id": {"1"},
+		},
+		expectedOK: false,
+	},
+	{
+		name: "party too big for the room",
+		postedData: url.Values{
+			"start":        {"2040-01-01"},
+			"end":          {"2040-01-02"},
+			"room-type-id": {"1"},
+			"adults":       {"2"},
+			"children":     {"1"},
+		},
+		expectedOK: false,
+	},
+	{
+		name: "stay too short for the rules",
+		postedData: url.Values{
+			"start":        {"2045-01-02"},
+			"end":          {"2045-01-03"},
+			"room-type-id": {"1"},
+		},
+		expectedOK:      false,
+		expectedMessage: "Stays arriving on January 2, 2045 must be at least 2 nights",
+	},
+	{
+		name: "no arrival on sundays",
+		postedData: url.Values{
+			"start":        {"2045-01-01"},
+			"end":          {"2045-01-04"},
+			"room-type-id": {"2"},
+		},
+		expectedOK:      false,
+		expectedMessage: "Arrivals aren't possible on a Sunday for these dates",
+	},
+	{
+		name: "stay rules query fails",
+		postedData: url.Values{
+			"start":        {"2047-01-01"},
+			"end":          {"2047-01-02"},
+			"room-type-id": {"1"},
+		},
+		expectedOK:      false,
+		expectedMessage: "Error querying database",
+	},
 	{
 		name:            "empty post body",
 		postedData:      nil,
@@ -98,9 +157,9 @@ var testAvailabilityJSONData = []struct {
 	{
 		name: "database query fails",
 		postedData: url.Values{
-			"start":   {"2060-01-01"},
-			"end":     {"2060-01-02"},
-			"room_id": {"1"},
+			"start":        {"2060-01-01"},
+			"end":          {"2060-01-02"},
+			"room-type-id": {"1"},
 		},
 		expectedOK:      false,
 		expectedMessage: "Error querying database",
@@ -135,15 +194,18 @@ func TestAvailabilityJSON(t *testing.T) {
 		if j.OK != e.expectedOK {
 			t.Errorf("%s: expected %v but got %v", e.name, e.expectedOK, j.OK)
 		}
+		if e.expectedMessage != "" && j.Message != e.expectedMessage {
+			t.Errorf("%s: expected message %q but got %q", e.name, e.expectedMessage, j.Message)
+		}
 	}
 }
 
 func TestRepositoryReservation(t *testing.T) {
 	reservation := models.Reservation{
-		RoomID: 1,
-		Room: models.Room{
-			ID:       1,
-			RoomName: "General's Quarters",
+		RoomTypeID: 1,
+		RoomType: models.RoomType{
+			ID:   1,
+			Name: "General's Quarters",
 		},
 	}
 
@@ -156,7 +218,7 @@ func TestRepositoryReservation(t *testing.T) {
 
 	session.Put(ctx, "reservation", reservation)
 
-	handler := http.HandlerFunc(Repo.Reservation)
+	handler := helpers.Handler(Repo.Reservation)
 
 	handler.ServeHTTP(rr, req)
 
@@ -186,7 +248,7 @@ func TestRepositoryReservation(t *testing.T) {
 
 	rr = httptest.NewRecorder()
 
-	reservation.RoomID = 1000
+	reservation.RoomTypeID = 1000
 	session.Put(ctx, "reservation", reservation)
 	handler.ServeHTTP(rr, req)
 
@@ -288,7 +350,7 @@ func TestRepositoryReservationSummary(t *testing.T) {
 	session.Put(ctx, "reservation", reservation)
 
 	//Server HTTP handlefunc
-	handler := http.HandlerFunc(Repo.ReservationSummary)
+	handler := helpers.Handler(Repo.ReservationSummary)
 	handler.ServeHTTP(rr, req)
 
 	if rr.Code != http.StatusOK {
@@ -307,7 +369,7 @@ func TestRepositoryReservationSummary(t *testing.T) {
 	//session.Put(ctx, "reservation", reservation)
 
 	//Server HTTP handlefunc
-	handler = http.HandlerFunc(Repo.ReservationSummary)
+	handler = helpers.Handler(Repo.ReservationSummary)
 	handler.ServeHTTP(rr, req)
 
 	if rr.Code != http.StatusSeeOther {
@@ -318,14 +380,14 @@ func TestRepositoryReservationSummary(t *testing.T) {
 
 func TestRepositoryPostReservation(t *testing.T) {
 
-	reqBody := "start-date=2050-01-01"
+	reqBody := "start-date=2040-01-01"
 
-	reqBody = fmt.Sprintf("%s&%s", reqBody, "end-date=2050-01-02")
+	reqBody = fmt.Sprintf("%s&%s", reqBody, "end-date=2040-01-02")
 	reqBody = fmt.Sprintf("%s&%s", reqBody, "first-name=Ali")
 	reqBody = fmt.Sprintf("%s&%s", reqBody, "last-name=Jamal")
 	reqBody = fmt.Sprintf("%s&%s", reqBody, "email=aJamal@abc.com")
-	reqBody = fmt.Sprintf("%s&%s", reqBody, "phone=123456789")
-	reqBody = fmt.Sprintf("%s&%s", reqBody, "room-id=1")
+	reqBody = fmt.Sprintf("%s&%s", reqBody, "phone=%2B15555550123")
+	reqBody = fmt.Sprintf("%s&%s", reqBody, "room-type-id=1")
 
 	postData := url.Values{}
 	postData.Add("start-date", "2050-01-01")
@@ -334,7 +396,7 @@ func TestRepositoryPostReservation(t *testing.T) {
 	postData.Add("last-name", "Grenada")
 	postData.Add("email", "yg@yg.com")
 	postData.Add("phone", "222-122-0122")
-	postData.Add("room-id", "1")
+	postData.Add("room-type-id", "1")
 
 	//postData.Encode()
 	req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(reqBody))
@@ -345,12 +407,28 @@ func TestRepositoryPostReservation(t *testing.T) {
 
 	rr := httptest.NewRecorder()
 
-	handler := http.HandlerFunc(Repo.PostReservation)
+	handler := helpers.Handler(Repo.PostReservation)
 	handler.ServeHTTP(rr, req)
 
-	if rr.Code != http.StatusSeeOther {
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/checkout" {
 		t.Errorf("Reservation handler returned response code got %d but wanted %d", rr.Code, http.StatusSeeOther)
 	}
+	if res, _ := session.Get(ctx, "reservation").(models.Reservation); res.Deposit != payments.Deposit(res.Total, app.Payments.DepositPercent) || res.RoomID == 0 {
+		t.Errorf("expected a room and the deposit in the session, got %+v", res)
+	}
+
+	//Test for no free room of the type
+	reqBody = strings.NewReplacer("2040-", "2050-").Replace(reqBody)
+	req, _ = http.NewRequest("POST", "/make-reservation", strings.NewReader(reqBody))
+	req = req.WithContext(getCtx(req))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr = httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/search-availability" {
+		t.Errorf("PostReservation without a free room: got %d to %q", rr.Code, rr.Header().Get("Location"))
+	}
 
 	//Test for missing post body
 	req, _ = http.NewRequest("POST", "/make-reservation", nil)
@@ -360,7 +438,7 @@ func TestRepositoryPostReservation(t *testing.T) {
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	rr = httptest.NewRecorder()
 
-	handler = http.HandlerFunc(Repo.PostReservation)
+	handler = helpers.Handler(Repo.PostReservation)
 	handler.ServeHTTP(rr, req)
 
 	if rr.Code != http.StatusSeeOther {
@@ -374,8 +452,8 @@ func TestRepositoryPostReservation(t *testing.T) {
 	reqBody = fmt.Sprintf("%s&%s", reqBody, "first-name=Ali")
 	reqBody = fmt.Sprintf("%s&%s", reqBody, "last-name=Jamal")
 	reqBody = fmt.Sprintf("%s&%s", reqBody, "email=aJamal@abc.com")
-	reqBody = fmt.Sprintf("%s&%s", reqBody, "phone=123456789")
-	reqBody = fmt.Sprintf("%s&%s", reqBody, "room-id=1")
+	reqBody = fmt.Sprintf("%s&%s", reqBody, "phone=%2B15555550123")
+	reqBody = fmt.Sprintf("%s&%s", reqBody, "room-type-id=1")
 
 	req, _ = http.NewRequest("POST", "/make-reservation", strings.NewReader(reqBody))
 
@@ -385,11 +463,11 @@ func TestRepositoryPostReservation(t *testing.T) {
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	rr = httptest.NewRecorder()
 
-	handler = http.HandlerFunc(Repo.PostReservation)
+	handler = helpers.Handler(Repo.PostReservation)
 	handler.ServeHTTP(rr, req)
 
-	if rr.Code != http.StatusSeeOther {
-		t.Errorf("PostReservation handler returned response code for invalid startdate: %d but wanted %d", rr.Code, http.StatusSeeOther)
+	if rr.Code != http.StatusOK {
+		t.Errorf("PostReservation handler returned response code for invalid startdate: %d but wanted %d", rr.Code, http.StatusOK)
 	}
 
 	//test for invalid end date
@@ -399,8 +477,8 @@ func TestRepositoryPostReservation(t *testing.T) {
 	reqBody = fmt.Sprintf("%s&%s", reqBody, "first-name=Ali")
 	reqBody = fmt.Sprintf("%s&%s", reqBody, "last-name=Jamal")
 	reqBody = fmt.Sprintf("%s&%s", reqBody, "email=aJamal@abc.com")
-	reqBody = fmt.Sprintf("%s&%s", reqBody, "phone=123456789")
-	reqBody = fmt.Sprintf("%s&%s", reqBody, "room-id=1")
+	reqBody = fmt.Sprintf("%s&%s", reqBody, "phone=%2B15555550123")
+	reqBody = fmt.Sprintf("%s&%s", reqBody, "room-type-id=1")
 
 	req, _ = http.NewRequest("POST", "/make-reservation", strings.NewReader(reqBody))
 
@@ -410,11 +488,11 @@ func TestRepositoryPostReservation(t *testing.T) {
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	rr = httptest.NewRecorder()
 
-	handler = http.HandlerFunc(Repo.PostReservation)
+	handler = helpers.Handler(Repo.PostReservation)
 	handler.ServeHTTP(rr, req)
 
-	if rr.Code != http.StatusSeeOther {
-		t.Errorf("PostReservation handler returned response code for invalid enddate: %d but wanted %d", rr.Code, http.StatusSeeOther)
+	if rr.Code != http.StatusOK {
+		t.Errorf("PostReservation handler returned response code for invalid enddate: %d but wanted %d", rr.Code, http.StatusOK)
 	}
 
 	//test for invalid room Id
@@ -424,8 +502,8 @@ func TestRepositoryPostReservation(t *testing.T) {
 	reqBody = fmt.Sprintf("%s&%s", reqBody, "first-name=Ali")
 	reqBody = fmt.Sprintf("%s&%s", reqBody, "last-name=Jamal")
 	reqBody = fmt.Sprintf("%s&%s", reqBody, "email=aJamal@abc.com")
-	reqBody = fmt.Sprintf("%s&%s", reqBody, "phone=123456789")
-	reqBody = fmt.Sprintf("%s&%s", reqBody, "room-id=invalid")
+	reqBody = fmt.Sprintf("%s&%s", reqBody, "phone=%2B15555550123")
+	reqBody = fmt.Sprintf("%s&%s", reqBody, "room-type-id=invalid")
 
 	req, _ = http.NewRequest("POST", "/make-reservation", strings.NewReader(reqBody))
 
@@ -435,7 +513,7 @@ func TestRepositoryPostReservation(t *testing.T) {
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	rr = httptest.NewRecorder()
 
-	handler = http.HandlerFunc(Repo.PostReservation)
+	handler = helpers.Handler(Repo.PostReservation)
 	handler.ServeHTTP(rr, req)
 
 	if rr.Code != http.StatusSeeOther {
@@ -449,8 +527,8 @@ func TestRepositoryPostReservation(t *testing.T) {
 	reqBody = fmt.Sprintf("%s&%s", reqBody, "first-name=j")
 	reqBody = fmt.Sprintf("%s&%s", reqBody, "last-name=Jamal")
 	reqBody = fmt.Sprintf("%s&%s", reqBody, "email=aJamal@abc.com")
-	reqBody = fmt.Sprintf("%s&%s", reqBody, "phone=123456789")
-	reqBody = fmt.Sprintf("%s&%s", reqBody, "room-id=1")
+	reqBody = fmt.Sprintf("%s&%s", reqBody, "phone=%2B15555550123")
+	reqBody = fmt.Sprintf("%s&%s", reqBody, "room-type-id=1")
 
 	req, _ = http.NewRequest("POST", "/make-reservation", strings.NewReader(reqBody))
 
@@ -460,22 +538,22 @@ func TestRepositoryPostReservation(t *testing.T) {
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	rr = httptest.NewRecorder()
 
-	handler = http.HandlerFunc(Repo.PostReservation)
+	handler = helpers.Handler(Repo.PostReservation)
 	handler.ServeHTTP(rr, req)
 
 	if rr.Code != http.StatusOK {
 		t.Errorf("PostReservation handler returned response code for invalid data: %d but wanted %d", rr.Code, http.StatusOK)
 	}
 
-	//test for failure to insert data to the db
+	//test for an unknown room type, which sends the guest home before the other fields are looked at
 	reqBody = "start-date=2050-01-01"
 
-	reqBody = fmt.Sprintf("%s&%s", reqBody, "end-date=2050-01-02")
+	reqBody = fmt.Sprintf("%s&%s", reqBody, "end-date=invalid")
 	reqBody = fmt.Sprintf("%s&%s", reqBody, "first-name=Ali")
 	reqBody = fmt.Sprintf("%s&%s", reqBody, "last-name=Jamal")
 	reqBody = fmt.Sprintf("%s&%s", reqBody, "email=aJamal@abc.com")
-	reqBody = fmt.Sprintf("%s&%s", reqBody, "phone=123456789")
-	reqBody = fmt.Sprintf("%s&%s", reqBody, "room-id=2")
+	reqBody = fmt.Sprintf("%s&%s", reqBody, "phone=%2B15555550123")
+	reqBody = fmt.Sprintf("%s&%s", reqBody, "room-type-id=200000")
 
 	req, _ = http.NewRequest("POST", "/make-reservation", strings.NewReader(reqBody))
 
@@ -485,36 +563,61 @@ func TestRepositoryPostReservation(t *testing.T) {
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	rr = httptest.NewRecorder()
 
-	handler = http.HandlerFunc(Repo.PostReservation)
+	handler = helpers.Handler(Repo.PostReservation)
 	handler.ServeHTTP(rr, req)
 
-	if rr.Code != http.StatusSeeOther {
-		t.Errorf("PostReservation handler failed inserting data into db: %d but wanted %d", rr.Code, http.StatusSeeOther)
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/" {
+		t.Errorf("PostReservation handler returned response code for an unknown room type: %d to %q but wanted %d to /",
+			rr.Code, rr.Header().Get("Location"), http.StatusSeeOther)
 	}
+}
 
-	//test for failure to insert restriction into db
-	reqBody = "start-date=2050-01-01"
-
-	reqBody = fmt.Sprintf("%s&%s", reqBody, "end-date=invalid")
-	reqBody = fmt.Sprintf("%s&%s", reqBody, "first-name=Ali")
-	reqBody = fmt.Sprintf("%s&%s", reqBody, "last-name=Jamal")
-	reqBody = fmt.Sprintf("%s&%s", reqBody, "email=aJamal@abc.com")
-	reqBody = fmt.Sprintf("%s&%s", reqBody, "phone=123456789")
-	reqBody = fmt.Sprintf("%s&%s", reqBody, "room-id=200000")
-
-	req, _ = http.NewRequest("POST", "/make-reservation", strings.NewReader(reqBody))
+func TestPostReservationValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  url.Values
+		message string
+	}{
+		{"free text phone", url.Values{"phone": {"call me"}}, i18n.T(i18n.Default, "form.phone")},
+		{"phone without country code", url.Values{"phone": {"555-555-0123"}}, i18n.T(i18n.Default, "form.phone")},
+		{"end before start", url.Values{"end-date": {"2049-12-30"}}, i18n.T(i18n.Default, "form.end_before_start")},
+		{"same day", url.Values{"end-date": {"2050-01-01"}}, i18n.T(i18n.Default, "form.end_before_start")},
+		{"start in the past", url.Values{"start-date": {"2020-01-01"}, "end-date": {"2020-01-02"}}, i18n.T(i18n.Default, "form.past")},
+		{"stay too long", url.Values{"start-date": {"2045-01-02"}, "end-date": {"2045-03-01"}}, i18n.T(i18n.Default, "stay_rule.max_nights", "January 2, 2045", 30)},
+		{"name too long", url.Values{"last-name": {strings.Repeat("a", 256)}}, i18n.T(i18n.Default, "form.max_length", 255)},
+		{"too many guests", url.Values{"adults": {"2"}, "children": {"1"}}, i18n.T(i18n.Default, "form.max_occupancy", 2)},
+		{"no adults", url.Values{"adults": {"0"}}, i18n.T(i18n.Default, "form.int_range", 1, 20)},
+		{"stay rule", url.Values{"start-date": {"2045-01-02"}, "end-date": {"2045-01-03"}}, i18n.T(i18n.Default, "stay_rule.min_nights", "January 2, 2045", 2)},
+	}
 
-	ctx = getCtx(req)
-	req = req.WithContext(ctx)
+	for _, tt := range tests {
+		postedData := url.Values{
+			"start-date":   {"2050-01-01"},
+			"end-date":     {"2050-01-02"},
+			"first-name":   {"Ali"},
+			"last-name":    {"Jamal"},
+			"email":        {"aJamal@abc.com"},
+			"phone":        {"+1 (555) 555-0123"},
+			"room-type-id": {"1"},
+		}
+		for k, v := range tt.change {
+			postedData[k] = v
+		}
 
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	rr = httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
+		req = req.WithContext(getCtx(req))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
 
-	handler = http.HandlerFunc(Repo.PostReservation)
-	handler.ServeHTTP(rr, req)
+		helpers.Handler(Repo.PostReservation).ServeHTTP(rr, req)
 
-	if rr.Code != http.StatusSeeOther {
-		t.Errorf("PostReservation handler returned response code for invalid enddate: %d but wanted %d", rr.Code, http.StatusSeeOther)
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: expected the form again with 200 but got %d", tt.name, rr.Code)
+			continue
+		}
+		if !strings.Contains(html.UnescapeString(rr.Body.String()), tt.message) {
+			t.Errorf("%s: expected %q on the page", tt.name, tt.message)
+		}
 	}
 }
 
@@ -523,7 +626,7 @@ func TestRepositoryAvailabilityJSON(t *testing.T) {
 	//Rooms are not available
 	reqBody := "start=2070-01-01"
 	reqBody = fmt.Sprintf("%s&%s", reqBody, "end=2070-01-02")
-	reqBody = fmt.Sprintf("%s&%s", reqBody, "room-id=1")
+	reqBody = fmt.Sprintf("%s&%s", reqBody, "room-type-id=1")
 
 	//create request
 
@@ -557,7 +660,7 @@ func TestRepositoryAvailabilityJSON(t *testing.T) {
 	//Rooms are available
 	reqBody = "start=2040-01-01"
 	reqBody = fmt.Sprintf("%s&%s", reqBody, "end=2040-01-02")
-	reqBody = fmt.Sprintf("%s&%s", reqBody, "room-id=1")
+	reqBody = fmt.Sprintf("%s&%s", reqBody, "room-type-id=1")
 
 	//create request
 
@@ -619,7 +722,7 @@ func TestRepositoryAvailabilityJSON(t *testing.T) {
 	//Rooms are NOT available
 	reqBody = "start=2080-01-01"
 	reqBody = fmt.Sprintf("%s&%s", reqBody, "end=2080-01-02")
-	reqBody = fmt.Sprintf("%s&%s", reqBody, "room-id=1")
+	reqBody = fmt.Sprintf("%s&%s", reqBody, "room-type-id=1")
 
 	//create request
 
@@ -692,7 +795,7 @@ func TestLogin(t *testing.T) {
 		rr := httptest.NewRecorder()
 
 		//call the handler
-		handler := http.HandlerFunc(Repo.PostShowLogin)
+		handler := helpers.Handler(Repo.PostShowLogin)
 		handler.ServeHTTP(rr, req)
 
 		if rr.Code != e.expectedStatusCode {
@@ -735,9 +838,9 @@ var testPostAvailabilityData = []struct {
 	{
 		name: "rooms are available",
 		postedData: url.Values{
-			"start":   {"2040-01-01"},
-			"end":     {"2040-01-02"},
-			"room_id": {"1"},
+			"start":        {"2040-01-01"},
+			"end":          {"2040-01-02"},
+			"room-type-id": {"1"},
 		},
 		expectedStatusCode: http.StatusSeeOther,
 	},
@@ -747,7 +850,7 @@ var testPostAvailabilityData = []struct {
 			"start": {"2022BB-01-01"},
 			"end":   {"2022-01-02"},
 		},
-		expectedStatusCode: http.StatusSeeOther,
+		expectedStatusCode: http.StatusOK,
 	},
 	{
 		name: "empty data",
@@ -755,7 +858,7 @@ var testPostAvailabilityData = []struct {
 			"start": {""},
 			"end":   {"2022-01-02"},
 		},
-		expectedStatusCode: http.StatusSeeOther,
+		expectedStatusCode: http.StatusOK,
 	},
 }
 
@@ -772,7 +875,7 @@ func TestPostRoomAvailability(t *testing.T) {
 		rr := httptest.NewRecorder()
 
 		//call the handler
-		handler := http.HandlerFunc(Repo.PostAvailability)
+		handler := helpers.Handler(Repo.PostAvailability)
 		handler.ServeHTTP(rr, req)
 
 		if rr.Code != e.expectedStatusCode {
@@ -818,7 +921,7 @@ func TestBookRoom(t *testing.T) {
 		rr := httptest.NewRecorder()
 		session.Put(ctx, "reservation", reservation)
 
-		handler := http.HandlerFunc(Repo.BookRoom)
+		handler := helpers.Handler(Repo.BookRoom)
 
 		log.Print("Before handle func ", rr, req)
 		handler.ServeHTTP(rr, req)
@@ -829,6 +932,106 @@ func TestBookRoom(t *testing.T) {
 	}
 }
 
+//renewHoldTests is the data for the RenewHold handler tests. The test repo's hold 2 has
+//always run out and its rooms are all taken after 2049
+var renewHoldTests = []struct {
+	name        string
+	reservation *models.Reservation
+	holdID      int
+	expectedOK  bool
+	expectedID  int
+}{
+	{"no reservation", nil, 0, false, 0},
+	{"hold renewed", &models.Reservation{RoomTypeID: 1, StartDate: time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2040, 1, 2, 0, 0, 0, 0, time.UTC)}, 1, true, 1},
+	{"expired hold taken again", &models.Reservation{RoomTypeID: 1, StartDate: time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2040, 1, 2, 0, 0, 0, 0, time.UTC)}, 2, true, 1},
+	{"expired hold and no room", &models.Reservation{RoomTypeID: 1, StartDate: time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC)}, 2, false, 0},
+}
+
+//TestRenewHold tests the reservation form's heartbeat
+func TestRenewHold(t *testing.T) {
+	for _, e := range renewHoldTests {
+		req, _ := http.NewRequest("POST", "/make-reservation/hold", nil)
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		rr := httptest.NewRecorder()
+
+		if e.reservation != nil {
+			session.Put(ctx, "reservation", *e.reservation)
+		}
+		if e.holdID != 0 {
+			session.Put(ctx, "hold_id", e.holdID)
+		}
+
+		handler := http.HandlerFunc(Repo.RenewHold)
+		handler.ServeHTTP(rr, req)
+
+		var j jsonResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &j); err != nil {
+			t.Fatalf("%s: failed to parse json: %v", e.name, err)
+		}
+		if j.OK != e.expectedOK {
+			t.Errorf("%s: expected ok %v but got %v", e.name, e.expectedOK, j.OK)
+		}
+		if id := session.GetInt(ctx, "hold_id"); id != e.expectedID {
+			t.Errorf("%s: expected hold %d in the session but got %d", e.name, e.expectedID, id)
+		}
+	}
+}
+
+//TestPostReservationWithHold tests that a guest gets the room held for them, even when no
+//other room of the type is free
+func TestPostReservationWithHold(t *testing.T) {
+	held := models.Reservation{
+		RoomTypeID: 1,
+		RoomID:     7,
+		Room:       models.Room{ID: 7, RoomName: "Held", RoomTypeID: 1},
+		StartDate:  time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:    time.Date(2050, 1, 2, 0, 0, 0, 0, time.UTC),
+	}
+
+	postedData := url.Values{}
+	postedData.Add("start-date", "2050-01-01")
+	postedData.Add("end-date", "2050-01-02")
+	postedData.Add("first-name", "Ali")
+	postedData.Add("last-name", "Jamal")
+	postedData.Add("email", "aJamal@abc.com")
+	postedData.Add("phone", "+15555550123")
+	postedData.Add("room-type-id", "1")
+
+	tests := []struct {
+		name             string
+		holdID           int
+		expectedLocation string
+	}{
+		{"hold still valid", 1, "/checkout"},
+		{"hold ran out", 2, "/search-availability"},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/make-reservation", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		session.Put(ctx, "reservation", held)
+		session.Put(ctx, "hold_id", e.holdID)
+
+		handler := helpers.Handler(Repo.PostReservation)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != e.expectedLocation {
+			t.Errorf("%s: got %d to %q, wanted %q", e.name, rr.Code, rr.Header().Get("Location"), e.expectedLocation)
+		}
+		if e.holdID == 1 {
+			res, _ := session.Get(ctx, "reservation").(models.Reservation)
+			if res.RoomID != 7 || session.GetInt(ctx, "hold_id") != 1 {
+				t.Errorf("%s: expected the held room 7 still held for checkout, got room %d", e.name, res.RoomID)
+			}
+		}
+	}
+}
+
 //reservationSummaryTests
 var reseversationSummaryTests = []struct {
 	name               string
@@ -872,7 +1075,7 @@ func TestReservationSummary(t *testing.T) {
 		rr := httptest.NewRecorder()
 
 		//call the handler
-		handler := http.HandlerFunc(Repo.ReservationSummary)
+		handler := helpers.Handler(Repo.ReservationSummary)
 		handler.ServeHTTP(rr, req)
 
 		log.Println(rr)
@@ -882,6 +1085,34 @@ func TestReservationSummary(t *testing.T) {
 	}
 }
 
+func TestQuote(t *testing.T) {
+	stay := pricing.Stay{
+		Start:  time.Date(2046, 3, 1, 0, 0, 0, 0, time.UTC),
+		End:    time.Date(2046, 3, 3, 0, 0, 0, 0, time.UTC),
+		Adults: 2,
+	}
+	rt := models.RoomType{ID: 1, NightlyRate: 10000, IncludedGuests: 2}
+
+	//the tourist tax is charged on top, the VAT of room type 1 is in its rates already
+	q, err := Repo.quote(context.Background(), rt, stay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(q.Taxes) != 2 || q.Taxes[0].Amount != 800 || q.Taxes[1].Amount != 1818 || q.Total != 20800 {
+		t.Errorf("expected the tourist tax and included VAT for 20800, got %+v", q)
+	}
+
+	rt.ID = 2
+	if q, _ := Repo.quote(context.Background(), rt, stay); len(q.Taxes) != 1 || q.Total != 20800 {
+		t.Errorf("expected the tourist tax alone on room type 2, got %+v", q)
+	}
+
+	stay.Start, stay.End = stay.Start.AddDate(2, 0, 0), stay.End.AddDate(2, 0, 0)
+	if _, err := Repo.quote(context.Background(), rt, stay); err == nil {
+		t.Error("expected the tax rules query to fail for 2048")
+	}
+}
+
 var adminPostReservationCalendarTests = []struct {
 	name                 string
 	postedData           url.Values
@@ -956,7 +1187,7 @@ func TestPostReservationCalendar(t *testing.T) {
 		rr := httptest.NewRecorder()
 
 		// call the handler
-		handler := http.HandlerFunc(Repo.AdminPostReservationsCalendar)
+		handler := helpers.Handler(Repo.AdminPostReservationsCalendar)
 		handler.ServeHTTP(rr, req)
 
 		if rr.Code != e.expectedResponseCode {
@@ -966,6 +1197,39 @@ func TestPostReservationCalendar(t *testing.T) {
 	}
 }
 
+//TestPostReservationCalendarMoves checks that moving a reservation to a taken room, or one of
+//another type, puts an error in the session and leaves unchanged selects alone
+func TestPostReservationCalendarMoves(t *testing.T) {
+	tests := []struct {
+		name     string
+		move     url.Values
+		hasError bool
+	}{
+		{"unchanged", url.Values{"move_1_1": {"1"}}, false},
+		{"free room", url.Values{"move_1_1": {"2"}}, false},
+		{"taken room", url.Values{"move_1_1": {"3"}}, true},
+		{"other type", url.Values{"move_1_1": {"4"}}, true},
+		{"not a room", url.Values{"move_1_1": {"x"}}, false},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest("POST", "/admin/calendar", strings.NewReader(tt.move.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		helpers.Handler(Repo.AdminPostReservationsCalendar).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("%s: expected %d but got %d", tt.name, http.StatusSeeOther, rr.Code)
+		}
+		if got := session.GetString(ctx, "error") != ""; got != tt.hasError {
+			t.Errorf("%s: expected an error in the session to be %v", tt.name, tt.hasError)
+		}
+	}
+}
+
 var adminShowReservationsTests = []struct {
 	name                 string
 	expectedResponseCode int
@@ -991,7 +1255,7 @@ func TestAdminShowReservations(t *testing.T) {
 		rr := httptest.NewRecorder()
 
 		// call the handler
-		handler := http.HandlerFunc(Repo.AdminAllReservations)
+		handler := helpers.Handler(Repo.AdminAllReservations)
 		handler.ServeHTTP(rr, req)
 
 		if rr.Code != e.expectedResponseCode {
@@ -1022,7 +1286,7 @@ func TestAdminShowNewReservations(t *testing.T) {
 		rr := httptest.NewRecorder()
 
 		// call the handler
-		handler := http.HandlerFunc(Repo.AdminNewReservations)
+		handler := helpers.Handler(Repo.AdminNewReservations)
 		handler.ServeHTTP(rr, req)
 
 		if rr.Code != e.expectedResponseCode {
@@ -1077,9 +1341,122 @@ func TestAdminProcessReservation(t *testing.T) {
 	}
 }
 
+var adminPostShowReservationTests = []struct {
+	name         string
+	id           string
+	phone        string
+	expectedCode int
+}{
+	{"unchanged unchecked phone", "9", "555-555-5555", http.StatusSeeOther},
+	{"changed to a valid phone", "9", "+1 555 555 0123", http.StatusSeeOther},
+	{"changed to an invalid phone", "9", "call me", http.StatusOK},
+	{"new invalid phone", "1", "555-555-5555", http.StatusOK},
+}
+
+func TestAdminPostShowReservation(t *testing.T) {
+	for _, e := range adminPostShowReservationTests {
+		postedData := url.Values{
+			"first-name": {"Ali"},
+			"last-name":  {"Jamal"},
+			"email":      {"aJamal@abc.com"},
+			"phone":      {e.phone},
+		}
+
+		req := httptest.NewRequest("POST", "/admin/reservations/new/"+e.id, strings.NewReader(postedData.Encode()))
+		req = req.WithContext(getCtx(req))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		helpers.Handler(Repo.AdminPostShowReservation).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected code %d but got %d", e.name, e.expectedCode, rr.Code)
+		}
+		if e.expectedCode == http.StatusOK && !strings.Contains(html.UnescapeString(rr.Body.String()), i18n.T(i18n.Default, "form.phone")) {
+			t.Errorf("%s: expected the phone error on the page", e.name)
+		}
+	}
+}
+
+var adminDeleteReservationTests = []struct {
+	name        string
+	id          string
+	expectedKey string
+}{
+	{"deleted", "1", "flash"},
+	{"paid or invoiced", "5", "error"},
+	{"delete fails", "6", "error"},
+}
+
+func TestAdminDeleteReservation(t *testing.T) {
+	for _, e := range adminDeleteReservationTests {
+		req, _ := http.NewRequest("GET", "/admin/delete-reservation/new/"+e.id+"/do", nil)
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("src", "new")
+		rctx.URLParams.Add("id", e.id)
+		ctx := context.WithValue(getCtx(req), chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.AdminDeleteReservation).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("%s: expected code %d but got %d", e.name, http.StatusSeeOther, rr.Code)
+		}
+		if session.GetString(ctx, e.expectedKey) == "" {
+			t.Errorf("%s: expected a message in the session's %s", e.name, e.expectedKey)
+		}
+	}
+}
+
+var setLanguageTests = []struct {
+	name           string
+	locale         string
+	referer        string
+	expectedLocale string
+	expectedURL    string
+}{
+	{"supported locale", "es", "https://example.com/about?x=1", "es", "/about?x=1"},
+	{"unsupported locale", "xx", "https://example.com/about", "", "/about"},
+	{"other site referer", "es", "https://evil.example.org/phish", "es", "/"},
+	{"no referer", "es", "", "es", "/"},
+}
+
+func TestSetLanguage(t *testing.T) {
+	for _, e := range setLanguageTests {
+		req, _ := http.NewRequest("GET", "https://example.com/language/"+e.locale, nil)
+		req.Host = "example.com"
+		if e.referer != "" {
+			req.Header.Set("Referer", e.referer)
+		}
+
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("locale", e.locale)
+		ctx := context.WithValue(getCtx(req), chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(Repo.SetLanguage).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("%s: expected code %d but got %d", e.name, http.StatusSeeOther, rr.Code)
+		}
+		if loc := rr.Header().Get("Location"); loc != e.expectedURL {
+			t.Errorf("%s: expected redirect to %s but got %s", e.name, e.expectedURL, loc)
+		}
+		if got := session.GetString(ctx, "locale"); got != e.expectedLocale {
+			t.Errorf("%s: expected locale %q in the session but got %q", e.name, e.expectedLocale, got)
+		}
+	}
+}
+
 func TestNewRepo(t *testing.T) {
 	var db driver.DB
-	testRepo := NewRepo(&app, &db)
+	testRepo, err := NewRepo(&app, &db)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	if reflect.TypeOf(testRepo).String() != "*handlers.Repository" {
 		t.Errorf("Did not get correct type from NewRepo: got %s, wanted *Repository", reflect.TypeOf(testRepo).String())
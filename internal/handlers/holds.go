@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/darinmilner/goserver/internal/logging"
+	"github.com/darinmilner/goserver/internal/models"
+	"github.com/darinmilner/goserver/internal/repository"
+)
+
+//A guest who picks a room type gets a hold on one of its rooms, kept in the session as
+//hold_id, so nobody else can book it while they fill in the reservation form. The form
+//renews the hold on every load and from a heartbeat, and the hold is released once the
+//reservation is made. Holds nobody renews run out and are swept up in the background
+
+//holdRoom holds a free room of res's type for its dates and puts the room in res, releasing
+//any hold the guest already had. It reports false when every room of the type is taken
+func (m *Repository) holdRoom(r *http.Request, res *models.Reservation) (bool, error) {
+	m.releaseHold(r)
+
+	hold, err := m.DB.HoldRoom(r.Context(), res.RoomTypeID, res.StartDate, res.EndDate, m.App.HoldLifetime)
+	if errors.Is(err, repository.ErrRoomNotFree) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	res.RoomID = hold.RoomID
+	res.Room = hold.Room
+	m.App.Session.Put(r.Context(), "hold_id", hold.ID)
+	return true, nil
+}
+
+//showBookedHold sends the guest to the summary when their hold has already been booked, by
+//the checkout form sent twice. It reports whether it did
+func (m *Repository) showBookedHold(w http.ResponseWriter, r *http.Request, res models.Reservation) (bool, error) {
+	holdID := m.App.Session.GetInt(r.Context(), "hold_id")
+	if holdID == 0 {
+		return false, nil
+	}
+
+	booked, err := m.DB.GetReservationByHold(r.Context(), holdID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	res.ID = booked.ID
+	res.AccessToken = booked.AccessToken
+	m.App.Session.Remove(r.Context(), "hold_id")
+	m.App.Session.Put(r.Context(), "reservation", res)
+	http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
+	return true, nil
+}
+
+//renewHold extends the guest's hold, or takes a new one on res when it has run out
+func (m *Repository) renewHold(r *http.Request, res *models.Reservation) (bool, error) {
+	if id := m.App.Session.GetInt(r.Context(), "hold_id"); id != 0 {
+		err := m.DB.ExtendHold(r.Context(), id, m.App.HoldLifetime)
+		if err == nil {
+			return true, nil
+		}
+		if !errors.Is(err, repository.ErrHoldExpired) {
+			return false, err
+		}
+	}
+	return m.holdRoom(r, res)
+}
+
+//releaseHold releases the guest's hold, if any. A hold that can't be deleted runs out on its
+//own, so failing is only logged
+func (m *Repository) releaseHold(r *http.Request) {
+	id := m.App.Session.PopInt(r.Context(), "hold_id")
+	if id == 0 {
+		return
+	}
+	if err := m.DB.ReleaseHold(r.Context(), id); err != nil {
+		logging.FromContext(r.Context()).Error("releasing hold", slog.Int("hold_id", id), slog.Any("error", err))
+	}
+}
+
+//RenewHold is the reservation form's heartbeat, it keeps the guest's room held while the
+//form is open and answers whether it still is
+func (m *Repository) RenewHold(w http.ResponseWriter, r *http.Request) {
+	resp := jsonResponse{OK: true}
+
+	res, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
+	if !ok {
+		resp = jsonResponse{OK: false, Message: translate(r, "flash.no_reservation")}
+	} else {
+		held, err := m.renewHold(r, &res)
+		switch {
+		case err != nil:
+			logging.FromContext(r.Context()).Error("renewing hold", slog.Any("error", err))
+			resp = jsonResponse{OK: false, Message: "Error querying database"}
+		case !held:
+			resp = jsonResponse{OK: false, Message: translate(r, "flash.hold_lost")}
+		default:
+			m.App.Session.Put(r.Context(), "reservation", res)
+		}
+	}
+
+	out, _ := json.MarshalIndent(resp, "", "\t")
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+}
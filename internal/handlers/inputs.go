@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"time"
+)
+
+//The structs below are the forms the handlers bind posts into with forms.Bind. The validate
+//tags hold the rules, see forms.Bind for the list. A party that isn't posted is one adult,
+//see party
+
+//reservationInput is the make reservation form. The dates and room type come from hidden fields
+type reservationInput struct {
+	StartDate  time.Time `form:"start-date" validate:"required,notpast"`
+	EndDate    time.Time `form:"end-date" validate:"required,after=start-date"`
+	RoomTypeID int       `form:"room-type-id" validate:"required"`
+	FirstName  string    `form:"first-name" validate:"required,min=3,max=255"`
+	LastName   string    `form:"last-name" validate:"required,max=255"`
+	Email      string    `form:"email" validate:"required,email,max=255"`
+	Phone      string    `form:"phone" validate:"phone,max=255"`
+	Adults     int       `form:"adults" validate:"range=1:20"`
+	Children   int       `form:"children" validate:"range=0:20"`
+}
+
+//checkoutInput is the checkout form. PaymentMethod is the provider's token for the guest's card,
+//only needed when there is a deposit to pay
+type checkoutInput struct {
+	PaymentMethod string `form:"payment-method" validate:"max=255"`
+}
+
+//searchInput is the search availability form
+type searchInput struct {
+	Start    time.Time `form:"start" validate:"required,notpast"`
+	End      time.Time `form:"end" validate:"required,after=start"`
+	Adults   int       `form:"adults" validate:"range=1:20"`
+	Children int       `form:"children" validate:"range=0:20"`
+}
+
+//roomAvailabilityInput is the availability check on the room pages
+type roomAvailabilityInput struct {
+	Start      time.Time `form:"start" validate:"required"`
+	End        time.Time `form:"end" validate:"required,after=start"`
+	RoomTypeID int       `form:"room-type-id" validate:"required"`
+	Adults     int       `form:"adults" validate:"range=1:20"`
+	Children   int       `form:"children" validate:"range=0:20"`
+}
+
+//bookRoomInput is the query of the book room link on the choose room page
+type bookRoomInput struct {
+	Start      time.Time `form:"s" validate:"required"`
+	End        time.Time `form:"e" validate:"required,after=s"`
+	RoomTypeID int       `form:"id" validate:"required"`
+}
+
+//adminReservationInput is the guest details form of the admin reservation page. The phone is
+//only checked when it is changed, see AdminPostShowReservation
+type adminReservationInput struct {
+	FirstName string `form:"first-name" validate:"required,max=255"`
+	LastName  string `form:"last-name" validate:"required,max=255"`
+	Email     string `form:"email" validate:"required,email,max=255"`
+	Phone     string `form:"phone" validate:"max=255"`
+	Year      string `form:"year"`
+	Month     string `form:"month"`
+}
+
+//adminCancelInput is the cancel form of the admin reservation page
+type adminCancelInput struct {
+	Reason string `form:"reason" validate:"required,max=1000"`
+	Year   string `form:"year"`
+	Month  string `form:"month"`
+}
+
+//myCancelInput is the cancel form of the guest's reservation page, the reason is up to them
+type myCancelInput struct {
+	Reason string `form:"reason" validate:"max=1000"`
+}
+
+//adminIssueInput is the issue invoice form of the admin reservation page
+type adminIssueInput struct {
+	Year  string `form:"year"`
+	Month string `form:"month"`
+}
+
+//party returns the adults and children of a form, counting one adult when none were posted
+//since the room pages only ask for dates
+func party(adults, children int) (int, int) {
+	if adults == 0 {
+		adults = 1
+	}
+	return adults, children
+}
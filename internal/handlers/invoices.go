@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/darinmilner/goserver/internal/forms"
+	"github.com/darinmilner/goserver/internal/helpers"
+	"github.com/darinmilner/goserver/internal/invoice"
+	"github.com/darinmilner/goserver/internal/models"
+	"github.com/darinmilner/goserver/internal/payments"
+	"github.com/darinmilner/goserver/internal/render"
+	"github.com/go-chi/chi"
+)
+
+//MyReservation is the guest's own page for their reservation, reached by the link in their
+//confirmation email. It shows what they booked and paid, lets them cancel it and links to the
+//invoice once issued
+func (m *Repository) MyReservation(w http.ResponseWriter, r *http.Request) error {
+	res, err := m.reservationByToken(r)
+	if err != nil {
+		return err
+	}
+
+	view, _, err := m.myReservationView(r, res)
+	if err != nil {
+		return err
+	}
+
+	return render.Template(w, r, "my-reservation.page.html", &models.TemplateData{
+		View: view,
+		Form: forms.New(nil),
+	})
+}
+
+//myReservationView returns the guest's page for res and the payments it was worked out from
+func (m *Repository) myReservationView(r *http.Request, res models.Reservation) (models.MyReservationView, []models.Payment, error) {
+	view := models.MyReservationView{Reservation: res}
+
+	records, err := m.DB.PaymentsForReservation(r.Context(), res.ID)
+	if err != nil {
+		return view, nil, err
+	}
+	view.Paid = payments.Paid(records)
+	view.Balance = res.Total - view.Paid
+
+	view.Invoice, err = m.DB.GetInvoiceByReservationID(r.Context(), res.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return view, nil, err
+	}
+
+	if !res.Cancelled() {
+		view.Policy, view.Cancel, err = m.cancelTerms(r, res, view.Paid)
+	}
+	return view, records, err
+}
+
+//MyInvoice downloads the invoice of the reservation a guest's link opens, a 404 until the owner
+//has issued it
+func (m *Repository) MyInvoice(w http.ResponseWriter, r *http.Request) error {
+	res, err := m.reservationByToken(r)
+	if err != nil {
+		return err
+	}
+	return m.writeInvoice(w, r, res)
+}
+
+//AdminInvoice downloads the invoice of a reservation from the admin reservation page
+func (m *Repository) AdminInvoice(w http.ResponseWriter, r *http.Request) error {
+	res, err := m.adminReservation(r)
+	if err != nil {
+		return err
+	}
+	return m.writeInvoice(w, r, res)
+}
+
+//AdminIssueInvoice issues the invoice of a reservation from the admin reservation page, billing
+//it as it stands. Its number and what it bills don't change after that, and the reservation
+//can't be deleted any more
+func (m *Repository) AdminIssueInvoice(w http.ResponseWriter, r *http.Request) error {
+	var input adminIssueInput
+	if _, err := forms.Bind(r, &input); err != nil {
+		return helpers.WithStatus(http.StatusBadRequest, err)
+	}
+
+	res, err := m.adminReservation(r)
+	if err != nil {
+		return err
+	}
+
+	records, err := m.DB.PaymentsForReservation(r.Context(), res.ID)
+	if err != nil {
+		return err
+	}
+
+	var c models.Cancellation
+	if res.Cancelled() {
+		c, err = m.DB.GetCancellationByReservationID(r.Context(), res.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	issued, err := m.DB.IssueInvoice(r.Context(), invoice.Bill(res, records, c))
+	if err != nil {
+		return err
+	}
+
+	m.App.Session.Put(r.Context(), "flash", translate(r, "flash.invoice_issued", invoice.Number(m.App.Invoice.Prefix, issued.Number)))
+	show := fmt.Sprintf("/admin/reservations/%s/%d/show", chi.URLParam(r, "src"), res.ID)
+	if input.Year != "" {
+		show += "?" + url.Values{"y": {input.Year}, "m": {input.Month}}.Encode()
+	}
+	http.Redirect(w, r, show, http.StatusSeeOther)
+	return nil
+}
+
+//adminReservation returns the reservation whose id is in the URL, a 404 when there is none
+func (m *Repository) adminReservation(r *http.Request) (models.Reservation, error) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		return models.Reservation{}, helpers.WithStatus(http.StatusNotFound, err)
+	}
+
+	res, err := m.DB.GetReservationByID(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return res, helpers.WithStatus(http.StatusNotFound, err)
+	}
+	return res, err
+}
+
+//reservationByToken returns the reservation the token in the URL opens, a 404 when it opens none
+func (m *Repository) reservationByToken(r *http.Request) (models.Reservation, error) {
+	res, err := m.DB.GetReservationByToken(r.Context(), chi.URLParam(r, "token"))
+	if errors.Is(err, sql.ErrNoRows) {
+		return res, helpers.WithStatus(http.StatusNotFound, err)
+	}
+	return res, err
+}
+
+//writeInvoice sends the invoice issued for res as a PDF in the guest's language, as it was
+//issued. It is a 404 when none has been
+func (m *Repository) writeInvoice(w http.ResponseWriter, r *http.Request, res models.Reservation) error {
+	issued, err := m.DB.GetInvoiceByReservationID(r.Context(), res.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return helpers.WithStatus(http.StatusNotFound, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	records, err := m.DB.PaymentsForReservation(r.Context(), res.ID)
+	if err != nil {
+		return err
+	}
+
+	number := invoice.Number(m.App.Invoice.Prefix, issued.Number)
+	inv := invoice.Build(number, issued, res, records)
+
+	//rendered in full first, so a failure is still an error page rather than half a file
+	var buf bytes.Buffer
+	if err := invoice.Render(&buf, inv, res.Locale, m.App.Invoice); err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", number+".pdf"))
+	_, err = buf.WriteTo(w)
+	return err
+}
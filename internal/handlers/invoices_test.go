@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/darinmilner/goserver/internal/helpers"
+	"github.com/go-chi/chi"
+)
+
+func TestMyReservation(t *testing.T) {
+	tests := []struct {
+		name         string
+		token        string
+		expectedCode int
+	}{
+		{"found", "5L3t0k3n", http.StatusOK},
+		{"not invoiced yet", "uninvoiced", http.StatusOK},
+		{"cancelled", "cancelled", http.StatusOK},
+		{"arrived", "arrived", http.StatusOK},
+		{"unknown token", "unknown", http.StatusNotFound},
+		{"lookup fails", "fails", http.StatusInternalServerError},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/my-reservation/"+e.token, nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("token", e.token)
+		req = req.WithContext(context.WithValue(getCtx(req), chi.RouteCtxKey, rctx))
+		rr := httptest.NewRecorder()
+
+		helpers.Handler(Repo.MyReservation).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected %d but got %d", e.name, e.expectedCode, rr.Code)
+			continue
+		}
+		if rr.Code != http.StatusOK {
+			continue
+		}
+		//the download is only offered once the invoice has been issued
+		if strings.Contains(rr.Body.String(), e.token+"/invoice") != (e.token != "uninvoiced") {
+			t.Errorf("%s: the invoice link is wrongly shown or left off", e.name)
+		}
+		//and cancelling until the day of arrival
+		if strings.Contains(rr.Body.String(), e.token+"/cancel") != (e.token != "cancelled" && e.token != "arrived") {
+			t.Errorf("%s: the cancel form is wrongly shown or left off", e.name)
+		}
+	}
+}
+
+func TestInvoices(t *testing.T) {
+	tests := []struct {
+		name         string
+		handler      func(http.ResponseWriter, *http.Request) error
+		param        string
+		value        string
+		expectedCode int
+	}{
+		{"guest", Repo.MyInvoice, "token", "5L3t0k3n", http.StatusOK},
+		{"guest, not issued", Repo.MyInvoice, "token", "uninvoiced", http.StatusNotFound},
+		{"guest with unknown token", Repo.MyInvoice, "token", "unknown", http.StatusNotFound},
+		{"admin", Repo.AdminInvoice, "id", "1", http.StatusOK},
+		{"admin, cancelled", Repo.AdminInvoice, "id", "7", http.StatusOK},
+		{"admin, not issued", Repo.AdminInvoice, "id", "2", http.StatusNotFound},
+		{"admin, reading fails", Repo.AdminInvoice, "id", "10", http.StatusInternalServerError},
+		{"admin, bad id", Repo.AdminInvoice, "id", "x", http.StatusNotFound},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/invoice", nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("src", "all")
+		rctx.URLParams.Add(e.param, e.value)
+		req = req.WithContext(context.WithValue(getCtx(req), chi.RouteCtxKey, rctx))
+		rr := httptest.NewRecorder()
+
+		helpers.Handler(e.handler).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected %d but got %d", e.name, e.expectedCode, rr.Code)
+			continue
+		}
+		if rr.Code != http.StatusOK {
+			continue
+		}
+		if rr.Header().Get("Content-Type") != "application/pdf" || !bytes.HasPrefix(rr.Body.Bytes(), []byte("%PDF-")) {
+			t.Errorf("%s: expected a PDF but got %s", e.name, rr.Header().Get("Content-Type"))
+		}
+		if got := rr.Header().Get("Content-Disposition"); got != `attachment; filename="INV-000042.pdf"` {
+			t.Errorf("%s: expected invoice 42 but got %s", e.name, got)
+		}
+	}
+}
+
+func TestAdminIssueInvoice(t *testing.T) {
+	tests := []struct {
+		name             string
+		id               string
+		postedData       url.Values
+		expectedCode     int
+		expectedLocation string
+	}{
+		{"from the list", "2", url.Values{}, http.StatusSeeOther, "/admin/reservations/all/2/show"},
+		{"from the calendar", "2", url.Values{"year": {"2040"}, "month": {"01"}}, http.StatusSeeOther, "/admin/reservations/all/2/show?m=01&y=2040"},
+		{"cancelled", "7", url.Values{}, http.StatusSeeOther, "/admin/reservations/all/7/show"},
+		{"issuing fails", "3", url.Values{}, http.StatusInternalServerError, ""},
+		{"bad id", "x", url.Values{}, http.StatusNotFound, ""},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/admin/reservations/all/"+e.id+"/invoice", strings.NewReader(e.postedData.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("src", "all")
+		rctx.URLParams.Add("id", e.id)
+		ctx := context.WithValue(getCtx(req), chi.RouteCtxKey, rctx)
+		req = req.WithContext(ctx)
+		rr := httptest.NewRecorder()
+
+		helpers.Handler(Repo.AdminIssueInvoice).ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedCode {
+			t.Errorf("%s: expected %d but got %d", e.name, e.expectedCode, rr.Code)
+			continue
+		}
+		if e.expectedLocation == "" {
+			continue
+		}
+		if loc := rr.Header().Get("Location"); loc != e.expectedLocation {
+			t.Errorf("%s: expected location %s but got %s", e.name, e.expectedLocation, loc)
+		}
+		if flash := session.PopString(ctx, "flash"); flash != "Invoice INV-000042 issued" {
+			t.Errorf("%s: expected the invoice number flashed but got %q", e.name, flash)
+		}
+	}
+}
@@ -13,6 +13,9 @@ import (
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/darinmilner/goserver/internal/config"
+	"github.com/darinmilner/goserver/internal/helpers"
+	"github.com/darinmilner/goserver/internal/i18n"
+	"github.com/darinmilner/goserver/internal/logging"
 	"github.com/darinmilner/goserver/internal/models"
 	"github.com/darinmilner/goserver/internal/render"
 	"github.com/go-chi/chi"
@@ -27,7 +30,12 @@ var functions = template.FuncMap{
 	"humanDate":  render.HumanDate,
 	"formatDate": render.FormatDate,
 	"iterate":    render.Iterate,
+	"asset":      render.Asset,
+	"t":          i18n.T,
+	"date":       i18n.FormatDate,
+	"locales":    i18n.Supported,
 	"add":        render.Add,
+	"money":      render.Money,
 }
 
 const pathToTemplates = "./../../templates"
@@ -42,12 +50,7 @@ func TestMain(m *testing.M) {
 	//Change to true when in production
 	app.InProduction = false
 
-	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
-
-	app.InfoLog = infoLog
-
-	errorLog := log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
-	app.ErrorLog = errorLog
+	app.Logger = logging.New(app.InProduction, os.Stdout)
 
 	session = scs.New()
 	session.Lifetime = 24 * time.Hour
@@ -57,6 +60,10 @@ func TestMain(m *testing.M) {
 	session.Cookie.Secure = app.InProduction //True in Production
 
 	app.Session = session
+	app.HoldLifetime = 15 * time.Minute
+	app.Payments = config.PaymentsConfig{Provider: "fake", Currency: "usd", DepositPercent: 30}
+	app.PublicURL = "http://localhost:8080"
+	app.Invoice = config.InvoiceConfig{Prefix: "INV-", Issuer: "The Fort Hotel"}
 
 	mailChan := make(chan models.MailData)
 	app.MailChan = mailChan
@@ -100,39 +107,52 @@ func getRoutes() http.Handler {
 	//mux.Use(NoSurf)
 	mux.Use(SessionLoad)
 
-	mux.Get("/", Repo.Home)
-	mux.Get("/about", Repo.About)
-	mux.Get("/generals-quarters", Repo.Generals)
-	mux.Get("/majors-suite", Repo.Majors)
+	mux.Method(http.MethodGet, "/", helpers.Handler(Repo.Home))
+	mux.Method(http.MethodGet, "/about", helpers.Handler(Repo.About))
+	mux.Method(http.MethodGet, "/generals-quarters", helpers.Handler(Repo.Generals))
+	mux.Method(http.MethodGet, "/majors-suite", helpers.Handler(Repo.Majors))
 
-	mux.Get("/search-availability", Repo.Availability)
-	mux.Post("/search-availability", Repo.PostAvailability)
+	mux.Method(http.MethodGet, "/search-availability", helpers.Handler(Repo.Availability))
+	mux.Method(http.MethodPost, "/search-availability", helpers.Handler(Repo.PostAvailability))
 	mux.Post("/search-availability-json", Repo.AvailabilityJSON)
 	mux.Get("/choose-room/{id}", Repo.ChooseRoom)
-	mux.Get("/book-room", Repo.BookRoom)
-
-	mux.Get("/contact", Repo.Contact)
-	mux.Get("/make-reservation", Repo.Reservation)
-	mux.Post("/make-reservation", Repo.PostReservation)
-	mux.Get("/reservation-summary", Repo.ReservationSummary)
-
-	mux.Get("/user/login", Repo.ShowLogin)
-	mux.Post("/user/login", Repo.PostShowLogin)
+	mux.Method(http.MethodGet, "/book-room", helpers.Handler(Repo.BookRoom))
+
+	mux.Method(http.MethodGet, "/contact", helpers.Handler(Repo.Contact))
+	mux.Method(http.MethodGet, "/make-reservation", helpers.Handler(Repo.Reservation))
+	mux.Method(http.MethodPost, "/make-reservation", helpers.Handler(Repo.PostReservation))
+	mux.Post("/make-reservation/hold", Repo.RenewHold)
+	mux.Method(http.MethodGet, "/checkout", helpers.Handler(Repo.Checkout))
+	mux.Method(http.MethodPost, "/checkout", helpers.Handler(Repo.PostCheckout))
+	mux.Post("/payments/webhook", Repo.PaymentWebhook)
+	mux.Method(http.MethodGet, "/reservation-summary", helpers.Handler(Repo.ReservationSummary))
+	mux.Method(http.MethodGet, "/my-reservation/{token}", helpers.Handler(Repo.MyReservation))
+	mux.Method(http.MethodGet, "/my-reservation/{token}/invoice", helpers.Handler(Repo.MyInvoice))
+	mux.Method(http.MethodPost, "/my-reservation/{token}/cancel", helpers.Handler(Repo.MyCancelReservation))
+
+	mux.Method(http.MethodGet, "/user/login", helpers.Handler(Repo.ShowLogin))
+	mux.Method(http.MethodPost, "/user/login", helpers.Handler(Repo.PostShowLogin))
 
 	mux.Get("/user/logout", Repo.Logout)
 
-	mux.Get("/admin/dashboard", Repo.AdminDashboard)
+	mux.Method(http.MethodGet, "/admin/dashboard", helpers.Handler(Repo.AdminDashboard))
 
-	mux.Get("/admin/new-reservations", Repo.AdminNewReservations)
-	mux.Get("/admin/all-reservations", Repo.AdminAllReservations)
-	mux.Get("/admin/calendar", Repo.AdminReservationsCalendar)
-	mux.Post("/admin/calendar", Repo.AdminPostReservationsCalendar)
+	mux.Method(http.MethodGet, "/admin/new-reservations", helpers.Handler(Repo.AdminNewReservations))
+	mux.Method(http.MethodGet, "/admin/all-reservations", helpers.Handler(Repo.AdminAllReservations))
+	mux.Method(http.MethodGet, "/admin/calendar", helpers.Handler(Repo.AdminReservationsCalendar))
+	mux.Method(http.MethodPost, "/admin/calendar", helpers.Handler(Repo.AdminPostReservationsCalendar))
 
 	mux.Get("/admin/process-reservation/{src}/{id}/do", Repo.AdminProcessReservation)
 	mux.Get("/admin/delete-reservation/{src}/{id}/do", Repo.AdminDeleteReservation)
 
-	mux.Get("/admin/reservations/{src}/{id}/show", Repo.AdminShowReservation)
-	mux.Post("/admin/reservations/{src}/{id}", Repo.AdminPostShowReservation)
+	mux.Method(http.MethodGet, "/admin/reservations/{src}/{id}/show", helpers.Handler(Repo.AdminShowReservation))
+	mux.Method(http.MethodPost, "/admin/reservations/{src}/{id}", helpers.Handler(Repo.AdminPostShowReservation))
+	mux.Method(http.MethodPost, "/admin/reservations/{src}/{id}/cancel", helpers.Handler(Repo.AdminCancelReservation))
+	mux.Method(http.MethodGet, "/admin/reservations/{src}/{id}/invoice", helpers.Handler(Repo.AdminInvoice))
+	mux.Method(http.MethodPost, "/admin/reservations/{src}/{id}/invoice", helpers.Handler(Repo.AdminIssueInvoice))
+
+	mux.NotFound(Repo.NotFound)
+	mux.MethodNotAllowed(Repo.MethodNotAllowed)
 
 	fileServer := http.FileServer(http.Dir("./static/"))
 
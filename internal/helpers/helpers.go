@@ -1,11 +1,17 @@
 package helpers
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"runtime/debug"
 
 	"github.com/darinmilner/goserver/internal/config"
+	"github.com/darinmilner/goserver/internal/logging"
+	"github.com/darinmilner/goserver/internal/render"
+	"github.com/go-chi/chi"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -16,19 +22,105 @@ func NewHelpers(a *config.AppConfig) {
 	app = a
 }
 
-func ClientError(w http.ResponseWriter, status int) {
-	app.InfoLog.Println("Client error with status of", status)
-	http.Error(w, http.StatusText(status), status)
+//StatusError is an error answered with Status instead of a 500
+type StatusError struct {
+	Status int
+	Err    error
 }
 
-func ServerError(w http.ResponseWriter, err error) {
-	trace := fmt.Sprintf("%s\n %s", err.Error(), debug.Stack())
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%d %s: %v", e.Status, http.StatusText(e.Status), e.Err)
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+//WithStatus wraps err so Error responds with status
+func WithStatus(status int, err error) error {
+	return &StatusError{Status: status, Err: err}
+}
+
+//Handler is an http handler that returns its error instead of writing it. Error turns
+//the error into a response
+type Handler func(w http.ResponseWriter, r *http.Request) error
+
+func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := h(w, r); err != nil {
+		Error(w, r, err)
+	}
+}
+
+//Error responds to err with the error page for its status. A StatusError carries the status,
+//sql.ErrNoRows is a 404 and anything else is a 500
+func Error(w http.ResponseWriter, r *http.Request, err error) {
+	var se *StatusError
+	switch {
+	case errors.As(err, &se) && se.Status < http.StatusInternalServerError:
+		clientError(w, r, se.Status, err)
+	case errors.Is(err, sql.ErrNoRows):
+		clientError(w, r, http.StatusNotFound, err)
+	default:
+		ServerError(w, r, err)
+	}
+}
 
-	app.ErrorLog.Println(trace)
+//ClientError logs a client error and sends the error page for status
+func ClientError(w http.ResponseWriter, r *http.Request, status int) {
+	clientError(w, r, status, nil)
+}
+
+func clientError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	attrs := []any{
+		slog.Int("status", status),
+		slog.String("route", routePattern(r)),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.Any("chain", ErrorChain(err)))
+	}
+	logging.FromContext(r.Context()).Info("client error", attrs...)
+
+	render.ErrorPage(w, r, status)
+}
+
+//ServerError logs err with its chain and a stack trace and sends the 500 error page, which
+//shows err outside production.
+//The request logger already carries the request ID and, once LogUser has run, the user ID
+func ServerError(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusInternalServerError
+	var se *StatusError
+	if errors.As(err, &se) {
+		status = se.Status
+	}
 
-	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	logging.FromContext(r.Context()).Error("server error",
+		slog.Int("status", status),
+		slog.String("route", routePattern(r)),
+		slog.String("error", err.Error()),
+		slog.Any("chain", ErrorChain(err)),
+		slog.String("stack", string(debug.Stack())),
+	)
 
+	render.ErrorDetails(w, r, status, err)
 }
+
+//ErrorChain returns the message of err and of every error it wraps
+func ErrorChain(err error) []string {
+	var chain []string
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		chain = append(chain, fmt.Sprintf("%T: %s", e, e.Error()))
+	}
+	return chain
+}
+
+//routePattern returns the chi route pattern of r, or the path if r was not routed by chi
+func routePattern(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+		return rctx.RoutePattern()
+	}
+	return r.URL.Path
+}
+
 func IsAuthenticated(r *http.Request) bool {
 	exists := app.Session.Exists(r.Context(), "userId")
 	return exists
@@ -0,0 +1,175 @@
+//Package i18n holds the message catalogs for the guest facing site and mail, and picks the
+//locale for each request
+package i18n
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+//Default is the locale used when nothing better matches, and for keys another catalog lacks
+const Default = "en"
+
+//catalogFiles holds one YAML file per locale, named after the locale
+//go:embed locales/*.yml
+var catalogFiles embed.FS
+
+//catalogs maps a locale to its messages, keyed by the dotted path of the message in the YAML file
+var catalogs = mustLoad(catalogFiles)
+
+func mustLoad(fsys fs.FS) map[string]map[string]string {
+	c, err := load(fsys)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func load(fsys fs.FS) (map[string]map[string]string, error) {
+	names, err := fs.Glob(fsys, "locales/*.yml")
+	if err != nil {
+		return nil, err
+	}
+
+	c := make(map[string]map[string]string)
+	for _, name := range names {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+
+		var raw map[string]interface{}
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("i18n: %s: %w", name, err)
+		}
+
+		messages := make(map[string]string)
+		flatten("", raw, messages)
+		c[strings.TrimSuffix(path.Base(name), ".yml")] = messages
+	}
+
+	if _, ok := c[Default]; !ok {
+		return nil, fmt.Errorf("i18n: no catalog for the default locale %s", Default)
+	}
+	return c, nil
+}
+
+func flatten(prefix string, in map[string]interface{}, out map[string]string) {
+	for k, v := range in {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+
+		switch x := v.(type) {
+		case map[interface{}]interface{}:
+			nested := make(map[string]interface{})
+			for nk, nv := range x {
+				nested[fmt.Sprint(nk)] = nv
+			}
+			flatten(key, nested, out)
+		default:
+			out[key] = fmt.Sprint(x)
+		}
+	}
+}
+
+//Supported returns the locales that have a catalog, sorted
+func Supported() []string {
+	var locales []string
+	for l := range catalogs {
+		locales = append(locales, l)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+//IsSupported reports whether locale has a catalog
+func IsSupported(locale string) bool {
+	_, ok := catalogs[locale]
+	return ok
+}
+
+//Lookup returns the message for key in locale, or from the Default catalog when the locale's
+//catalog lacks it
+func Lookup(locale, key string) (string, bool) {
+	if msg, ok := catalogs[locale][key]; ok {
+		return msg, true
+	}
+	msg, ok := catalogs[Default][key]
+	return msg, ok
+}
+
+//T returns the message for key in locale, formatted with args like fmt.Sprintf.
+//A key no catalog has is returned as is, so it stands out on the page
+func T(locale, key string, args ...interface{}) string {
+	msg, ok := Lookup(locale, key)
+	if !ok {
+		return key
+	}
+
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
+
+//FormatDate formats t with the "date.format" layout of locale. A {month} in the layout is
+//replaced with the month name from the catalog, since time.Format only knows English names
+func FormatDate(locale string, t time.Time) string {
+	s := t.Format(T(locale, "date.format"))
+	if strings.Contains(s, "{month}") {
+		s = strings.Replace(s, "{month}", T(locale, "month."+strconv.Itoa(int(t.Month()))), 1)
+	}
+	return s
+}
+
+//Negotiate returns the supported locale that best matches an Accept-Language header.
+//Regions are ignored, so es-MX matches es. It returns Default when nothing matches
+func Negotiate(acceptLanguage string) string {
+	best, bestQ := Default, 0.0
+
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		base, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		if q > bestQ && IsSupported(base) {
+			best, bestQ = base, q
+		}
+	}
+
+	return best
+}
+
+type contextKey struct{}
+
+//WithLocale returns a copy of ctx carrying locale
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, contextKey{}, locale)
+}
+
+//Locale returns the locale stored in ctx, or Default
+func Locale(ctx context.Context) string {
+	if l, ok := ctx.Value(contextKey{}).(string); ok {
+		return l
+	}
+	return Default
+}
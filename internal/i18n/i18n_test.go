@@ -0,0 +1,103 @@
+package i18n
+
+import (
+	"context"
+	"io/fs"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/darinmilner/goserver/templates"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", "en"},
+		{"es", "es"},
+		{"es-MX,es;q=0.9,en;q=0.8", "es"},
+		{"fr-FR,fr;q=0.9,en;q=0.5,es;q=0.7", "es"},
+		{"de", "en"},
+		{"es;q=0, en;q=0.1", "en"},
+		{"es;q=bogus", "en"},
+	}
+
+	for _, tt := range tests {
+		if got := Negotiate(tt.header); got != tt.want {
+			t.Errorf("Negotiate(%q) = %s, want %s", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	if got := T("es", "nav.home"); got != "Inicio" {
+		t.Errorf("expected Inicio but got %s", got)
+	}
+	if got := T("es", "form.min_length", 3); got != "Este campo debe tener al menos 3 caracteres" {
+		t.Errorf("arguments were not formatted: %s", got)
+	}
+	if got := T("es", "email.confirmation.owner", "a", "b", "c", "d", "e"); got == "email.confirmation.owner" {
+		t.Error("keys missing from es should fall back to en")
+	}
+	if got := T("xx", "nav.home"); got != "Home" {
+		t.Errorf("unknown locales should use en, got %s", got)
+	}
+	if got := T("en", "no.such.key"); got != "no.such.key" {
+		t.Errorf("missing keys should be returned as is, got %s", got)
+	}
+}
+
+func TestFormatDate(t *testing.T) {
+	d := time.Date(2050, time.March, 7, 0, 0, 0, 0, time.UTC)
+
+	if got := FormatDate("en", d); got != "March 7, 2050" {
+		t.Errorf("got %s", got)
+	}
+	if got := FormatDate("es", d); got != "7 de marzo de 2050" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestLocaleContext(t *testing.T) {
+	if Locale(context.Background()) != Default {
+		t.Error("expected the default locale for an empty context")
+	}
+	if Locale(WithLocale(context.Background(), "es")) != "es" {
+		t.Error("locale was not stored in the context")
+	}
+}
+
+//TestCatalogsMatch checks that no catalog has keys the default one lacks, which would be typos
+func TestCatalogsMatch(t *testing.T) {
+	for _, locale := range Supported() {
+		for key := range catalogs[locale] {
+			if _, ok := catalogs[Default][key]; !ok && !regexp.MustCompile(`^(month|error\.title)\.`).MatchString(key) {
+				t.Errorf("%s has %s, which %s does not", locale, key, Default)
+			}
+		}
+	}
+}
+
+//TestTemplateKeys checks that every key the templates translate is in the default catalog
+func TestTemplateKeys(t *testing.T) {
+	call := regexp.MustCompile(`\{\{t \S+ "([^"]+)"`)
+
+	pages, err := fs.Glob(templates.FS, "*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, page := range pages {
+		data, err := fs.ReadFile(templates.FS, page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range call.FindAllStringSubmatch(string(data), -1) {
+			if _, ok := catalogs[Default][m[1]]; !ok {
+				t.Errorf("%s uses %s, which is not in %s.yml", page, m[1], Default)
+			}
+		}
+	}
+}
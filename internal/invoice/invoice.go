@@ -0,0 +1,207 @@
+//Package invoice builds the invoice of a reservation from its price, payments and cancellation
+//and renders it as a PDF in the guest's language
+package invoice
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/darinmilner/goserver/internal/config"
+	"github.com/darinmilner/goserver/internal/i18n"
+	"github.com/darinmilner/goserver/internal/models"
+	"github.com/darinmilner/goserver/internal/payments"
+	"github.com/darinmilner/goserver/internal/pdf"
+	"github.com/darinmilner/goserver/internal/pricing"
+)
+
+//Invoice is what a reservation is billed. Lines and the taxes that aren't inclusive add up to
+//Total, Payments are the succeeded charges and refunds, Paid what they came to and Due what is
+//left after them
+type Invoice struct {
+	Number      string
+	Issued      time.Time
+	Reservation models.Reservation
+	Lines       []pricing.Line
+	Taxes       []pricing.TaxLine
+	Total       int64
+	Payments    []models.Payment
+	Paid        int64
+	Due         int64
+}
+
+//Number returns the printed number of the nth invoice
+func Number(prefix string, n int) string {
+	return fmt.Sprintf("%s%06d", prefix, n)
+}
+
+//Bill returns what res is billed today, saved as its invoice when that is issued. The stay is
+//itemized as it was quoted at booking, or billed as one line for reservations booked before
+//quotes were saved. A cancelled reservation is billed the penalty c kept instead
+func Bill(res models.Reservation, records []models.Payment, c models.Cancellation) models.Invoice {
+	bill := models.Invoice{ReservationID: res.ID, Paid: payments.Paid(records)}
+
+	switch {
+	case res.Cancelled():
+		if c.Penalty > 0 {
+			bill.Quote.Lines = []pricing.Line{{Key: "invoice.cancellation_fee", Amount: c.Penalty}}
+		}
+		bill.Quote.Total = c.Penalty
+	case len(res.Quote.Lines) > 0:
+		bill.Quote = res.Quote
+	default:
+		bill.Quote.Lines = []pricing.Line{{Key: "invoice.stay", Quantity: res.Stay().Nights(), Amount: res.Total}}
+		bill.Quote.Total = res.Total
+	}
+	return bill
+}
+
+//Build returns the invoice numbered number for res from what issued saved, so it reads the
+//same every time. Payments are the succeeded ones of records made by the time it was issued
+func Build(number string, issued models.Invoice, res models.Reservation, records []models.Payment) Invoice {
+	inv := Invoice{
+		Number:      number,
+		Issued:      issued.CreatedAt,
+		Reservation: res,
+		Lines:       issued.Quote.Lines,
+		Taxes:       issued.Quote.Taxes,
+		Total:       issued.Quote.Total,
+		Paid:        issued.Paid,
+		Due:         issued.Quote.Total - issued.Paid,
+	}
+	//a cancellation after the invoice was issued isn't what it bills
+	if res.CancelledAt.After(issued.CreatedAt) {
+		inv.Reservation.CancelledAt = time.Time{}
+	}
+
+	for _, p := range records {
+		if p.Status == payments.StatusSucceeded && !p.CreatedAt.After(issued.CreatedAt) {
+			inv.Payments = append(inv.Payments, p)
+		}
+	}
+	return inv
+}
+
+//layout of the page, in points
+const (
+	left     = 50.0
+	right    = pdf.PageWidth - 50
+	top      = pdf.PageHeight - 60
+	bottom   = 60.0
+	lineSize = 10.0
+	leading  = 16.0
+)
+
+//Render writes inv as a PDF in locale, issued by issuer
+func Render(w io.Writer, inv Invoice, locale string, issuer config.InvoiceConfig) error {
+	t := func(key string, args ...interface{}) string {
+		return i18n.T(locale, key, args...)
+	}
+	money := func(cents int64) string {
+		return t("price.format", pricing.Format(cents))
+	}
+	res := inv.Reservation
+
+	doc := pdf.New(t("invoice.title") + " " + inv.Number)
+	page := doc.AddPage()
+	y := top
+
+	//row moves down a line, onto a new page when this one is full
+	row := func(gap float64) {
+		y -= gap
+		if y < bottom {
+			page = doc.AddPage()
+			y = top
+		}
+	}
+
+	page.Text(left, y, pdf.Bold, 16, issuer.Issuer)
+	page.TextRight(right, y, pdf.Bold, 16, t("invoice.title"))
+	row(leading + 4)
+	if issuer.Address != "" {
+		page.Text(left, y, pdf.Regular, lineSize, issuer.Address)
+	}
+	page.TextRight(right, y, pdf.Regular, lineSize, t("invoice.number", inv.Number))
+	row(leading)
+	if issuer.TaxID != "" {
+		page.Text(left, y, pdf.Regular, lineSize, t("invoice.tax_id", issuer.TaxID))
+	}
+	page.TextRight(right, y, pdf.Regular, lineSize, t("invoice.date", i18n.FormatDate(locale, inv.Issued)))
+	row(leading * 2)
+
+	page.Text(left, y, pdf.Bold, lineSize, t("invoice.bill_to"))
+	row(leading)
+	page.Text(left, y, pdf.Regular, lineSize, res.FirstName+" "+res.LastName)
+	row(leading)
+	page.Text(left, y, pdf.Regular, lineSize, res.Email)
+	row(leading * 2)
+
+	page.Text(left, y, pdf.Bold, lineSize, t("invoice.reservation", res.ID))
+	row(leading)
+	page.Text(left, y, pdf.Regular, lineSize, t("invoice.stay_dates", res.RoomType.Name,
+		i18n.FormatDate(locale, res.StartDate), i18n.FormatDate(locale, res.EndDate)))
+	if res.Cancelled() {
+		row(leading)
+		page.Text(left, y, pdf.Regular, lineSize, t("invoice.cancelled", i18n.FormatDate(locale, res.CancelledAt)))
+	}
+	row(leading * 2)
+
+	page.Text(left, y, pdf.Bold, lineSize, t("invoice.description"))
+	page.TextRight(right, y, pdf.Bold, lineSize, t("invoice.amount"))
+	row(6)
+	page.Line(left, y, right, y)
+	row(leading)
+	for _, l := range inv.Lines {
+		//lines without a quantity are described by their key alone
+		description := t(l.Key)
+		if l.Quantity > 0 {
+			description = t(l.Key, l.Quantity)
+		}
+		if l.Unit != 0 {
+			description += " × " + money(l.Unit)
+		}
+		page.Text(left, y, pdf.Regular, lineSize, description)
+		page.TextRight(right, y, pdf.Regular, lineSize, money(l.Amount))
+		row(leading)
+	}
+	for _, tax := range inv.Taxes {
+		description := tax.Name
+		if tax.Inclusive {
+			description = t("quote.includes", tax.Name)
+		}
+		page.Text(left, y, pdf.Regular, lineSize, description)
+		page.TextRight(right, y, pdf.Regular, lineSize, money(tax.Amount))
+		row(leading)
+	}
+	//the rule goes just under the last line
+	page.Line(left, y+leading-6, right, y+leading-6)
+	row(4)
+	page.Text(left, y, pdf.Bold, lineSize, t("invoice.total"))
+	page.TextRight(right, y, pdf.Bold, lineSize, money(inv.Total))
+	row(leading * 2)
+
+	if len(inv.Payments) > 0 {
+		page.Text(left, y, pdf.Bold, lineSize, t("invoice.payments"))
+		row(leading)
+		for _, p := range inv.Payments {
+			key, amount := "invoice.charge", money(p.Amount)
+			if p.Kind == payments.KindRefund {
+				key, amount = "invoice.refund", "-"+amount
+			}
+			page.Text(left, y, pdf.Regular, lineSize, t(key, i18n.FormatDate(locale, p.CreatedAt), p.Reference))
+			page.TextRight(right, y, pdf.Regular, lineSize, amount)
+			row(leading)
+		}
+		page.Text(left, y, pdf.Regular, lineSize, t("invoice.paid"))
+		page.TextRight(right, y, pdf.Regular, lineSize, money(inv.Paid))
+		row(leading)
+	}
+	page.Text(left, y, pdf.Bold, lineSize, t("invoice.due"))
+	page.TextRight(right, y, pdf.Bold, lineSize, money(inv.Due))
+	row(leading * 3)
+
+	page.Text(left, y, pdf.Regular, lineSize, t("invoice.thanks"))
+
+	_, err := doc.WriteTo(w)
+	return err
+}
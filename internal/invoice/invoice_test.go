@@ -0,0 +1,107 @@
+package invoice
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/darinmilner/goserver/internal/config"
+	"github.com/darinmilner/goserver/internal/models"
+	"github.com/darinmilner/goserver/internal/pricing"
+)
+
+var (
+	issued = time.Date(2039, 12, 1, 0, 0, 0, 0, time.UTC)
+	stay   = models.Reservation{
+		ID:        12,
+		FirstName: "Ali",
+		LastName:  "Jamal",
+		Email:     "aJamal@abc.com",
+		StartDate: time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2040, 1, 3, 0, 0, 0, 0, time.UTC),
+		RoomType:  models.RoomType{Name: "General's Quarters"},
+		Adults:    3,
+		Total:     26000,
+	}
+	rate    = pricing.Rate{Nightly: 10000, Included: 2, ExtraAdult: 3000}
+	records = []models.Payment{
+		{Kind: "charge", Reference: "fake_pi_1", Amount: 7800, Status: "succeeded", CreatedAt: issued},
+		{Kind: "charge", Reference: "fake_pi_2", Amount: 7800, Status: "failed", CreatedAt: issued},
+		{Kind: "refund", Reference: "fake_re_3", Amount: 800, Status: "succeeded", CreatedAt: issued},
+	}
+)
+
+func TestNumber(t *testing.T) {
+	if got := Number("INV-", 42); got != "INV-000042" {
+		t.Errorf("expected INV-000042 but got %s", got)
+	}
+}
+
+func TestBill(t *testing.T) {
+	quoted := stay
+	quoted.Quote = pricing.Calculate(rate, stay.Stay())
+
+	bill := Bill(quoted, records, models.Cancellation{})
+	if len(bill.Quote.Lines) != 2 || bill.Quote.Total != 26000 || bill.Paid != 7000 || bill.ReservationID != 12 {
+		t.Errorf("expected the room and extra adult lines for 26000 with 7000 paid, got %+v", bill)
+	}
+
+	//booked before quotes were saved, so the stay is billed at its total
+	bill = Bill(stay, records, models.Cancellation{})
+	if len(bill.Quote.Lines) != 1 || bill.Quote.Lines[0].Key != "invoice.stay" || bill.Quote.Lines[0].Quantity != 2 || bill.Quote.Total != 26000 {
+		t.Errorf("expected one line for the 2 night stay at 26000, got %+v", bill)
+	}
+
+	cancelled := quoted
+	cancelled.CancelledAt = issued
+	bill = Bill(cancelled, records, models.Cancellation{Penalty: 13000, Refund: 0})
+	if len(bill.Quote.Lines) != 1 || bill.Quote.Lines[0].Key != "invoice.cancellation_fee" || bill.Quote.Total != 13000 {
+		t.Errorf("expected the cancellation fee of 13000, got %+v", bill)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	quoted := stay
+	quoted.Quote = pricing.Calculate(rate, stay.Stay())
+	saved := Bill(quoted, records, models.Cancellation{})
+	saved.CreatedAt = issued
+
+	//paid again and cancelled since it was issued, neither of which it bills
+	later := append(records, models.Payment{Kind: "charge", Reference: "fake_pi_4", Amount: 19000, Status: "succeeded", CreatedAt: issued.Add(time.Hour)})
+	cancelled := quoted
+	cancelled.CancelledAt = issued.Add(time.Hour)
+
+	inv := Build("INV-000001", saved, cancelled, later)
+	if len(inv.Lines) != 2 || inv.Total != 26000 || !inv.Issued.Equal(issued) {
+		t.Errorf("expected the saved lines for 26000, got %+v", inv)
+	}
+	if len(inv.Payments) != 2 || inv.Paid != 7000 || inv.Due != 19000 {
+		t.Errorf("expected 7000 paid in two payments and 19000 due, got %d, %d, %d", len(inv.Payments), inv.Paid, inv.Due)
+	}
+	if inv.Reservation.Cancelled() {
+		t.Error("expected the later cancellation to be left off")
+	}
+}
+
+func TestRender(t *testing.T) {
+	taxed := stay
+	taxed.Total = 27500
+	taxed.Quote = pricing.Calculate(rate, stay.Stay(),
+		pricing.Tax{Name: "Tourist tax", Amount: 250, Per: pricing.PerPersonNight},
+		pricing.Tax{Name: "IVA", Percent: true, Amount: 1000, Inclusive: true})
+	saved := Bill(taxed, records, models.Cancellation{})
+	saved.CreatedAt = issued
+	inv := Build("INV-000001", saved, taxed, records)
+
+	var buf bytes.Buffer
+	err := Render(&buf, inv, "es", config.InvoiceConfig{Issuer: "The Fort Hotel", TaxID: "B12345678"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"%PDF-", "(Factura) Tj", "(N.\xba INV-000001) Tj", "(NIF: B12345678) Tj", "(Tourist tax) Tj", "(Incluye IVA) Tj", "(23.64 US$) Tj", "(205.00 US$) Tj"} {
+		if !bytes.Contains(buf.Bytes(), []byte(want)) {
+			t.Errorf("expected %q in the invoice", want)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "bookings"
+
+//Registry holds every metric the app exposes on /metrics
+var Registry = prometheus.NewRegistry()
+
+var (
+	//HTTPRequests counts requests by method, chi route pattern and status code
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route pattern and status code.",
+	}, []string{"method", "route", "status"})
+
+	//HTTPDuration records request latency by method, chi route pattern and status code
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method, route pattern and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	//QueryDuration records how long each repository method takes
+	QueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Repository call latency by method.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 3},
+	}, []string{"method"})
+
+	//MailSent counts messages handed to the SMTP server
+	MailSent = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mail_sent_total",
+		Help:      "Emails sent.",
+	})
+
+	//MailFailures counts messages that could not be sent
+	MailFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "mail_send_failures_total",
+		Help:      "Emails that failed to send.",
+	})
+
+	//ReservationsCreated counts reservations booked by guests
+	ReservationsCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reservations_created_total",
+		Help:      "Reservations created.",
+	})
+
+	//ReservationsCancelled counts reservations cancelled under their policy
+	ReservationsCancelled = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reservations_cancelled_total",
+		Help:      "Reservations cancelled.",
+	})
+
+	//BlocksAdded counts owner blocks added on the calendar
+	BlocksAdded = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "owner_blocks_added_total",
+		Help:      "Owner blocks added on the reservation calendar.",
+	})
+
+	//BlocksRemoved counts owner blocks removed on the calendar
+	BlocksRemoved = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "owner_blocks_removed_total",
+		Help:      "Owner blocks removed on the reservation calendar.",
+	})
+
+	//HoldsExpired counts room holds that ran out before the guest booked
+	HoldsExpired = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "room_holds_expired_total",
+		Help:      "Room holds deleted by the sweeper after running out.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPDuration,
+		QueryDuration,
+		MailSent,
+		MailFailures,
+		ReservationsCreated,
+		ReservationsCancelled,
+		BlocksAdded,
+		BlocksRemoved,
+		HoldsExpired,
+	)
+}
+
+//Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+//RegisterDB exposes the database/sql connection pool stats of db
+func RegisterDB(db *sql.DB) {
+	Registry.MustRegister(collectors.NewDBStatsCollector(db, namespace))
+}
+
+//RegisterMailQueue exposes the number of messages waiting for the mail worker
+func RegisterMailQueue(depth func() int) {
+	Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "mail_queue_depth",
+		Help:      "Emails waiting to be sent.",
+	}, func() float64 {
+		return float64(depth())
+	}))
+}
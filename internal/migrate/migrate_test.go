@@ -0,0 +1,61 @@
+package migrate
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/darinmilner/goserver/migrations"
+)
+
+func TestLoadEmbedded(t *testing.T) {
+	ms, err := Load(migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ms) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+
+	for i := 1; i < len(ms); i++ {
+		if ms[i].Version <= ms[i-1].Version {
+			t.Errorf("migrations out of order: %d after %d", ms[i].Version, ms[i-1].Version)
+		}
+	}
+
+	for _, m := range ms {
+		if strings.TrimSpace(m.Up) == "" || strings.TrimSpace(m.Down) == "" {
+			t.Errorf("migration %d_%s has an empty up or down file", m.Version, m.Name)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"2_second.up.sql":   {Data: []byte("create table b ();")},
+		"2_second.down.sql": {Data: []byte("drop table b;")},
+		"1_first.up.sql":    {Data: []byte("create table a ();")},
+		"1_first.down.sql":  {Data: []byte("drop table a;")},
+		"readme.md":         {Data: []byte("ignored")},
+	}
+
+	ms, err := Load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ms) != 2 || ms[0].Name != "first" || ms[1].Name != "second" {
+		t.Errorf("unexpected migrations %+v", ms)
+	}
+
+	delete(fsys, "2_second.down.sql")
+	if _, err := Load(fsys); err == nil {
+		t.Error("expected an error for a migration without a down file")
+	}
+
+	fsys["2_other.down.sql"] = &fstest.MapFile{Data: []byte("drop table b;")}
+	if _, err := Load(fsys); err == nil {
+		t.Error("expected an error for two migrations with the same version")
+	}
+}
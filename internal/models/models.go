@@ -2,6 +2,10 @@ package models
 
 import (
 	"time"
+
+	"github.com/darinmilner/goserver/internal/cancellation"
+	"github.com/darinmilner/goserver/internal/pricing"
+	"go.opentelemetry.io/otel/trace"
 )
 
 //User is user DB model
@@ -16,12 +20,46 @@ type User struct {
 	UpdatedAt   time.Time
 }
 
-//Room is the room DB model
+//Room is the room DB model, one bookable unit of a RoomType
 type Room struct {
-	ID        int
-	RoomName  string
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID         int
+	RoomName   string
+	RoomTypeID int
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+//RoomType groups identical rooms. Guests book a type and are given one of its rooms.
+//MaxOccupancy is the most guests, children included, one of its rooms sleeps. The rates are
+//in cents, see pricing.Rate
+type RoomType struct {
+	ID             int
+	Name           string
+	MaxOccupancy   int
+	IncludedGuests int
+	NightlyRate    int64
+	ExtraAdultRate int64
+	ExtraChildRate int64
+	//CancellationPolicyID is the policy reservations of the type are cancelled under
+	CancellationPolicyID int
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
+}
+
+//Rate returns what the room type charges, for pricing.Calculate
+func (rt RoomType) Rate() pricing.Rate {
+	return pricing.Rate{
+		Nightly:    rt.NightlyRate,
+		Included:   rt.IncludedGuests,
+		ExtraAdult: rt.ExtraAdultRate,
+		ExtraChild: rt.ExtraChildRate,
+	}
+}
+
+//RoomTypeAvailability is a room type with the number of its rooms free for some dates
+type RoomTypeAvailability struct {
+	RoomType RoomType
+	Free     int
 }
 
 //Restriction is the room DB model
@@ -46,8 +84,42 @@ type Reservation struct {
 	UpdatedAt time.Time
 	Room      Room
 	Processed int
+	//RoomTypeID is the type the guest booked, RoomID the room of that type they were given
+	RoomTypeID int
+	RoomType   RoomType
+	//Locale is the language the guest booked in, their mail is sent in it
+	Locale   string
+	Adults   int
+	Children int
+	//Total is the quoted price of the stay in cents and Deposit the part of it taken at checkout
+	Total   int64
+	Deposit int64
+	//Quote is the itemized Total, saved when it is booked so it reads the same after rates and
+	//taxes change. It is zero for reservations booked before quotes were saved
+	Quote pricing.Quote
+	//CancelledAt is when the reservation was cancelled, zero while it stands
+	CancelledAt time.Time
+	//AccessToken is the secret in the link to the guest's own reservation page
+	AccessToken string
+}
+
+//Cancelled reports whether the reservation has been cancelled
+func (r Reservation) Cancelled() bool {
+	return !r.CancelledAt.IsZero()
+}
+
+//Stay returns the dates and party of the reservation, for pricing
+func (r Reservation) Stay() pricing.Stay {
+	return pricing.Stay{Start: r.StartDate, End: r.EndDate, Adults: r.Adults, Children: r.Children}
 }
 
+//RestrictionReservation is the restriction of a booked reservation
+const RestrictionReservation = 1
+
+//RestrictionHold is the restriction of a hold, which keeps a room for a guest while they fill
+//in the reservation form until ExpiresAt
+const RestrictionHold = 3
+
 //RoomRestriction is the room restriction DB model
 type RoomRestriction struct {
 	ID            int
@@ -56,6 +128,7 @@ type RoomRestriction struct {
 	RoomID        int
 	ReservationID int
 	RestrictionID int
+	ExpiresAt     time.Time
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
 	Room          Room
@@ -63,6 +136,112 @@ type RoomRestriction struct {
 	Restriction   Reservation
 }
 
+//Payment is money taken from or given back to a guest through a payment provider. Reference
+//is the provider's id of the charge or refund and Kind and Status are the values in package
+//payments. Charge is the reference of the charge a refund gives back
+type Payment struct {
+	ID            int
+	ReservationID int
+	Provider      string
+	Reference     string
+	Kind          string
+	Charge        string
+	Amount        int64
+	Currency      string
+	Status        string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+//CancellationPolicy is a room type's terms for cancelling, see cancellation.Calculate
+type CancellationPolicy struct {
+	ID             int
+	Name           string
+	FreeDays       int
+	PenaltyPercent int
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+//Policy returns the terms for cancellation.Calculate
+func (p CancellationPolicy) Policy() cancellation.Policy {
+	return cancellation.Policy{FreeDays: p.FreeDays, PenaltyPercent: p.PenaltyPercent}
+}
+
+//Cancellation records who cancelled a reservation and why. Penalty and Refund are what the
+//policy worked out at the time, in cents. UserID is the admin who did it, 0 for a guest
+type Cancellation struct {
+	ID            int
+	ReservationID int
+	Reason        string
+	Actor         string
+	UserID        int
+	Penalty       int64
+	Refund        int64
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+//Invoice is the invoice issued for a reservation. Number is its place in the sequence every
+//invoice shares and CreatedAt the date it was issued. Quote is what it bills and Paid what had
+//been paid by then, both saved when it was issued
+type Invoice struct {
+	ID            int
+	Number        int
+	ReservationID int
+	Quote         pricing.Quote
+	Paid          int64
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+//StayRule limits the stays of a room type, or of every type when RoomTypeID is 0, that arrive
+//between StartDate and EndDate. NoArrival and NoDeparture are weekdays as bits, 1<<time.Sunday
+//and so on, and zero fields don't apply. See stayrules.Check
+type StayRule struct {
+	ID             int
+	RoomTypeID     int
+	StartDate      time.Time
+	EndDate        time.Time
+	MinNights      int
+	MaxNights      int
+	NoArrival      int
+	NoDeparture    int
+	MinLeadDays    int
+	MaxAdvanceDays int
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+//TaxRule is a tax or fee charged on stays in a room type, or in every type when RoomTypeID
+//is 0. Zero dates leave it open at that end. See pricing.Tax
+type TaxRule struct {
+	ID         int
+	RoomTypeID int
+	Name       string
+	Percent    bool
+	Amount     int64
+	Per        string
+	Inclusive  bool
+	StartDate  time.Time
+	EndDate    time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+//Tax returns the tax the rule charges
+func (t TaxRule) Tax() pricing.Tax {
+	return pricing.Tax{
+		Name:      t.Name,
+		Percent:   t.Percent,
+		Amount:    t.Amount,
+		Per:       t.Per,
+		Inclusive: t.Inclusive,
+		From:      t.StartDate,
+		To:        t.EndDate,
+	}
+}
+
 //MailData holds an email message
 type MailData struct {
 	To       string
@@ -70,4 +249,8 @@ type MailData struct {
 	Subject  string
 	Content  string
 	Template string
+	//Locale picks the translated copy of Template when there is one
+	Locale string
+	//SpanContext links the send to the request that queued the message
+	SpanContext trace.SpanContext
 }
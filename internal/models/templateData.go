@@ -6,11 +6,11 @@ import (
 
 //TemplateData holds data sent from handlers to templates
 type TemplateData struct {
-	StringMap       map[string]string
-	IntMap          map[string]int
-	FloatMap        map[string]float32
-	Data            map[string]interface{}
+	//View is the page's own data, one of the view models in views.go
+	View            interface{}
 	CSRFToken       string
+	CSPNonce        string
+	Locale          string
 	Flash           string
 	Warning         string
 	Error           string
@@ -0,0 +1,142 @@
+package models
+
+import (
+	"time"
+
+	"github.com/darinmilner/goserver/internal/cancellation"
+	"github.com/darinmilner/goserver/internal/pricing"
+)
+
+//The view models below are what handlers put in TemplateData.View, one per page. Templates
+//reach them as .View, so a renamed field fails the page tests instead of rendering nothing
+
+//ReservationView is the make reservation page, with the price of the stay. HoldSeconds is how
+//long the room stays held for the guest without the page renewing it
+type ReservationView struct {
+	Reservation Reservation
+	Quote       pricing.Quote
+	HoldSeconds int
+}
+
+//ChooseRoomView is the list of room types with rooms free for the searched dates and party
+type ChooseRoomView struct {
+	Choices []RoomChoice
+}
+
+//RoomChoice is a room type on the choose room page, with how many of its rooms are left and
+//the price of the searched stay
+type RoomChoice struct {
+	RoomType RoomType
+	Free     int
+	Quote    pricing.Quote
+}
+
+//SummaryView is the reservation summary page, Balance is what is left to pay after the deposit
+type SummaryView struct {
+	Reservation Reservation
+	Quote       pricing.Quote
+	Balance     int64
+}
+
+//CheckoutView is the checkout page, where the guest pays the reservation's deposit. TestMode is
+//set when the payment provider is the fake one, so its test cards are offered
+type CheckoutView struct {
+	Reservation Reservation
+	Quote       pricing.Quote
+	Balance     int64
+	TestMode    bool
+}
+
+//MyReservationView is the guest's own page for their reservation, Paid is what they have paid
+//and Balance what is left. Invoice is the invoice issued for it, if any
+type MyReservationView struct {
+	Reservation Reservation
+	Paid        int64
+	Balance     int64
+	Invoice     Invoice
+	//Policy is the room type's cancellation policy and Cancel what cancelling now would come
+	//to, while the reservation stands
+	Policy CancellationPolicy
+	Cancel cancellation.Outcome
+}
+
+//Cancellable reports whether the guest can cancel the reservation themselves, which they can
+//until the day they arrive
+func (v MyReservationView) Cancellable() bool {
+	return !v.Reservation.Cancelled() && v.Cancel.DaysBefore >= 0
+}
+
+//ReservationsView is the admin list of new or all reservations
+type ReservationsView struct {
+	Reservations []Reservation
+}
+
+//AdminReservationView is the admin page for one reservation. Src is the list the page was
+//opened from, Year and Month the calendar month when it was opened from the calendar
+type AdminReservationView struct {
+	Reservation Reservation
+	Src         string
+	Year        string
+	Month       string
+	//Payments are the charges and refunds of the reservation, Paid what they come to and
+	//Balance what is still owed
+	Payments []Payment
+	Paid     int64
+	Balance  int64
+	//Policy is the room type's cancellation policy and Cancel what cancelling now would come
+	//to. Cancellation is set instead once the reservation has been cancelled
+	Policy       CancellationPolicy
+	Cancel       cancellation.Outcome
+	Cancellation Cancellation
+	//Invoice is the invoice issued for the reservation, if any
+	Invoice Invoice
+}
+
+//Deletable reports whether the reservation can be deleted, one with payments or an invoice is
+//kept and has to be cancelled instead
+func (v AdminReservationView) Deletable() bool {
+	return len(v.Payments) == 0 && v.Invoice.ID == 0
+}
+
+//CalendarView is one month of the admin reservation calendar
+type CalendarView struct {
+	Month    time.Time
+	Previous time.Time
+	Next     time.Time
+	Rooms    []CalendarRoom
+}
+
+//CalendarRoom is a room's row in the calendar, with a cell for every day of the month.
+//Reservations are the ones in the room this month, and Moves the other rooms of its type
+//they can be moved to
+type CalendarRoom struct {
+	Room         Room
+	Days         []CalendarDay
+	Reservations []CalendarReservation
+	Moves        []Room
+}
+
+//CalendarReservation is a reservation listed under its room on the calendar
+type CalendarReservation struct {
+	ID        int
+	StartDate time.Time
+	EndDate   time.Time
+}
+
+//CalendarDay is one cell of the calendar. ReservationID is set when the room is booked that
+//day, BlockID when the owner blocked it and Held when a guest is booking it right now
+type CalendarDay struct {
+	Day           int
+	Date          string
+	ReservationID int
+	BlockID       int
+	Held          bool
+}
+
+//ErrorView is the error page
+type ErrorView struct {
+	Status    int
+	Title     string
+	Message   string
+	RequestID string
+}
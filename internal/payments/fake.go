@@ -0,0 +1,166 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+//Test payment methods the fake provider knows, any other method is taken as a good card
+const (
+	FakeCard     = "tok_visa"
+	FakeDeclined = "tok_declined"
+)
+
+//FakeSignatureHeader carries the hex HMAC-SHA256 of a fake webhook's body
+const FakeSignatureHeader = "X-Fake-Signature"
+
+//Fake is an in-process Provider for tests and development. Nothing leaves the process, it
+//keeps its intents in memory and signs webhooks with Secret
+type Fake struct {
+	Secret string
+
+	mu       sync.Mutex
+	next     int
+	intents  map[string]*Intent
+	refunded map[string]int64
+}
+
+//NewFake returns a fake provider signing webhooks with secret
+func NewFake(secret string) *Fake {
+	return &Fake{
+		Secret:   secret,
+		intents:  make(map[string]*Intent),
+		refunded: make(map[string]int64),
+	}
+}
+
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+func (f *Fake) CreateIntent(ctx context.Context, amount int64, currency, reference string) (Intent, error) {
+	if amount <= 0 {
+		return Intent{}, fmt.Errorf("amount %d is not positive", amount)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.next++
+	intent := &Intent{
+		ID:        fmt.Sprintf("fake_pi_%d", f.next),
+		Amount:    amount,
+		Currency:  currency,
+		Reference: reference,
+		Status:    StatusPending,
+	}
+	f.intents[intent.ID] = intent
+	return *intent, nil
+}
+
+func (f *Fake) Capture(ctx context.Context, intentID, method string) (Intent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	intent, ok := f.intents[intentID]
+	if !ok {
+		return Intent{}, fmt.Errorf("no intent %s", intentID)
+	}
+	if intent.Status == StatusSucceeded {
+		return *intent, nil
+	}
+	if intent.Status == StatusCancelled {
+		return *intent, fmt.Errorf("intent %s was cancelled", intentID)
+	}
+
+	if method == FakeDeclined {
+		intent.Status = StatusFailed
+		return *intent, ErrDeclined
+	}
+	intent.Status = StatusSucceeded
+	return *intent, nil
+}
+
+func (f *Fake) Refund(ctx context.Context, intentID string, amount int64) (Refund, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	intent, ok := f.intents[intentID]
+	if !ok {
+		return Refund{}, fmt.Errorf("no intent %s", intentID)
+	}
+	if intent.Status != StatusSucceeded {
+		return Refund{}, fmt.Errorf("intent %s was not captured", intentID)
+	}
+	if amount <= 0 || f.refunded[intentID]+amount > intent.Amount {
+		return Refund{}, fmt.Errorf("can't refund %d of intent %s, %d of %d is left", amount, intentID,
+			intent.Amount-f.refunded[intentID], intent.Amount)
+	}
+
+	f.next++
+	f.refunded[intentID] += amount
+	return Refund{
+		ID:       fmt.Sprintf("fake_re_%d", f.next),
+		IntentID: intentID,
+		Amount:   amount,
+		Status:   StatusSucceeded,
+	}, nil
+}
+
+func (f *Fake) Cancel(ctx context.Context, intentID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	intent, ok := f.intents[intentID]
+	if !ok {
+		return fmt.Errorf("no intent %s", intentID)
+	}
+	if intent.Status == StatusSucceeded {
+		f.refunded[intentID] = intent.Amount
+		return nil
+	}
+	intent.Status = StatusCancelled
+	return nil
+}
+
+//Refunded returns how much of an intent has been refunded
+func (f *Fake) Refunded(intentID string) int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.refunded[intentID]
+}
+
+func (f *Fake) VerifyWebhook(payload []byte, header http.Header) (Event, error) {
+	var e Event
+
+	got, err := hex.DecodeString(header.Get(FakeSignatureHeader))
+	if err != nil || f.Secret == "" || !hmac.Equal(got, f.sign(payload)) {
+		return e, ErrBadSignature
+	}
+
+	if err := json.Unmarshal(payload, &e); err != nil {
+		return e, err
+	}
+	if e.Type == "" || e.Reference == "" {
+		return e, errors.New("webhook has no type or reference")
+	}
+	return e, nil
+}
+
+//Sign returns the signature header value for payload, for sending fake webhooks
+func (f *Fake) Sign(payload []byte) string {
+	return hex.EncodeToString(f.sign(payload))
+}
+
+func (f *Fake) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(f.Secret))
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
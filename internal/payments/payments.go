@@ -0,0 +1,145 @@
+//Package payments takes guests' deposits through a payment provider. Provider is all the
+//handlers know of one, so a real processor plugs in next to Fake without touching them
+package payments
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/darinmilner/goserver/internal/config"
+	"github.com/darinmilner/goserver/internal/models"
+)
+
+//ErrDeclined is returned by Capture when the payment method was refused
+var ErrDeclined = errors.New("payment declined")
+
+//ErrFakeInProduction is returned by New for the fake provider in production, where it would
+//book guests on deposits that were never taken
+var ErrFakeInProduction = errors.New("the fake payment provider takes no money, it can't take deposits in production")
+
+//ErrBadSignature is returned by VerifyWebhook when the payload wasn't signed by the provider
+var ErrBadSignature = errors.New("webhook signature is not valid")
+
+//Kinds of payment records. A refund is recorded as its own positive amount
+const (
+	KindCharge = "charge"
+	KindRefund = "refund"
+)
+
+//Statuses of intents and payment records
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+//Types of webhook events
+const (
+	EventPaymentSucceeded = "payment.succeeded"
+	EventPaymentFailed    = "payment.failed"
+	EventRefundSucceeded  = "refund.succeeded"
+	EventRefundFailed     = "refund.failed"
+)
+
+//Intent is an amount the provider has been asked to take. Reference is ours, to find the
+//booking on the provider's side
+type Intent struct {
+	ID        string
+	Amount    int64
+	Currency  string
+	Reference string
+	Status    string
+}
+
+//Refund is money given back on a captured intent
+type Refund struct {
+	ID       string
+	IntentID string
+	Amount   int64
+	Status   string
+}
+
+//Event is a webhook from the provider about an intent or refund, Reference being its id
+type Event struct {
+	Type      string `json:"type"`
+	Reference string `json:"reference"`
+	Amount    int64  `json:"amount"`
+}
+
+//Status returns the status a payment record takes after the event, or "" for events that
+//don't change one
+func (e Event) Status() string {
+	switch e.Type {
+	case EventPaymentSucceeded, EventRefundSucceeded:
+		return StatusSucceeded
+	case EventPaymentFailed, EventRefundFailed:
+		return StatusFailed
+	}
+	return ""
+}
+
+//Provider is a payment processor. Amounts are cents in the intent's currency
+type Provider interface {
+	//Name is stored with payment records, references are only unique per provider
+	Name() string
+	//CreateIntent asks to take amount, nothing is charged until Capture
+	CreateIntent(ctx context.Context, amount int64, currency, reference string) (Intent, error)
+	//Capture charges an intent to method, the token the checkout form got for the guest's
+	//card. It returns ErrDeclined when the card is refused
+	Capture(ctx context.Context, intentID, method string) (Intent, error)
+	//Refund gives back amount of a captured intent
+	Refund(ctx context.Context, intentID string, amount int64) (Refund, error)
+	//Cancel gives back whatever an intent took: a captured one is refunded in full and any
+	//other can't be captured any more
+	Cancel(ctx context.Context, intentID string) error
+	//VerifyWebhook checks a webhook was sent by the provider and returns its event
+	VerifyWebhook(payload []byte, header http.Header) (Event, error)
+}
+
+//New returns the provider the configuration names, the loader only lets known ones through.
+//The fake one is refused in production unless no deposit is taken
+func New(c config.PaymentsConfig, inProduction bool) (Provider, error) {
+	if inProduction && c.DepositPercent > 0 {
+		return nil, ErrFakeInProduction
+	}
+	return NewFake(c.WebhookSecret), nil
+}
+
+//Deposit returns percent of total, rounded up to a whole cent
+func Deposit(total int64, percent int) int64 {
+	if total <= 0 || percent <= 0 {
+		return 0
+	}
+	return (total*int64(percent) + 99) / 100
+}
+
+//Refundable returns what is left to refund of charge, its amount less the refunds of it in
+//records that haven't failed
+func Refundable(records []models.Payment, charge models.Payment) int64 {
+	left := charge.Amount
+	for _, p := range records {
+		if p.Kind == KindRefund && p.Charge == charge.Reference && p.Status != StatusFailed {
+			left -= p.Amount
+		}
+	}
+	return max(left, 0)
+}
+
+//Paid returns what the guest has paid on balance: succeeded charges less succeeded refunds
+func Paid(records []models.Payment) int64 {
+	var paid int64
+	for _, p := range records {
+		if p.Status != StatusSucceeded {
+			continue
+		}
+		switch p.Kind {
+		case KindCharge:
+			paid += p.Amount
+		case KindRefund:
+			paid -= p.Amount
+		}
+	}
+	return paid
+}
@@ -0,0 +1,178 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/darinmilner/goserver/internal/config"
+	"github.com/darinmilner/goserver/internal/models"
+)
+
+func TestFakeCaptureAndRefund(t *testing.T) {
+	ctx := context.Background()
+	f := NewFake("secret")
+
+	intent, err := f.CreateIntent(ctx, 6000, "usd", "hold 1")
+	if err != nil || intent.Status != StatusPending {
+		t.Fatalf("CreateIntent: %+v, %v", intent, err)
+	}
+
+	if _, err := f.Refund(ctx, intent.ID, 1000); err == nil {
+		t.Error("refunding an intent that wasn't captured should fail")
+	}
+
+	intent, err = f.Capture(ctx, intent.ID, FakeCard)
+	if err != nil || intent.Status != StatusSucceeded {
+		t.Fatalf("Capture: %+v, %v", intent, err)
+	}
+
+	if _, err := f.Refund(ctx, intent.ID, 4000); err != nil {
+		t.Errorf("Refund: %v", err)
+	}
+	if _, err := f.Refund(ctx, intent.ID, 2001); err == nil {
+		t.Error("refunding more than is left should fail")
+	}
+	if _, err := f.Refund(ctx, intent.ID, 2000); err != nil {
+		t.Errorf("refunding the rest: %v", err)
+	}
+	if got := f.Refunded(intent.ID); got != 6000 {
+		t.Errorf("expected 6000 refunded but got %d", got)
+	}
+}
+
+func TestNew(t *testing.T) {
+	c := config.PaymentsConfig{Provider: "fake", DepositPercent: 30}
+
+	if _, err := New(c, false); err != nil {
+		t.Errorf("the fake provider should run outside production: %v", err)
+	}
+	if _, err := New(c, true); !errors.Is(err, ErrFakeInProduction) {
+		t.Errorf("expected ErrFakeInProduction but got %v", err)
+	}
+
+	c.DepositPercent = 0
+	if _, err := New(c, true); err != nil {
+		t.Errorf("the fake provider takes nothing without a deposit: %v", err)
+	}
+}
+
+func TestFakeDeclined(t *testing.T) {
+	ctx := context.Background()
+	f := NewFake("secret")
+
+	intent, _ := f.CreateIntent(ctx, 6000, "usd", "")
+	intent, err := f.Capture(ctx, intent.ID, FakeDeclined)
+	if !errors.Is(err, ErrDeclined) || intent.Status != StatusFailed {
+		t.Errorf("expected a declined, failed intent, got %+v, %v", intent, err)
+	}
+
+	if _, err := f.Capture(ctx, "fake_pi_99", FakeCard); err == nil {
+		t.Error("capturing an unknown intent should fail")
+	}
+	if _, err := f.CreateIntent(ctx, 0, "usd", ""); err == nil {
+		t.Error("an intent for nothing should fail")
+	}
+}
+
+func TestFakeCancel(t *testing.T) {
+	ctx := context.Background()
+	f := NewFake("secret")
+
+	pending, _ := f.CreateIntent(ctx, 6000, "usd", "hold 1")
+	if err := f.Cancel(ctx, pending.ID); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	if _, err := f.Capture(ctx, pending.ID, FakeCard); err == nil {
+		t.Error("capturing a cancelled intent should fail")
+	}
+
+	//a declined intent can be tried again with another card until it is cancelled
+	captured, _ := f.CreateIntent(ctx, 6000, "usd", "hold 2")
+	f.Capture(ctx, captured.ID, FakeDeclined)
+	if _, err := f.Capture(ctx, captured.ID, FakeCard); err != nil {
+		t.Fatalf("Capture after a decline: %v", err)
+	}
+	f.Refund(ctx, captured.ID, 1000)
+	if err := f.Cancel(ctx, captured.ID); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	if got := f.Refunded(captured.ID); got != 6000 {
+		t.Errorf("expected the whole 6000 given back but got %d", got)
+	}
+}
+
+func TestFakeVerifyWebhook(t *testing.T) {
+	f := NewFake("secret")
+	payload := []byte(`{"type":"refund.succeeded","reference":"fake_re_2","amount":1000}`)
+
+	header := http.Header{}
+	header.Set(FakeSignatureHeader, f.Sign(payload))
+	e, err := f.VerifyWebhook(payload, header)
+	if err != nil || e.Reference != "fake_re_2" || e.Status() != StatusSucceeded {
+		t.Errorf("expected a succeeded refund, got %+v, %v", e, err)
+	}
+
+	header.Set(FakeSignatureHeader, NewFake("other").Sign(payload))
+	if _, err := f.VerifyWebhook(payload, header); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("expected ErrBadSignature for another secret, got %v", err)
+	}
+
+	unsigned := NewFake("")
+	header.Set(FakeSignatureHeader, unsigned.Sign(payload))
+	if _, err := unsigned.VerifyWebhook(payload, header); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("expected ErrBadSignature without a secret, got %v", err)
+	}
+}
+
+func TestDeposit(t *testing.T) {
+	tests := []struct {
+		total   int64
+		percent int
+		want    int64
+	}{
+		{20000, 30, 6000},
+		{10001, 30, 3001},
+		{20000, 0, 0},
+		{20000, 100, 20000},
+		{0, 30, 0},
+	}
+	for _, tt := range tests {
+		if got := Deposit(tt.total, tt.percent); got != tt.want {
+			t.Errorf("Deposit(%d, %d) = %d, want %d", tt.total, tt.percent, got, tt.want)
+		}
+	}
+}
+
+func TestPaid(t *testing.T) {
+	records := []models.Payment{
+		{Kind: KindCharge, Amount: 6000, Status: StatusSucceeded},
+		{Kind: KindCharge, Amount: 6000, Status: StatusFailed},
+		{Kind: KindRefund, Amount: 1000, Status: StatusSucceeded},
+		{Kind: KindRefund, Amount: 500, Status: StatusPending},
+	}
+	if got := Paid(records); got != 5000 {
+		t.Errorf("expected 5000 paid but got %d", got)
+	}
+}
+
+func TestRefundable(t *testing.T) {
+	charge := models.Payment{Reference: "pi_1", Kind: KindCharge, Amount: 6000, Status: StatusSucceeded}
+	records := []models.Payment{
+		charge,
+		{Reference: "pi_2", Kind: KindCharge, Amount: 3000, Status: StatusSucceeded},
+		{Reference: "re_1", Kind: KindRefund, Charge: "pi_1", Amount: 1000, Status: StatusSucceeded},
+		{Reference: "re_2", Kind: KindRefund, Charge: "pi_1", Amount: 500, Status: StatusPending},
+		{Reference: "re_3", Kind: KindRefund, Charge: "pi_1", Amount: 2000, Status: StatusFailed},
+		{Reference: "re_4", Kind: KindRefund, Charge: "pi_2", Amount: 3000, Status: StatusSucceeded},
+	}
+
+	//the failed refund gave nothing back and the one of the other charge is that charge's
+	if got := Refundable(records, charge); got != 4500 {
+		t.Errorf("expected 4500 left to refund but got %d", got)
+	}
+	if got := Refundable(records, records[1]); got != 0 {
+		t.Errorf("expected nothing left of the refunded charge but got %d", got)
+	}
+}
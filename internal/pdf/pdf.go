@@ -0,0 +1,195 @@
+//Package pdf writes simple PDF documents: A4 pages of text in the standard Helvetica fonts and
+//ruled lines. Every PDF reader has those fonts, so nothing is embedded and no library is needed
+package pdf
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+//Size of an A4 page in points, the unit of every position. The origin is the bottom left corner
+const (
+	PageWidth  = 595.28
+	PageHeight = 841.89
+)
+
+//Font is one of the standard fonts a page can write in
+type Font int
+
+const (
+	Regular Font = iota
+	Bold
+)
+
+//Document is a PDF being built. Pages are written in the order they were added
+type Document struct {
+	Title string
+	pages []*Page
+}
+
+//Page is one page of a document, its content stream is built up by the drawing methods
+type Page struct {
+	content bytes.Buffer
+}
+
+//New returns an empty document with title in its properties
+func New(title string) *Document {
+	return &Document{Title: title}
+}
+
+//AddPage appends a blank page to the document and returns it
+func (d *Document) AddPage() *Page {
+	p := &Page{}
+	d.pages = append(d.pages, p)
+	return p
+}
+
+//Text writes s with its baseline starting at x, y
+func (p *Page) Text(x, y float64, f Font, size float64, s string) {
+	fmt.Fprintf(&p.content, "BT /F%d %.2f Tf %.2f %.2f Td (%s) Tj ET\n", f+1, size, x, y, escape(encode(s)))
+}
+
+//TextRight writes s with its baseline ending at x, y, for columns of amounts
+func (p *Page) TextRight(x, y float64, f Font, size float64, s string) {
+	p.Text(x-Width(f, size, s), y, f, size, s)
+}
+
+//Line draws a thin line from x1, y1 to x2, y2
+func (p *Page) Line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(&p.content, "0.5 w %.2f %.2f m %.2f %.2f l S\n", x1, y1, x2, y2)
+}
+
+//Width returns how wide s is written in f at size
+func Width(f Font, size float64, s string) float64 {
+	widths := &helvetica
+	if f == Bold {
+		widths = &helveticaBold
+	}
+
+	var units int
+	for _, c := range encode(s) {
+		if c >= 32 && c <= 126 {
+			units += widths[c-32]
+		} else {
+			units += 556
+		}
+	}
+	return float64(units) * size / 1000
+}
+
+//WriteTo writes the document as a PDF file to w
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	buf := bufio.NewWriter(w)
+	out := &counter{w: buf}
+	var offsets []int64
+
+	object := func(body string) {
+		offsets = append(offsets, out.n)
+		fmt.Fprintf(out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	//objects 1 to 5 are the catalog, page tree, fonts and properties, then every page is its
+	//page object followed by its content stream
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 6+2*i)
+	}
+
+	fmt.Fprint(out, "%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	object(fmt.Sprintf("<< /Title (%s) /Producer (goserver) >>", escape(encode(d.Title))))
+
+	for i, p := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] "+
+			"/Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>", PageWidth, PageHeight, 7+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", p.content.Len(), p.content.Bytes()))
+	}
+
+	xref := out.n
+	fmt.Fprintf(out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, o := range offsets {
+		fmt.Fprintf(out, "%010d 00000 n \n", o)
+	}
+	fmt.Fprintf(out, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	if err := buf.Flush(); err != nil {
+		return out.n, err
+	}
+	return out.n, out.err
+}
+
+//encode returns s in WinAnsiEncoding, the Latin-1 letters the catalogs use map to themselves
+//and characters the fonts don't have become question marks
+func encode(s string) []byte {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r == '€':
+			b = append(b, 0x80)
+		case r < 0x80 || (r >= 0xa0 && r <= 0xff):
+			b = append(b, byte(r))
+		default:
+			b = append(b, '?')
+		}
+	}
+	return b
+}
+
+//escape quotes the characters that end or escape a PDF string
+func escape(b []byte) []byte {
+	var out bytes.Buffer
+	for _, c := range b {
+		switch c {
+		case '\\', '(', ')':
+			out.WriteByte('\\')
+			out.WriteByte(c)
+		case '\n', '\r':
+			out.WriteByte(' ')
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return out.Bytes()
+}
+
+//counter counts the bytes written, for the offsets of the cross reference table
+type counter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *counter) Write(b []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
+
+//widths of the printable ASCII characters, space to tilde, in thousandths of the font size
+var helvetica = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+var helveticaBold = [95]int{
+	278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+	975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+	333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+	611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+}
@@ -0,0 +1,60 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+	d := New("Invoice (1)")
+	p := d.AddPage()
+	p.Text(50, 800, Bold, 18, "Factura nº 1")
+	p.TextRight(545, 780, Regular, 10, "$60.00")
+	p.Line(50, 770, 545, 770)
+	d.AddPage().Text(50, 800, Regular, 10, `a \ b`)
+
+	var buf bytes.Buffer
+	n, err := d.WriteTo(&buf)
+	if err != nil || n != int64(buf.Len()) {
+		t.Fatalf("WriteTo wrote %d of %d bytes: %v", n, buf.Len(), err)
+	}
+	out := buf.Bytes()
+
+	if !bytes.HasPrefix(out, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(out, []byte("%%EOF\n")) {
+		t.Error("missing the PDF header or trailer")
+	}
+	for _, want := range []string{"/Count 2", "(Factura n\xba 1) Tj", `(a \\ b) Tj`, `/Title (Invoice \(1\))`} {
+		if !bytes.Contains(out, []byte(want)) {
+			t.Errorf("expected %q in the document", want)
+		}
+	}
+
+	//every entry of the cross reference table points at the start of its object
+	m := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(out)
+	if m == nil {
+		t.Fatal("no startxref")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(out[xref:], -1)
+	if len(entries) != 9 {
+		t.Fatalf("expected 9 objects but got %d", len(entries))
+	}
+	for i, e := range entries {
+		offset, _ := strconv.Atoi(string(e[1]))
+		if want := fmt.Sprintf("%d 0 obj", i+1); !bytes.HasPrefix(out[offset:], []byte(want)) {
+			t.Errorf("object %d is not at offset %d", i+1, offset)
+		}
+	}
+}
+
+func TestWidth(t *testing.T) {
+	if got := Width(Regular, 10, "$60.00"); got != 30.58 {
+		t.Errorf("expected 30.58 but got %v", got)
+	}
+	if Width(Bold, 10, "Total") <= Width(Regular, 10, "Total") {
+		t.Error("bold should be wider")
+	}
+}
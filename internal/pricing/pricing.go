@@ -0,0 +1,121 @@
+//Package pricing works out what a stay costs. Amounts are whole cents in an int64 so that
+//adding up lines never rounds
+package pricing
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/darinmilner/goserver/internal/dates"
+)
+
+//Rate is what a room type charges a night. Nightly covers up to Included guests, adults
+//first, and every guest past that pays ExtraAdult or ExtraChild a night on top
+type Rate struct {
+	Nightly    int64
+	Included   int
+	ExtraAdult int64
+	ExtraChild int64
+}
+
+//Stay is the dates and party a quote is for
+type Stay struct {
+	Start    time.Time
+	End      time.Time
+	Adults   int
+	Children int
+}
+
+//Nights returns the number of nights between the arrival and departure dates, counted the
+//same way as stay rules and cancellations
+func (s Stay) Nights() int {
+	n := dates.Between(s.Start, s.End)
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+//Guests returns the size of the party
+func (s Stay) Guests() int {
+	return s.Adults + s.Children
+}
+
+//Line is one item of a quote. Key is the catalog key of its description, which takes
+//Quantity as its argument, and Amount is Quantity times Unit
+type Line struct {
+	Key      string
+	Quantity int
+	Unit     int64
+	Amount   int64
+}
+
+//Quote is the itemized price of a stay. Taxes are charged on top of the lines, and Total is
+//the lines and the taxes that aren't inclusive
+type Quote struct {
+	Lines []Line
+	Taxes []TaxLine
+	Total int64
+}
+
+//Subtotal returns the price of the stay before the taxes charged on top
+func (q Quote) Subtotal() int64 {
+	var sub int64
+	for _, l := range q.Lines {
+		sub += l.Amount
+	}
+	return sub
+}
+
+//add appends a line to q unless its quantity or price is zero
+func (q *Quote) add(key string, quantity int, unit int64) {
+	if quantity <= 0 || unit == 0 {
+		return
+	}
+	amount := int64(quantity) * unit
+	q.Lines = append(q.Lines, Line{Key: key, Quantity: quantity, Unit: unit, Amount: amount})
+	q.Total += amount
+}
+
+//Calculate returns the quote for stay at rate with taxes charged on it
+func Calculate(rate Rate, stay Stay, taxes ...Tax) Quote {
+	var q Quote
+	nights := stay.Nights()
+
+	q.add("quote.room", nights, rate.Nightly)
+
+	//the included places go to adults first, whatever is left over covers children
+	extraAdults := max(stay.Adults-rate.Included, 0)
+	extraChildren := max(stay.Children-max(rate.Included-stay.Adults, 0), 0)
+
+	q.add("quote.extra_adult", extraAdults*nights, rate.ExtraAdult)
+	q.add("quote.extra_child", extraChildren*nights, rate.ExtraChild)
+
+	//percentages are of the stay alone, never of the other taxes
+	sub := q.Total
+	for _, t := range taxes {
+		amount := t.charge(stay, sub)
+		if amount == 0 {
+			continue
+		}
+		q.Taxes = append(q.Taxes, TaxLine{Name: t.Name, Amount: amount, Inclusive: t.Inclusive})
+		if !t.Inclusive {
+			q.Total += amount
+		}
+	}
+
+	return q
+}
+
+//Format returns cents as a decimal amount with two places, such as 1234.50
+func Format(cents int64) string {
+	sign := ""
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	frac := strconv.FormatInt(cents%100, 10)
+	if len(frac) == 1 {
+		frac = "0" + frac
+	}
+	return sign + strconv.FormatInt(cents/100, 10) + "." + frac
+}
@@ -0,0 +1,77 @@
+package pricing
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func stay(nights, adults, children int) Stay {
+	start := time.Date(2050, time.March, 7, 0, 0, 0, 0, time.UTC)
+	return Stay{Start: start, End: start.AddDate(0, 0, nights), Adults: adults, Children: children}
+}
+
+func TestCalculate(t *testing.T) {
+	rate := Rate{Nightly: 18000, Included: 2, ExtraAdult: 3000, ExtraChild: 1500}
+
+	tests := []struct {
+		name  string
+		stay  Stay
+		lines []Line
+		total int64
+	}{
+		{"included guests", stay(3, 2, 0), []Line{
+			{"quote.room", 3, 18000, 54000},
+		}, 54000},
+		{"extra adult", stay(2, 3, 0), []Line{
+			{"quote.room", 2, 18000, 36000},
+			{"quote.extra_adult", 2, 3000, 6000},
+		}, 42000},
+		{"child in an included place", stay(2, 1, 1), []Line{
+			{"quote.room", 2, 18000, 36000},
+		}, 36000},
+		{"extra children", stay(2, 2, 2), []Line{
+			{"quote.room", 2, 18000, 36000},
+			{"quote.extra_child", 4, 1500, 6000},
+		}, 42000},
+		{"no nights", stay(0, 2, 0), nil, 0},
+	}
+
+	for _, tt := range tests {
+		q := Calculate(rate, tt.stay)
+		if !reflect.DeepEqual(q.Lines, tt.lines) || q.Total != tt.total {
+			t.Errorf("%s: got %+v", tt.name, q)
+		}
+	}
+}
+
+func TestNightsAcrossDaylightSaving(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Madrid")
+	if err != nil {
+		t.Skip(err)
+	}
+	s := Stay{Start: time.Date(2050, time.March, 26, 0, 0, 0, 0, loc), End: time.Date(2050, time.March, 28, 0, 0, 0, 0, loc)}
+	if s.Nights() != 2 {
+		t.Errorf("expected 2 nights, got %d", s.Nights())
+	}
+}
+
+func TestNightsAcrossTimeZones(t *testing.T) {
+	//only 24 hours apart, but two calendar days
+	s := Stay{
+		Start: time.Date(2050, time.March, 26, 0, 0, 0, 0, time.FixedZone("UTC-10", -10*60*60)),
+		End:   time.Date(2050, time.March, 28, 0, 0, 0, 0, time.FixedZone("UTC+14", 14*60*60)),
+	}
+	if s.Nights() != 2 {
+		t.Errorf("expected 2 nights, got %d", s.Nights())
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := map[int64]string{0: "0.00", 5: "0.05", 12050: "120.50", -199: "-1.99"}
+	for cents, want := range tests {
+		if got := Format(cents); got != want {
+			t.Errorf("Format(%d) = %s, want %s", cents, got, want)
+		}
+	}
+}
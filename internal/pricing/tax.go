@@ -0,0 +1,88 @@
+package pricing
+
+import (
+	"time"
+
+	"github.com/darinmilner/goserver/internal/dates"
+)
+
+//What a fixed tax is charged for
+const (
+	PerStay        = "stay"
+	PerNight       = "night"
+	PerPerson      = "person"
+	PerPersonNight = "person_night"
+)
+
+//Tax is a tax or fee charged on a stay, on top of its price or, when Inclusive, as part of it.
+//A percentage tax has Amount in hundredths of a percent, 1000 for 10%, and is charged on the
+//lines of the quote. A fixed one charges Amount cents Per stay, night, person or person a night.
+//From and To are the first and last nights it is charged for, a zero one leaves that end open,
+//and a tax charged per stay or person is charged when the arrival falls between them
+type Tax struct {
+	Name      string
+	Percent   bool
+	Amount    int64
+	Per       string
+	Inclusive bool
+	From      time.Time
+	To        time.Time
+}
+
+//TaxLine is a tax charged on a quote. An inclusive one is already in the price of the lines
+type TaxLine struct {
+	Name      string
+	Amount    int64
+	Inclusive bool
+}
+
+//charge returns what t comes to on stay, whose lines add up to sub
+func (t Tax) charge(stay Stay, sub int64) int64 {
+	nights := stay.Nights()
+	if nights == 0 {
+		return 0
+	}
+
+	arrival := dates.Day(stay.Start)
+	charged := 0
+	for i := 0; i < nights; i++ {
+		if t.covers(arrival.AddDate(0, 0, i)) {
+			charged++
+		}
+	}
+
+	if t.Percent {
+		//of the nights the tax is charged for, rounded to the nearest cent. An inclusive
+		//tax is the part of the price that, with the tax added, makes it up
+		num := sub * int64(charged) * t.Amount
+		den := int64(nights) * 10000
+		if t.Inclusive {
+			den = int64(nights) * (10000 + t.Amount)
+		}
+		return (num + den/2) / den
+	}
+
+	switch t.Per {
+	case PerNight:
+		return t.Amount * int64(charged)
+	case PerPersonNight:
+		return t.Amount * int64(charged*stay.Guests())
+	case PerPerson:
+		if t.covers(arrival) {
+			return t.Amount * int64(stay.Guests())
+		}
+	default:
+		if t.covers(arrival) {
+			return t.Amount
+		}
+	}
+	return 0
+}
+
+//covers reports whether the night of d falls within the tax's dates
+func (t Tax) covers(d time.Time) bool {
+	if !t.From.IsZero() && d.Before(dates.Day(t.From)) {
+		return false
+	}
+	return t.To.IsZero() || !d.After(dates.Day(t.To))
+}
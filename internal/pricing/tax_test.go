@@ -0,0 +1,43 @@
+package pricing
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCalculateTaxes(t *testing.T) {
+	second := time.Date(2050, time.March, 8, 0, 0, 0, 0, time.UTC)
+	first := second.AddDate(0, 0, -1)
+
+	taxes := []Tax{
+		{Name: "Tourist tax", Amount: 150, Per: PerPersonNight, From: second},
+		{Name: "VAT included", Percent: true, Amount: 1000, Inclusive: true},
+		{Name: "VAT", Percent: true, Amount: 2100, To: first},
+		{Name: "Booking fee", Amount: 500, Per: PerStay, From: second},
+		{Name: "Linen", Amount: 200, Per: PerPerson},
+		{Name: "Parking", Amount: 100, Per: PerNight, To: first},
+	}
+
+	q := Calculate(Rate{Nightly: 10000, Included: 3}, stay(3, 2, 1), taxes...)
+
+	//the tourist tax is charged for the two nights from the 8th, the booking fee not at all as
+	//the guests arrive before it starts, and the VAT on the first night alone
+	want := []TaxLine{
+		{"Tourist tax", 900, false},
+		{"VAT included", 2727, true},
+		{"VAT", 2100, false},
+		{"Linen", 600, false},
+		{"Parking", 100, false},
+	}
+	if !reflect.DeepEqual(q.Taxes, want) {
+		t.Errorf("got taxes %+v", q.Taxes)
+	}
+	if q.Subtotal() != 30000 || q.Total != 33700 {
+		t.Errorf("expected 30000 before taxes and 33700 in all, got %d and %d", q.Subtotal(), q.Total)
+	}
+
+	if q := Calculate(Rate{Nightly: 10000}, stay(0, 2, 0), taxes...); q.Taxes != nil || q.Total != 0 {
+		t.Errorf("expected no taxes without nights, got %+v", q)
+	}
+}
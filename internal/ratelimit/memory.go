@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/darinmilner/goserver/internal/config"
+)
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+//MemoryStore keeps buckets in process. Each instance has its own buckets, so use PostgresStore
+//when running more than one
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+//NewMemoryStore returns an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+//Take implements Store
+func (s *MemoryStore) Take(ctx context.Context, key string, limit config.RateLimit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Requests), last: now}
+		s.buckets[key] = b
+	}
+
+	b.tokens = refill(b.tokens, now.Sub(b.last), limit)
+	b.last = now
+
+	if b.tokens < 1 {
+		return Result{RetryAfter: retryAfter(b.tokens, limit)}, nil
+	}
+
+	b.tokens--
+	return Result{Allowed: true}, nil
+}
+
+//Sweep implements Store
+func (s *MemoryStore) Sweep(ctx context.Context, idle time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := s.now().Add(-idle)
+	for k, b := range s.buckets {
+		if b.last.Before(cutoff) {
+			delete(s.buckets, k)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/darinmilner/goserver/internal/config"
+)
+
+//PostgresStore keeps buckets in the rate_limits table so every instance shares them
+type PostgresStore struct {
+	DB *sql.DB
+}
+
+//NewPostgresStore returns a store using the rate_limits table in db
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{DB: db}
+}
+
+//takeQuery refills and takes from a bucket in one statement, so concurrent requests from several
+//instances are serialised on the row lock. Time comes from the database so instance clocks don't matter
+const takeQuery = `
+	insert into rate_limits as rl (key, tokens, allowed, updated_at)
+	values ($1, $2 - 1, true, clock_timestamp())
+	on conflict (key) do update set
+		tokens = case
+			when least($2, rl.tokens + extract(epoch from clock_timestamp() - rl.updated_at) * $3) >= 1
+			then least($2, rl.tokens + extract(epoch from clock_timestamp() - rl.updated_at) * $3) - 1
+			else least($2, rl.tokens + extract(epoch from clock_timestamp() - rl.updated_at) * $3)
+		end,
+		allowed = least($2, rl.tokens + extract(epoch from clock_timestamp() - rl.updated_at) * $3) >= 1,
+		updated_at = clock_timestamp()
+	returning tokens, allowed`
+
+//Take implements Store
+func (s *PostgresStore) Take(ctx context.Context, key string, limit config.RateLimit) (Result, error) {
+	var tokens float64
+	var allowed bool
+
+	err := s.DB.QueryRowContext(ctx, takeQuery, key, float64(limit.Requests), limit.PerSecond()).Scan(&tokens, &allowed)
+	if err != nil {
+		return Result{}, err
+	}
+
+	if !allowed {
+		return Result{RetryAfter: retryAfter(tokens, limit)}, nil
+	}
+	return Result{Allowed: true}, nil
+}
+
+//Sweep implements Store
+func (s *PostgresStore) Sweep(ctx context.Context, idle time.Duration) error {
+	_, err := s.DB.ExecContext(ctx, `delete from rate_limits where updated_at < clock_timestamp() - $1 * interval '1 second'`, idle.Seconds())
+	return err
+}
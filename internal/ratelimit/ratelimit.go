@@ -0,0 +1,135 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/darinmilner/goserver/internal/config"
+	"github.com/darinmilner/goserver/internal/logging"
+)
+
+//Result is the outcome of taking a token from a bucket
+type Result struct {
+	Allowed    bool
+	RetryAfter time.Duration
+}
+
+//Store keeps one token bucket per key. Take refills the bucket for the time since it was last used,
+//up to the limit's burst, then takes a token if one is left
+type Store interface {
+	Take(ctx context.Context, key string, limit config.RateLimit) (Result, error)
+	//Sweep forgets buckets unused for longer than idle, they would be full again by then
+	Sweep(ctx context.Context, idle time.Duration) error
+}
+
+//refill returns the tokens in a bucket that held tokens elapsed ago, capped at the burst
+func refill(tokens float64, elapsed time.Duration, limit config.RateLimit) float64 {
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return math.Min(float64(limit.Requests), tokens+elapsed.Seconds()*limit.PerSecond())
+}
+
+//retryAfter returns how long until a bucket holding tokens has a whole token again
+func retryAfter(tokens float64, limit config.RateLimit) time.Duration {
+	return time.Duration((1 - tokens) / limit.PerSecond() * float64(time.Second))
+}
+
+//Limiter is middleware limiting requests to a route group per client IP. Rejected writes the
+//429 page once Retry-After is set, a plain text one is sent when it is nil
+type Limiter struct {
+	Store          Store
+	Group          string
+	Limit          config.RateLimit
+	TrustedProxies []*net.IPNet
+	Rejected       http.HandlerFunc
+}
+
+//Handler returns 429 Too Many Requests with a Retry-After header once a client has used up its bucket.
+//If the store fails the request is let through, a broken limiter must not take the site down
+func (l *Limiter) Handler(next http.Handler) http.Handler {
+	if l.Limit.Requests <= 0 {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := ClientIP(r, l.TrustedProxies)
+
+		res, err := l.Store.Take(r.Context(), l.Group+":"+ip, l.Limit)
+		if err != nil {
+			logging.FromContext(r.Context()).Error("rate limiter", slog.String("group", l.Group), slog.Any("error", err))
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !res.Allowed {
+			seconds := int(math.Ceil(res.RetryAfter.Seconds()))
+			if seconds < 1 {
+				seconds = 1
+			}
+			logging.FromContext(r.Context()).Warn("rate limited",
+				slog.String("group", l.Group),
+				slog.String("client_ip", ip),
+			)
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			if l.Rejected != nil {
+				l.Rejected(w, r)
+				return
+			}
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+//ClientIP returns the IP of the client that sent r. X-Forwarded-For is only believed when the request
+//came from a trusted proxy, and is read right to left so a client can't spoof it by sending its own header
+func ClientIP(r *http.Request, trusted []*net.IPNet) string {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ip = host
+	}
+
+	if !isTrusted(ip, trusted) {
+		return ip
+	}
+
+	var hops []string
+	for _, h := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(h, ",")...)
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		ip = hop
+		if !isTrusted(hop, trusted) {
+			break
+		}
+	}
+
+	return ip
+}
+
+func isTrusted(ip string, trusted []*net.IPNet) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, n := range trusted {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
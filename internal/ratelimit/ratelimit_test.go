@@ -0,0 +1,130 @@
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/darinmilner/goserver/internal/config"
+)
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+
+	limit := config.RateLimit{Requests: 3, Per: 3 * time.Second}
+
+	for i := 0; i < 3; i++ {
+		res, _ := s.Take(context.Background(), "k", limit)
+		if !res.Allowed {
+			t.Fatalf("request %d within the burst was refused", i+1)
+		}
+	}
+
+	res, _ := s.Take(context.Background(), "k", limit)
+	if res.Allowed {
+		t.Fatal("request over the burst was allowed")
+	}
+	if res.RetryAfter != time.Second {
+		t.Errorf("expected to retry after 1s but got %s", res.RetryAfter)
+	}
+
+	res, _ = s.Take(context.Background(), "other", limit)
+	if !res.Allowed {
+		t.Error("a different key should have its own bucket")
+	}
+
+	now = now.Add(time.Second)
+	res, _ = s.Take(context.Background(), "k", limit)
+	if !res.Allowed {
+		t.Error("bucket should have refilled one token after 1s")
+	}
+
+	now = now.Add(time.Hour)
+	_ = s.Sweep(context.Background(), time.Minute)
+	if len(s.buckets) != 0 {
+		t.Errorf("expected idle buckets to be swept but %d are left", len(s.buckets))
+	}
+}
+
+func TestLimiterHandler(t *testing.T) {
+	l := &Limiter{
+		Store: NewMemoryStore(),
+		Group: "login",
+		Limit: config.RateLimit{Requests: 1, Per: time.Minute},
+	}
+	h := l.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	send := func(remote string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/user/login", nil)
+		req.RemoteAddr = remote
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := send("10.0.0.1:1234"); rr.Code != http.StatusOK {
+		t.Fatalf("first request got %d", rr.Code)
+	}
+
+	rr := send("10.0.0.1:5678")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 but got %d", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") != "60" {
+		t.Errorf("expected Retry-After 60 but got %q", rr.Header().Get("Retry-After"))
+	}
+
+	if rr := send("10.0.0.2:1234"); rr.Code != http.StatusOK {
+		t.Errorf("another client should not be limited, got %d", rr.Code)
+	}
+
+	l.Rejected = func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte("error page"))
+	}
+	h = l.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rr = send("10.0.0.1:9012")
+	if rr.Code != http.StatusTooManyRequests || rr.Body.String() != "error page" {
+		t.Errorf("expected the rejected page but got %d %q", rr.Code, rr.Body)
+	}
+	if rr.Header().Get("Retry-After") == "" {
+		t.Error("Retry-After should be set before the rejected page is written")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+	trusted := []*net.IPNet{proxies}
+
+	tests := []struct {
+		name   string
+		remote string
+		xff    string
+		want   string
+	}{
+		{"direct", "203.0.113.5:1000", "", "203.0.113.5"},
+		{"untrusted sender ignores header", "203.0.113.5:1000", "198.51.100.1", "203.0.113.5"},
+		{"trusted proxy", "10.0.0.1:1000", "198.51.100.1", "198.51.100.1"},
+		{"spoofed first hop", "10.0.0.1:1000", "1.2.3.4, 198.51.100.1", "198.51.100.1"},
+		{"chain of proxies", "10.0.0.1:1000", "198.51.100.1, 10.0.0.2", "198.51.100.1"},
+		{"garbage header", "10.0.0.1:1000", "not-an-ip", "10.0.0.1"},
+	}
+
+	for _, e := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = e.remote
+		if e.xff != "" {
+			req.Header.Set("X-Forwarded-For", e.xff)
+		}
+
+		if got := ClientIP(req, trusted); got != e.want {
+			t.Errorf("%s: expected %s but got %s", e.name, e.want, got)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package render
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/darinmilner/goserver/internal/logging"
+)
+
+//overlayContext is how many lines either side of the failing line the overlay shows
+const overlayContext = 4
+
+//overlay is a standalone page, so it still works when the layouts are what's broken
+var overlay = template.Must(template.New("overlay").Parse(`<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Status}} {{.Title}}</title>
+<style>
+body { margin: 0; background: #1e1e1e; color: #eee; font: 14px/1.5 Menlo, Consolas, monospace; }
+main { max-width: 960px; margin: 40px auto; padding: 0 20px; }
+h1 { color: #ff6b6b; font-size: 20px; }
+pre { background: #2b2b2b; padding: 12px; overflow-x: auto; white-space: pre-wrap; }
+.source span { display: block; }
+.source .fail { background: #5a1d1d; }
+.muted { color: #999; }
+</style>
+</head>
+<body>
+<main>
+<h1>{{.Status}} {{.Title}}</h1>
+{{with .Template}}<p>in <strong>{{.}}</strong>{{with $.Line}} line <strong>{{.}}</strong>{{end}}</p>{{end}}
+<pre>{{.Error}}</pre>
+{{with .Source}}<pre class="source">{{range .}}<span{{if .Fail}} class="fail"{{end}}>{{printf "%4d" .Number}}  {{.Text}}</span>{{end}}</pre>{{end}}
+{{with .Chain}}<p class="muted">caused by</p><pre>{{range .}}{{.}}
+{{end}}</pre>{{end}}
+<p class="muted">request {{.RequestID}}. This page is only shown outside production.</p>
+</main>
+</body>
+</html>
+`))
+
+type sourceLine struct {
+	Number int
+	Text   string
+	Fail   bool
+}
+
+//ErrorDetails writes the error page for a server error. Outside production it shows err
+//instead, and for a template error the source around the failing line
+func ErrorDetails(w http.ResponseWriter, r *http.Request, status int, err error) {
+	if app.InProduction {
+		ErrorPage(w, r, status)
+		return
+	}
+
+	data := struct {
+		Status    int
+		Title     string
+		Template  string
+		Line      int
+		Error     string
+		Source    []sourceLine
+		Chain     []string
+		RequestID string
+	}{
+		Status:    status,
+		Title:     http.StatusText(status),
+		Error:     err.Error(),
+		RequestID: logging.RequestID(r.Context()),
+	}
+
+	var te *TemplateError
+	if errors.As(err, &te) {
+		data.Template, data.Line = te.Template, te.Line
+		data.Source = source(te.Template, te.Line)
+	}
+
+	for e := errors.Unwrap(err); e != nil; e = errors.Unwrap(e) {
+		data.Chain = append(data.Chain, fmt.Sprintf("%T: %s", e, e.Error()))
+	}
+
+	buf := new(bytes.Buffer)
+	if err := overlay.Execute(buf, data); err != nil {
+		logging.FromContext(r.Context()).Error("rendering error overlay", slog.Any("error", err))
+		http.Error(w, data.Error, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = buf.WriteTo(w)
+}
+
+//source returns the lines of tmpl around line, or nil if the template can't be read
+func source(tmpl string, line int) []sourceLine {
+	if line <= 0 || app.Templates == nil {
+		return nil
+	}
+
+	data, err := fs.ReadFile(app.Templates, tmpl)
+	if err != nil {
+		return nil
+	}
+
+	lines := strings.Split(string(data), "\n")
+	from, to := line-overlayContext, line+overlayContext
+	if from < 1 {
+		from = 1
+	}
+	if to > len(lines) {
+		to = len(lines)
+	}
+
+	var out []sourceLine
+	for n := from; n <= to; n++ {
+		out = append(out, sourceLine{Number: n, Text: lines[n-1], Fail: n == line})
+	}
+	return out
+}
@@ -0,0 +1,137 @@
+package render
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//TemplateError is a template that failed to parse or execute. Line is 0 when the error
+//doesn't say where it happened
+type TemplateError struct {
+	Template string
+	Line     int
+	Err      error
+}
+
+func (e *TemplateError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("render: %s line %d: %v", e.Template, e.Line, e.Err)
+	}
+	return fmt.Sprintf("render: %s: %v", e.Template, e.Err)
+}
+
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+//errorLocation matches the file and line text/template and html/template put in their errors,
+//such as "template: home.page.html:12:5: executing ..." or "html/template:base.layout.html:40:"
+var errorLocation = regexp.MustCompile(`template: ?([^:\s]+):(\d+)`)
+
+//templateError wraps err, taking the template and line from the message when it has them,
+//since a page can fail inside one of the layouts
+func templateError(tmpl string, err error) *TemplateError {
+	te := &TemplateError{Template: tmpl, Err: err}
+	if m := errorLocation.FindStringSubmatch(err.Error()); m != nil {
+		te.Template = m[1]
+		te.Line, _ = strconv.Atoi(m[2])
+	}
+	return te
+}
+
+//reloader holds the templates used while the cache is off. They are parsed on first use
+//and again by Watch whenever a template file changes
+type reloader struct {
+	mu     sync.Mutex
+	parsed bool
+	stamp  string
+	cache  map[string]*template.Template
+	err    error
+}
+
+var dev reloader
+
+//templates returns the templates parsed from fsys, or the error that stopped them parsing
+func (rl *reloader) templates(fsys fs.FS) (map[string]*template.Template, error) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if !rl.parsed {
+		rl.parse(fsys)
+	}
+	return rl.cache, rl.err
+}
+
+//check parses the templates again if a file in fsys changed since the last parse and
+//reports whether it did
+func (rl *reloader) check(fsys fs.FS) (bool, error) {
+	stamp, err := stampOf(fsys)
+	if err != nil {
+		return false, err
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if rl.parsed && stamp == rl.stamp {
+		return false, nil
+	}
+	changed := rl.parsed
+	rl.parse(fsys)
+	return changed, rl.err
+}
+
+func (rl *reloader) parse(fsys fs.FS) {
+	rl.parsed = true
+	rl.stamp, _ = stampOf(fsys)
+	rl.cache, rl.err = CreateTemplateCache(fsys, true)
+}
+
+//stampOf returns the name, size and modification time of every template, so that any edit,
+//new file or deletion changes it
+func stampOf(fsys fs.FS) (string, error) {
+	var b strings.Builder
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(name, ".html") {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "%s %d %d\n", name, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	return b.String(), err
+}
+
+//Watch rebuilds the templates whenever a file in app.Templates changes, checking every
+//interval until ctx is done. It is only needed when the template cache is off
+func Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		changed, err := dev.check(app.Templates)
+		switch {
+		case err != nil:
+			app.Logger.Error("Templates failed to parse", slog.Any("error", err))
+		case changed:
+			app.Logger.Info("Templates reloaded")
+		}
+	}
+}
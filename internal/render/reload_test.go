@@ -0,0 +1,113 @@
+package render
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/darinmilner/goserver/internal/models"
+	"github.com/darinmilner/goserver/templates"
+)
+
+func TestReloaderCheck(t *testing.T) {
+	fsys := fstest.MapFS{
+		"base.layout.html": {Data: []byte(`{{define "base"}}<main>{{block "content" .}}{{end}}</main>{{end}}`)},
+		"home.page.html":   {Data: []byte(`{{template "base" .}}{{define "content"}}home{{end}}`), ModTime: time.Unix(1, 0)},
+	}
+
+	var rl reloader
+	if _, err := rl.templates(fsys); err != nil {
+		t.Fatal(err)
+	}
+
+	changed, err := rl.check(fsys)
+	if err != nil || changed {
+		t.Errorf("unchanged files should not reload, got %v %v", changed, err)
+	}
+
+	fsys["home.page.html"] = &fstest.MapFile{Data: []byte(`{{template "base" .}}{{define "content"}}{{.Broken}{{end}}`), ModTime: time.Unix(2, 0)}
+	changed, err = rl.check(fsys)
+	if !changed || err == nil {
+		t.Errorf("expected a reload with a parse error, got %v %v", changed, err)
+	}
+	if _, err := rl.templates(fsys); err == nil {
+		t.Error("the parse error should be kept until the file is fixed")
+	}
+
+	fsys["about.page.html"] = &fstest.MapFile{Data: []byte(`{{template "base" .}}{{define "content"}}about{{end}}`)}
+	fsys["home.page.html"] = &fstest.MapFile{Data: []byte(`{{template "base" .}}{{define "content"}}home{{end}}`), ModTime: time.Unix(3, 0)}
+	changed, err = rl.check(fsys)
+	if !changed || err != nil {
+		t.Errorf("expected a clean reload, got %v %v", changed, err)
+	}
+
+	tc, _ := rl.templates(fsys)
+	if _, ok := tc["about.page.html"]; !ok {
+		t.Error("new page was not picked up")
+	}
+}
+
+func TestTemplateError(t *testing.T) {
+	err := templateError("home.page.html", errors.New(`template: base.layout.html:40:12: executing "base" at <.Nope>: map has no entry for key "Nope"`))
+	if err.Template != "base.layout.html" || err.Line != 40 {
+		t.Errorf("expected base.layout.html line 40 but got %s line %d", err.Template, err.Line)
+	}
+
+	err = templateError("home.page.html", errors.New("something else"))
+	if err.Template != "home.page.html" || err.Line != 0 {
+		t.Errorf("expected home.page.html without a line but got %s line %d", err.Template, err.Line)
+	}
+}
+
+func TestErrorDetails(t *testing.T) {
+	r, err := getSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	te := &TemplateError{Template: "home.page.html", Line: 3, Err: errors.New("boom")}
+
+	rr := httptest.NewRecorder()
+	ErrorDetails(rr, r, http.StatusInternalServerError, te)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500 but got %d", rr.Code)
+	}
+	body := rr.Body.String()
+	if !strings.Contains(body, "boom") || !strings.Contains(body, `class="fail"`) {
+		t.Errorf("overlay should show the error and the failing line:\n%s", body)
+	}
+
+	app.InProduction = true
+	defer func() { app.InProduction = false }()
+
+	app.TemplateCache, _ = CreateTemplateCache(templates.FS, false)
+	app.UseCache = true
+	defer func() { app.UseCache = false }()
+
+	rr = httptest.NewRecorder()
+	ErrorDetails(rr, r, http.StatusInternalServerError, te)
+	if strings.Contains(rr.Body.String(), "boom") {
+		t.Error("the error must not be shown in production")
+	}
+}
+
+func TestStrictTemplates(t *testing.T) {
+	fsys := fstest.MapFS{
+		"strict.page.html": {Data: []byte(`{{.View.missing}}`)},
+	}
+
+	tc, err := CreateTemplateCache(fsys, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sb strings.Builder
+	if err := tc["strict.page.html"].Execute(&sb, &models.TemplateData{View: map[string]string{}}); err == nil {
+		t.Error("strict templates should fail on a missing key")
+	}
+}
@@ -2,16 +2,25 @@ package render
 
 import (
 	"bytes"
-	"errors"
 	"fmt"
 	"html/template"
+	"io/fs"
+	"log/slog"
 	"net/http"
-	"path/filepath"
+	"path"
 	"time"
 
 	"github.com/darinmilner/goserver/internal/config"
+	"github.com/darinmilner/goserver/internal/i18n"
+	"github.com/darinmilner/goserver/internal/logging"
 	"github.com/darinmilner/goserver/internal/models"
+	"github.com/darinmilner/goserver/internal/pricing"
+	"github.com/darinmilner/goserver/internal/security"
+	"github.com/darinmilner/goserver/internal/tracing"
 	"github.com/justinas/nosurf"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var functions = template.FuncMap{
@@ -19,12 +28,15 @@ var functions = template.FuncMap{
 	"formatDate": FormatDate,
 	"iterate":    Iterate,
 	"add":        Add,
+	"asset":      Asset,
+	"t":          i18n.T,
+	"date":       i18n.FormatDate,
+	"locales":    i18n.Supported,
+	"money":      Money,
 }
 
 var app *config.AppConfig
 
-var pathToTemplates = "./templates"
-
 //NewRenderer sets the config of the template pkg
 func NewRenderer(a *config.AppConfig) {
 	app = a
@@ -39,11 +51,21 @@ func FormatDate(t time.Time, f string) string {
 	return t.Format(f)
 }
 
+//Money formats an amount in cents with the "price.format" of locale
+func Money(locale string, cents int64) string {
+	return i18n.T(locale, "price.format", pricing.Format(cents))
+}
+
 //Add adds two number together
 func Add(a, b int) int {
 	return a + b
 }
 
+//Asset returns the cache busting URL of a file under static, such as css/styles.css
+func Asset(name string) string {
+	return app.Assets.Path(name)
+}
+
 //Iterate returns a slice of ints from 1 to count
 func Iterate(count int) []int {
 	var i int
@@ -61,6 +83,8 @@ func AddDefaultData(td *models.TemplateData, r *http.Request) *models.TemplateDa
 	td.Warning = app.Session.PopString(r.Context(), "warning")
 	td.Error = app.Session.PopString(r.Context(), "error")
 	td.CSRFToken = nosurf.Token(r)
+	td.CSPNonce = security.Nonce(r.Context())
+	td.Locale = i18n.Locale(r.Context())
 	if app.Session.Exists(r.Context(), "userId") {
 		td.IsAuthenticated = 1
 	}
@@ -68,8 +92,65 @@ func AddDefaultData(td *models.TemplateData, r *http.Request) *models.TemplateDa
 	return td
 }
 
-//Template function
+//Template renders tmpl to w. The page is rendered into a buffer first, so nothing is written
+//when the template is missing or fails and the caller can still send an error page
 func Template(w http.ResponseWriter, r *http.Request, tmpl string, td *models.TemplateData) error {
+	buf, err := execute(r, tmpl, td)
+	if err != nil {
+		return err
+	}
+
+	_, err = buf.WriteTo(w)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("writing template to browser", slog.String("template", tmpl), slog.Any("error", err))
+		return err
+	}
+	return nil
+}
+
+//ErrorPage writes the error page for status through the site layout. If the page itself
+//can't be rendered a plain text body is sent instead
+func ErrorPage(w http.ResponseWriter, r *http.Request, status int) {
+	locale := i18n.Locale(r.Context())
+
+	message, ok := i18n.Lookup(locale, fmt.Sprintf("error.message.%d", status))
+	if !ok {
+		message = i18n.T(locale, "error.generic_server")
+		if status < http.StatusInternalServerError {
+			message = i18n.T(locale, "error.generic_client")
+		}
+	}
+
+	title, ok := i18n.Lookup(locale, fmt.Sprintf("error.title.%d", status))
+	if !ok {
+		title = http.StatusText(status)
+	}
+
+	td := &models.TemplateData{
+		View: models.ErrorView{
+			Status:    status,
+			Title:     title,
+			Message:   message,
+			RequestID: logging.RequestID(r.Context()),
+		},
+	}
+
+	buf, err := execute(r, "error.page.html", td)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("rendering error page", slog.Int("status", status), slog.Any("error", err))
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = buf.WriteTo(w)
+}
+
+//execute renders tmpl with the default data into a buffer
+func execute(r *http.Request, tmpl string, td *models.TemplateData) (*bytes.Buffer, error) {
+	_, span := tracing.Tracer().Start(r.Context(), "render.Template", trace.WithAttributes(attribute.String("template", tmpl)))
+	defer span.End()
 
 	var tc map[string]*template.Template
 
@@ -77,54 +158,65 @@ func Template(w http.ResponseWriter, r *http.Request, tmpl string, td *models.Te
 		//get the template cache from AppConfig
 		tc = app.TemplateCache
 	} else {
-		tc, _ = CreateTemplateCache()
+		var err error
+		tc, err = dev.templates(app.Templates)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "parsing templates")
+			return nil, templateError(tmpl, err)
+		}
 	}
 
 	t, ok := tc[tmpl]
 	if !ok {
-		return errors.New("Could not get template from the cache")
-
+		span.SetStatus(codes.Error, "template not in cache")
+		return nil, fmt.Errorf("render: template %s not found", tmpl)
 	}
 
 	buf := new(bytes.Buffer)
 
 	td = AddDefaultData(td, r)
-	_ = t.Execute(buf, td)
-
-	_, err := buf.WriteTo(w)
-	if err != nil {
-		fmt.Println("error writing template to browser", err)
-		return err
+	if err := t.Execute(buf, td); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "executing template")
+		return nil, templateError(tmpl, err)
 	}
-	return nil
+
+	return buf, nil
 }
 
-//CreateTemplateCache creates a map of templateCache
-func CreateTemplateCache() (map[string]*template.Template, error) {
+//CreateTemplateCache parses every *.page.html in fsys together with the *.layout.html files.
+//Strict templates fail on a missing map key instead of printing "<no value>"
+func CreateTemplateCache(fsys fs.FS, strict bool) (map[string]*template.Template, error) {
 
 	myCache := map[string]*template.Template{}
 
-	pages, err := filepath.Glob(fmt.Sprintf("%s/*.page.html", pathToTemplates))
+	pages, err := fs.Glob(fsys, "*.page.html")
 
 	if err != nil {
 		return myCache, err
 	}
 
 	for _, page := range pages {
-		name := filepath.Base(page)
+		name := path.Base(page)
+
+		ts := template.New(name).Funcs(functions)
+		if strict {
+			ts = ts.Option("missingkey=error")
+		}
 
-		ts, err := template.New(name).Funcs(functions).ParseFiles(page)
+		ts, err := ts.ParseFS(fsys, page)
 		if err != nil {
 			return myCache, err
 		}
 
-		matches, err := filepath.Glob(fmt.Sprintf("%s/*.layout.html", pathToTemplates))
+		matches, err := fs.Glob(fsys, "*.layout.html")
 		if err != nil {
 			return myCache, err
 		}
 
 		if len(matches) > 0 {
-			ts, err = ts.ParseGlob(fmt.Sprintf("%s/*.layout.html", pathToTemplates))
+			ts, err = ts.ParseFS(fsys, "*.layout.html")
 			if err != nil {
 				return myCache, err
 			}
@@ -1,11 +1,22 @@
 package render
 
 import (
-	"log"
+	"errors"
+	"html/template"
+	"io"
+	"io/fs"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/darinmilner/goserver/internal/cancellation"
+	"github.com/darinmilner/goserver/internal/forms"
+	"github.com/darinmilner/goserver/internal/i18n"
 	"github.com/darinmilner/goserver/internal/models"
+	"github.com/darinmilner/goserver/internal/pricing"
+	"github.com/darinmilner/goserver/templates"
 )
 
 func TestAddDefaultData(t *testing.T) {
@@ -27,10 +38,7 @@ func TestAddDefaultData(t *testing.T) {
 
 func TestRenderTemplate(t *testing.T) {
 
-	pathToTemplates = "./../../templates"
-	tc, err := CreateTemplateCache()
-
-	log.Println(pathToTemplates)
+	tc, err := CreateTemplateCache(templates.FS, true)
 
 	if err != nil {
 		t.Error(err)
@@ -57,6 +65,29 @@ func TestRenderTemplate(t *testing.T) {
 
 }
 
+func TestErrorPage(t *testing.T) {
+	tc, err := CreateTemplateCache(templates.FS, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.TemplateCache = tc
+
+	r, err := getSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	ErrorPage(rr, r, http.StatusNotFound)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), template.HTMLEscapeString(i18n.T(i18n.Default, "error.message.404"))) {
+		t.Error("error page is missing the 404 message")
+	}
+}
+
 func getSession() (*http.Request, error) {
 	r, err := http.NewRequest("GET", "/someurl", nil)
 	if err != nil {
@@ -75,10 +106,151 @@ func TestNewTemplates(t *testing.T) {
 }
 
 func TestCreateTemplateCache(t *testing.T) {
-	pathToTemplates = "./../../templates"
-
-	_, err := CreateTemplateCache()
+	_, err := CreateTemplateCache(templates.FS, true)
 	if err != nil {
 		t.Error(err)
 	}
 }
+
+//TestEveryPageParses checks every page against the layouts. Executing with empty data fails
+//on missing values, which is expected, but escaping errors and undefined templates are bugs
+func TestEveryPageParses(t *testing.T) {
+	tc, err := CreateTemplateCache(templates.FS, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pages, err := fs.Glob(templates.FS, "*.page.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, page := range pages {
+		ts, ok := tc[page]
+		if !ok {
+			t.Errorf("%s is missing from the cache", page)
+			continue
+		}
+
+		err := ts.Execute(io.Discard, &models.TemplateData{})
+		var terr *template.Error
+		if errors.As(err, &terr) {
+			t.Errorf("%s: %v", page, err)
+		}
+	}
+}
+
+//pageViews has a view for every page, filled in so that ranges run and both sides of the ifs
+//are taken. A page without one of its own gets nil
+var pageViews = func() map[string]interface{} {
+	day := time.Date(2050, time.March, 7, 0, 0, 0, 0, time.UTC)
+	roomType := models.RoomType{ID: 1, Name: "General's Quarters", MaxOccupancy: 4, IncludedGuests: 2, NightlyRate: 12000, ExtraAdultRate: 3000}
+	room := models.Room{ID: 1, RoomName: "General's Quarters 1", RoomTypeID: roomType.ID}
+	res := models.Reservation{
+		ID:        1,
+		FirstName: "John",
+		LastName:  "Smith",
+		Email:     "john@smith.com",
+		Phone:     "555-555-5555",
+		StartDate: day,
+		EndDate:   day.AddDate(0, 0, 2),
+		RoomID:    room.ID,
+		Room:      room,
+
+		RoomTypeID: roomType.ID,
+		RoomType:   roomType,
+		Adults:     3,
+		Children:   1,
+	}
+	quote := pricing.Calculate(roomType.Rate(), res.Stay(),
+		pricing.Tax{Name: "Tourist tax", Amount: 200, Per: pricing.PerPersonNight},
+		pricing.Tax{Name: "VAT", Percent: true, Amount: 1000, Inclusive: true})
+	res.Total = quote.Total
+	res.Deposit = 2000
+	res.AccessToken = "5L3t0k3n"
+	processed := res
+	processed.Processed = 1
+	cancelled := res
+	cancelled.CancelledAt = day.AddDate(0, 0, -20)
+
+	return map[string]interface{}{
+		"about.page.html":               nil,
+		"admin.dashboard.page.html":     nil,
+		"contact.page.html":             nil,
+		"generals.page.html":            nil,
+		"home.page.html":                nil,
+		"login.page.html":               nil,
+		"majors.page.html":              nil,
+		"search-availability.page.html": nil,
+
+		"make-reservation.page.html":       models.ReservationView{Reservation: res, Quote: quote, HoldSeconds: 900},
+		"checkout.page.html":               models.CheckoutView{Reservation: res, Quote: quote, Balance: res.Total - res.Deposit, TestMode: true},
+		"choose-room.page.html":            models.ChooseRoomView{Choices: []models.RoomChoice{{RoomType: roomType, Free: 2, Quote: quote}}},
+		"reservation-summary.page.html":    models.SummaryView{Reservation: res, Quote: quote, Balance: res.Total - res.Deposit},
+		"my-reservation.page.html":         models.MyReservationView{Reservation: cancelled, Paid: 2000, Balance: res.Total - 2000},
+		"admin.new-reservations.page.html": models.ReservationsView{Reservations: []models.Reservation{res}},
+		"admin.all-reservations.page.html": models.ReservationsView{Reservations: []models.Reservation{res, processed, cancelled}},
+		"admin.reservations.show.page.html": models.AdminReservationView{
+			Reservation: res,
+			Src:         "cal",
+			Year:        "2050",
+			Month:       "03",
+			Payments: []models.Payment{
+				{ID: 1, ReservationID: 1, Provider: "fake", Reference: "fake_pi_1", Kind: "charge", Amount: 2000, Currency: "usd", Status: "succeeded", CreatedAt: day},
+				{ID: 2, ReservationID: 1, Provider: "fake", Reference: "fake_re_2", Kind: "refund", Amount: 500, Currency: "usd", Status: "succeeded", CreatedAt: day},
+			},
+			Paid:    1500,
+			Balance: res.Total - 1500,
+			Policy:  models.CancellationPolicy{ID: 1, Name: "Standard", FreeDays: 14, PenaltyPercent: 50},
+			Cancel:  cancellation.Outcome{DaysBefore: 5, Penalty: res.Total / 2},
+		},
+		"admin.reservations.calendar.page.html": models.CalendarView{
+			Month:    day,
+			Previous: day.AddDate(0, -1, 0),
+			Next:     day.AddDate(0, 1, 0),
+			Rooms: []models.CalendarRoom{{
+				Room: room,
+				Days: []models.CalendarDay{
+					{Day: 1, Date: "2050-03-1"},
+					{Day: 2, Date: "2050-03-2", ReservationID: 1},
+					{Day: 3, Date: "2050-03-3", BlockID: 4},
+					{Day: 4, Date: "2050-03-4", Held: true},
+				},
+				Reservations: []models.CalendarReservation{{ID: 1, StartDate: day, EndDate: day.AddDate(0, 0, 2)}},
+				Moves:        []models.Room{{ID: 2, RoomName: "General's Quarters 2", RoomTypeID: roomType.ID}},
+			}},
+		},
+		"error.page.html": models.ErrorView{Status: 404, Title: "Not Found", Message: "Gone", RequestID: "abc"},
+	}
+}()
+
+//TestPageViews executes every page with its view under strict templates, so a template that
+//uses a field its view doesn't have fails here rather than on the live site
+func TestPageViews(t *testing.T) {
+	tc, err := CreateTemplateCache(templates.FS, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for page, ts := range tc {
+		view, ok := pageViews[page]
+		if !ok {
+			t.Errorf("%s has no entry in pageViews", page)
+			continue
+		}
+
+		td := &models.TemplateData{View: view, Form: forms.New(nil), Locale: i18n.Default}
+		if err := ts.Execute(io.Discard, td); err != nil {
+			t.Errorf("%s: %v", page, err)
+		}
+	}
+}
+
+func TestMoney(t *testing.T) {
+	if got := Money("en", 12050); got != "$120.50" {
+		t.Errorf("got %s", got)
+	}
+	if got := Money("es", 12050); got != "120.50 US$" {
+		t.Errorf("got %s", got)
+	}
+}
@@ -2,7 +2,6 @@ package render
 
 import (
 	"encoding/gob"
-	"log"
 	"net/http"
 	"os"
 	"testing"
@@ -10,7 +9,9 @@ import (
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/darinmilner/goserver/internal/config"
+	"github.com/darinmilner/goserver/internal/logging"
 	"github.com/darinmilner/goserver/internal/models"
+	"github.com/darinmilner/goserver/templates"
 )
 
 var session *scs.SessionManager
@@ -23,12 +24,7 @@ func TestMain(m *testing.M) {
 	//Change to true when in production
 	testApp.InProduction = false
 
-	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
-
-	testApp.InfoLog = infoLog
-
-	errorLog := log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
-	testApp.ErrorLog = errorLog
+	testApp.Logger = logging.New(testApp.InProduction, os.Stdout)
 
 	session = scs.New()
 	session.Lifetime = 24 * time.Hour
@@ -38,6 +34,7 @@ func TestMain(m *testing.M) {
 	session.Cookie.Secure = false //True in Production
 
 	testApp.Session = session
+	testApp.Templates = templates.FS
 
 	app = &testApp
 
@@ -1,12 +1,22 @@
 package dbrepo
 
 import (
+	"context"
 	"database/sql"
+	"time"
 
 	"github.com/darinmilner/goserver/internal/config"
+	"github.com/darinmilner/goserver/internal/metrics"
 	"github.com/darinmilner/goserver/internal/repository"
+	"github.com/darinmilner/goserver/internal/tracing"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
+//queryTimeout is how long a single repository call may take
+const queryTimeout = 3 * time.Second
+
 type postgresDBRepo struct {
 	App *config.AppConfig
 	DB  *sql.DB
@@ -29,3 +39,27 @@ func NewTestingRepo(a *config.AppConfig) repository.DatabaseRepo {
 		App: a,
 	}
 }
+
+//begin returns the context for a repository call, bounded by queryTimeout and carrying a span
+//named after the method, and a func that ends both and records how long the call took
+func (m *postgresDBRepo) begin(ctx context.Context, method string) (context.Context, func()) {
+	ctx, span := tracing.Tracer().Start(ctx, "DatabaseRepo."+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemNamePostgreSQL,
+			semconv.DBOperationName(method),
+		),
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	start := time.Now()
+
+	return ctx, func() {
+		if err := ctx.Err(); err == context.DeadlineExceeded {
+			span.SetStatus(codes.Error, err.Error())
+		}
+		cancel()
+		span.End()
+		metrics.QueryDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	}
+}
@@ -2,32 +2,93 @@ package dbrepo
 
 import (
 	"context"
+	"database/sql"
 	"errors"
-	"log"
 	"time"
 
+	"github.com/darinmilner/goserver/internal/i18n"
 	"github.com/darinmilner/goserver/internal/models"
+	"github.com/darinmilner/goserver/internal/pricing"
+	"github.com/darinmilner/goserver/internal/repository"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func (m *postgresDBRepo) AllUsers() bool {
+func (m *postgresDBRepo) AllUsers(ctx context.Context) bool {
 	return true
 }
 
+//rowQueryer is the pool or a transaction
+type rowQueryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
 //InsertReservation inserts a reservation to the DB
-func (m *postgresDBRepo) InsertReservation(res models.Reservation) (int, error) {
+func (m *postgresDBRepo) InsertReservation(ctx context.Context, res models.Reservation) (int, error) {
+
+	ctx, done := m.begin(ctx, "InsertReservation")
+	defer done()
+
+	return insertReservation(ctx, m.DB, res)
+}
+
+//BookReservation inserts a reservation and turns the guest's hold on its room into the
+//reservation's restriction, both or neither. It returns repository.ErrHoldExpired when the hold
+//has run out or been released, the room may be someone else's by then
+func (m *postgresDBRepo) BookReservation(ctx context.Context, res models.Reservation, holdID int) (int, error) {
+	ctx, done := m.begin(ctx, "BookReservation")
+	defer done()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
 
-	defer cancel()
+	newID, err := insertReservation(ctx, tx, res)
+	if err != nil {
+		return 0, err
+	}
 
+	err = insertQuote(ctx, tx, "reservation_lines", "reservation_id", newID, res.Quote)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		update room_restrictions set restriction_id = $1, reservation_id = $2, expires_at = null, updated_at = $3
+		where id = $4 and room_id = $5 and restriction_id = $6 and expires_at > now()`,
+		models.RestrictionReservation, newID, time.Now(), holdID, res.RoomID, models.RestrictionHold)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, repository.ErrHoldExpired
+	}
+
+	return newID, tx.Commit()
+}
+
+//insertReservation inserts res with q and returns its id
+func insertReservation(ctx context.Context, q rowQueryer, res models.Reservation) (int, error) {
 	var newID int
 
+	locale := res.Locale
+	if locale == "" {
+		locale = i18n.Default
+	}
+
 	stmt := `insert into reservations (first_name, last_name, email, phone,
-		start_date, end_date, room_id, created_at, updated_at)
-		values($1, $2, $3, $4, $5, $6, $7, $8, $9) returning id`
+		start_date, end_date, room_id, created_at, updated_at, locale,
+		adults, children, total, deposit, access_token)
+		values($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, nullif($15, '')) returning id`
 
-	err := m.DB.QueryRowContext(ctx, stmt,
+	err := q.QueryRowContext(ctx, stmt,
 		res.FirstName,
 		res.LastName,
 		res.Email,
@@ -37,6 +98,12 @@ func (m *postgresDBRepo) InsertReservation(res models.Reservation) (int, error)
 		res.RoomID,
 		time.Now(),
 		time.Now(),
+		locale,
+		res.Adults,
+		res.Children,
+		res.Total,
+		res.Deposit,
+		res.AccessToken,
 	).Scan(&newID)
 
 	if err != nil {
@@ -47,10 +114,9 @@ func (m *postgresDBRepo) InsertReservation(res models.Reservation) (int, error)
 }
 
 //InsertRoomRestriction inserts a room restriction into the DB
-func (m *postgresDBRepo) InsertRoomRestriction(r models.RoomRestriction) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-
-	defer cancel()
+func (m *postgresDBRepo) InsertRoomRestriction(ctx context.Context, r models.RoomRestriction) error {
+	ctx, done := m.begin(ctx, "InsertRoomRestriction")
+	defer done()
 
 	stmt := `insert into room_restrictions (start_date, end_date, room_id,
 			reservation_id, created_at, updated_at, restriction_id)
@@ -75,11 +141,10 @@ func (m *postgresDBRepo) InsertRoomRestriction(r models.RoomRestriction) error {
 }
 
 //SearchAvailabilityByRoomID returns true if roomID room is available and false if not available
-func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error) {
-
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end time.Time, roomID int) (bool, error) {
 
-	defer cancel()
+	ctx, done := m.begin(ctx, "SearchAvailabilityByDatesByRoomID")
+	defer done()
 
 	query := `
 	select
@@ -88,7 +153,8 @@ func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time,
 		room_restrictions
 	where
 		room_id = $1
-		and $2 < end_date and $3 > start_date;
+		and $2 < end_date and $3 > start_date
+		and (expires_at is null or expires_at > now());
 	`
 	row := m.DB.QueryRowContext(ctx, query, roomID, start, end)
 	var numRows int
@@ -105,33 +171,90 @@ func (m *postgresDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time,
 	return false, nil
 }
 
-//SearchAvailabilityForAllRooms return a slice of available rooms on a date range
-func (m *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+//SearchAvailabilityForAllRooms returns the room types that sleep guests with at least one room
+//free on a date range, with the number of free rooms
+func (m *postgresDBRepo) SearchAvailabilityForAllRooms(ctx context.Context, start, end time.Time, guests int) ([]models.RoomTypeAvailability, error) {
+	ctx, done := m.begin(ctx, "SearchAvailabilityForAllRooms")
+	defer done()
+
+	var types []models.RoomTypeAvailability
+	query := `
+	select
+		rt.id, rt.name, rt.max_occupancy, rt.included_guests, rt.nightly_rate,
+		rt.extra_adult_rate, rt.extra_child_rate, count(r.id)
+	from
+		room_types rt
+		join rooms r on (r.room_type_id = rt.id)
+	where rt.max_occupancy >= $3 and r.id not in
+	(select room_id from room_restrictions rr where 
+	$1 < rr.end_date and $2 > rr.start_date
+	and (rr.expires_at is null or rr.expires_at > now()))
+	group by rt.id
+	order by rt.name;
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, start, end, guests)
+	if err != nil {
+		return types, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t models.RoomTypeAvailability
+		err := rows.Scan(
+			&t.RoomType.ID,
+			&t.RoomType.Name,
+			&t.RoomType.MaxOccupancy,
+			&t.RoomType.IncludedGuests,
+			&t.RoomType.NightlyRate,
+			&t.RoomType.ExtraAdultRate,
+			&t.RoomType.ExtraChildRate,
+			&t.Free,
+		)
+
+		if err != nil {
+			return types, err
+		}
+
+		types = append(types, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return types, err
+	}
+	return types, nil
+}
 
-	defer cancel()
+//FreeRoomsOfType returns the rooms of a type that are free on a date range, lowest id first
+func (m *postgresDBRepo) FreeRoomsOfType(ctx context.Context, typeID int, start, end time.Time) ([]models.Room, error) {
+	ctx, done := m.begin(ctx, "FreeRoomsOfType")
+	defer done()
 
 	var rooms []models.Room
 	query := `
 	select
-		r.id, r.room_name
+		r.id, r.room_name, r.room_type_id
 	from
 		rooms r
-	where r.id not in
+	where r.room_type_id = $1 and r.id not in
 	(select room_id from room_restrictions rr where 
-	$1 < rr.end_date and $2 > rr.start_date);
+	$2 < rr.end_date and $3 > rr.start_date
+	and (rr.expires_at is null or rr.expires_at > now()))
+	order by r.id;
 	`
 
-	rows, err := m.DB.QueryContext(ctx, query, start, end)
+	rows, err := m.DB.QueryContext(ctx, query, typeID, start, end)
 	if err != nil {
 		return rooms, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
 		var room models.Room
 		err := rows.Scan(
 			&room.ID,
 			&room.RoomName,
+			&room.RoomTypeID,
 		)
 
 		if err != nil {
@@ -147,22 +270,611 @@ func (m *postgresDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]
 	return rooms, nil
 }
 
-//GetRoomByID gets a room by ID
-func (m *postgresDBRepo) GetRoomByID(id int) (models.Room, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+//ReassignRoom moves a reservation and its restriction to another room of the same type. It
+//returns repository.ErrRoomNotFree when the room is taken for any of the reservation's nights
+//and repository.ErrRoomTypeMismatch when it is of another type
+func (m *postgresDBRepo) ReassignRoom(ctx context.Context, reservationID, roomID int) error {
+	ctx, done := m.begin(ctx, "ReassignRoom")
+	defer done()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var start, end time.Time
+	var currentID, currentType int
+	err = tx.QueryRowContext(ctx, `
+		select r.start_date, r.end_date, r.room_id, rm.room_type_id
+		from reservations r
+		join rooms rm on (r.room_id = rm.id)
+		where r.id = $1
+		for update of r`, reservationID).Scan(&start, &end, &currentID, &currentType)
+	if err != nil {
+		return err
+	}
+	if currentID == roomID {
+		return nil
+	}
+
+	//locking the target room makes two moves into it wait for each other
+	var targetType int
+	err = tx.QueryRowContext(ctx, `select room_type_id from rooms where id = $1 for update`, roomID).Scan(&targetType)
+	if err != nil {
+		return err
+	}
+	if targetType != currentType {
+		return repository.ErrRoomTypeMismatch
+	}
+
+	var taken int
+	err = tx.QueryRowContext(ctx, `
+		select count(id) from room_restrictions
+		where room_id = $1 and $2 < end_date and $3 > start_date
+		and coalesce(reservation_id, 0) <> $4
+		and (expires_at is null or expires_at > now())`, roomID, start, end, reservationID).Scan(&taken)
+	if err != nil {
+		return err
+	}
+	if taken > 0 {
+		return repository.ErrRoomNotFree
+	}
+
+	_, err = tx.ExecContext(ctx, `update reservations set room_id = $1, updated_at = $2 where id = $3`,
+		roomID, time.Now(), reservationID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `update room_restrictions set room_id = $1, updated_at = $2 where reservation_id = $3`,
+		roomID, time.Now(), reservationID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+//StayRulesForDates returns the stay rules whose dates overlap start to end, for every room type
+func (m *postgresDBRepo) StayRulesForDates(ctx context.Context, start, end time.Time) ([]models.StayRule, error) {
+	ctx, done := m.begin(ctx, "StayRulesForDates")
+	defer done()
+
+	var rules []models.StayRule
+
+	query := `
+		select id, coalesce(room_type_id, 0), start_date, end_date, min_nights, max_nights,
+		no_arrival_days, no_departure_days, min_lead_days, max_advance_days, created_at, updated_at
+		from stay_rules
+		where start_date <= $2 and end_date >= $1
+		order by id
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r models.StayRule
+		err := rows.Scan(
+			&r.ID,
+			&r.RoomTypeID,
+			&r.StartDate,
+			&r.EndDate,
+			&r.MinNights,
+			&r.MaxNights,
+			&r.NoArrival,
+			&r.NoDeparture,
+			&r.MinLeadDays,
+			&r.MaxAdvanceDays,
+			&r.CreatedAt,
+			&r.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+//TaxRulesForDates returns the tax rules charged on some night from start to end, for every room
+//type, in the order they were added
+func (m *postgresDBRepo) TaxRulesForDates(ctx context.Context, start, end time.Time) ([]models.TaxRule, error) {
+	ctx, done := m.begin(ctx, "TaxRulesForDates")
+	defer done()
+
+	var rules []models.TaxRule
+
+	query := `
+		select id, coalesce(room_type_id, 0), name, kind = 'percent', amount, per, inclusive,
+		start_date, end_date, created_at, updated_at
+		from tax_rules
+		where (start_date is null or start_date < $2) and (end_date is null or end_date >= $1)
+		order by id
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r models.TaxRule
+		var startDate, endDate sql.NullTime
+		err := rows.Scan(
+			&r.ID,
+			&r.RoomTypeID,
+			&r.Name,
+			&r.Percent,
+			&r.Amount,
+			&r.Per,
+			&r.Inclusive,
+			&startDate,
+			&endDate,
+			&r.CreatedAt,
+			&r.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		r.StartDate, r.EndDate = startDate.Time, endDate.Time
+		rules = append(rules, r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+//HoldRoom holds the first room of a type free on a date range for ttl, returning the hold with
+//its room, or repository.ErrRoomNotFree when every room of the type is taken
+func (m *postgresDBRepo) HoldRoom(ctx context.Context, typeID int, start, end time.Time, ttl time.Duration) (models.RoomRestriction, error) {
+	ctx, done := m.begin(ctx, "HoldRoom")
+	defer done()
+
+	hold := models.RoomRestriction{
+		StartDate:     start,
+		EndDate:       end,
+		RestrictionID: models.RestrictionHold,
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return hold, err
+	}
+	defer tx.Rollback()
+
+	//locking the type's rooms makes two guests holding the last one wait for each other
+	_, err = tx.ExecContext(ctx, `select id from rooms where room_type_id = $1 for update`, typeID)
+	if err != nil {
+		return hold, err
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		select r.id, r.room_name, r.room_type_id
+		from rooms r
+		where r.room_type_id = $1 and r.id not in
+		(select room_id from room_restrictions rr where
+		$2 < rr.end_date and $3 > rr.start_date
+		and (rr.expires_at is null or rr.expires_at > now()))
+		order by r.id
+		limit 1`, typeID, start, end).Scan(&hold.Room.ID, &hold.Room.RoomName, &hold.Room.RoomTypeID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return hold, repository.ErrRoomNotFree
+	}
+	if err != nil {
+		return hold, err
+	}
+	hold.RoomID = hold.Room.ID
+
+	err = tx.QueryRowContext(ctx, `
+		insert into room_restrictions (start_date, end_date, room_id, restriction_id,
+			expires_at, created_at, updated_at)
+		values ($1, $2, $3, $4, now() + make_interval(secs => $5), $6, $6)
+		returning id, expires_at`,
+		start, end, hold.RoomID, models.RestrictionHold, ttl.Seconds(), time.Now()).Scan(&hold.ID, &hold.ExpiresAt)
+	if err != nil {
+		return hold, err
+	}
+
+	return hold, tx.Commit()
+}
+
+//ExtendHold makes a hold run for ttl from now. It returns repository.ErrHoldExpired when the
+//hold has already run out or been released, its room may be gone by then
+func (m *postgresDBRepo) ExtendHold(ctx context.Context, id int, ttl time.Duration) error {
+	ctx, done := m.begin(ctx, "ExtendHold")
+	defer done()
+
+	result, err := m.DB.ExecContext(ctx, `
+		update room_restrictions set expires_at = now() + make_interval(secs => $2), updated_at = $3
+		where id = $1 and restriction_id = $4 and expires_at > now()`,
+		id, ttl.Seconds(), time.Now(), models.RestrictionHold)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return repository.ErrHoldExpired
+	}
+	return nil
+}
+
+//ReleaseHold deletes a hold, releasing a hold that is gone is not an error
+func (m *postgresDBRepo) ReleaseHold(ctx context.Context, id int) error {
+	ctx, done := m.begin(ctx, "ReleaseHold")
+	defer done()
+
+	_, err := m.DB.ExecContext(ctx, `delete from room_restrictions where id = $1 and restriction_id = $2`,
+		id, models.RestrictionHold)
+	return err
+}
+
+//ClaimHoldPayment lets one checkout at a time take a hold's payment, for ttl at most, and
+//returns the intent an earlier try left on the hold, "" when there is none. It returns
+//repository.ErrHoldPaying while another checkout has the claim, and repository.ErrHoldExpired
+//when the hold has run out or was released
+func (m *postgresDBRepo) ClaimHoldPayment(ctx context.Context, id int, ttl time.Duration) (string, error) {
+	ctx, done := m.begin(ctx, "ClaimHoldPayment")
+	defer done()
+
+	var intentID string
+	err := m.DB.QueryRowContext(ctx, `
+		update room_restrictions set paying_until = now() + make_interval(secs => $2), updated_at = $3
+		where id = $1 and restriction_id = $4 and expires_at > now()
+		and (paying_until is null or paying_until <= now())
+		returning coalesce(payment_intent, '')`,
+		id, ttl.Seconds(), time.Now(), models.RestrictionHold).Scan(&intentID)
+	if err == nil || !errors.Is(err, sql.ErrNoRows) {
+		return intentID, err
+	}
+
+	var held bool
+	err = m.DB.QueryRowContext(ctx, `
+		select exists (select 1 from room_restrictions
+		where id = $1 and restriction_id = $2 and expires_at > now())`,
+		id, models.RestrictionHold).Scan(&held)
+	if err != nil {
+		return "", err
+	}
+	if held {
+		return "", repository.ErrHoldPaying
+	}
+	return "", repository.ErrHoldExpired
+}
+
+//SetHoldPaymentIntent records the intent a hold is being paid with, before it is captured, so
+//a later try captures the same one and the sweeper can give back what an abandoned hold took
+func (m *postgresDBRepo) SetHoldPaymentIntent(ctx context.Context, id int, intentID string) error {
+	ctx, done := m.begin(ctx, "SetHoldPaymentIntent")
+	defer done()
+
+	_, err := m.DB.ExecContext(ctx, `
+		update room_restrictions set payment_intent = $2, updated_at = $3
+		where id = $1 and restriction_id = $4`,
+		id, intentID, time.Now(), models.RestrictionHold)
+	return err
+}
 
-	defer cancel()
+//UnclaimHoldPayment ends a checkout's claim on a hold, leaving intentID as its payment for the
+//next try. intentID is "" once the payment has been given back
+func (m *postgresDBRepo) UnclaimHoldPayment(ctx context.Context, id int, intentID string) error {
+	ctx, done := m.begin(ctx, "UnclaimHoldPayment")
+	defer done()
+
+	_, err := m.DB.ExecContext(ctx, `
+		update room_restrictions set paying_until = null, payment_intent = nullif($2, ''), updated_at = $3
+		where id = $1 and restriction_id = $4`,
+		id, intentID, time.Now(), models.RestrictionHold)
+	return err
+}
+
+//GetReservationByHold gets the reservation a hold was booked as, sql.ErrNoRows when the hold
+//hasn't been
+func (m *postgresDBRepo) GetReservationByHold(ctx context.Context, holdID int) (models.Reservation, error) {
+	ctx, done := m.begin(ctx, "GetReservationByHold")
+	defer done()
+
+	//booking the hold gave it the reservation's id, holds and owner blocks have none
+	return m.queryReservation(ctx, `r.id = (select reservation_id from room_restrictions where id = $1)`, holdID)
+}
+
+//DeleteExpiredHolds deletes the holds that have run out and returns how many there were, with
+//the payment intents left on them. A hold whose payment is being taken is left to its checkout
+func (m *postgresDBRepo) DeleteExpiredHolds(ctx context.Context) (int64, []string, error) {
+	ctx, done := m.begin(ctx, "DeleteExpiredHolds")
+	defer done()
+
+	rows, err := m.DB.QueryContext(ctx, `
+		delete from room_restrictions where restriction_id = $1 and expires_at <= now()
+		and (paying_until is null or paying_until <= now())
+		returning coalesce(payment_intent, '')`,
+		models.RestrictionHold)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rows.Close()
+
+	var n int64
+	var intents []string
+	for rows.Next() {
+		var intentID string
+		if err := rows.Scan(&intentID); err != nil {
+			return n, intents, err
+		}
+		n++
+		if intentID != "" {
+			intents = append(intents, intentID)
+		}
+	}
+	return n, intents, rows.Err()
+}
+
+//InsertPayment records a charge or refund of a reservation
+func (m *postgresDBRepo) InsertPayment(ctx context.Context, p models.Payment) (int, error) {
+	ctx, done := m.begin(ctx, "InsertPayment")
+	defer done()
+
+	var id int
+	err := m.DB.QueryRowContext(ctx, `
+		insert into payments (reservation_id, provider, reference, kind, charge, amount, currency,
+			status, created_at, updated_at)
+		values ($1, $2, $3, $4, nullif($5, ''), $6, $7, $8, $9, $9) returning id`,
+		p.ReservationID, p.Provider, p.Reference, p.Kind, p.Charge, p.Amount, p.Currency, p.Status, time.Now(),
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+//UpdatePaymentStatus sets the status of the payment the provider knows by reference. It returns
+//sql.ErrNoRows when there is none, which a webhook racing the checkout can see
+func (m *postgresDBRepo) UpdatePaymentStatus(ctx context.Context, provider, reference, status string) error {
+	ctx, done := m.begin(ctx, "UpdatePaymentStatus")
+	defer done()
+
+	result, err := m.DB.ExecContext(ctx, `
+		update payments set status = $1, updated_at = $2 where provider = $3 and reference = $4`,
+		status, time.Now(), provider, reference)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+//PaymentsForReservation returns the charges and refunds of a reservation, oldest first
+func (m *postgresDBRepo) PaymentsForReservation(ctx context.Context, reservationID int) ([]models.Payment, error) {
+	ctx, done := m.begin(ctx, "PaymentsForReservation")
+	defer done()
+
+	var records []models.Payment
+
+	rows, err := m.DB.QueryContext(ctx, `
+		select id, reservation_id, provider, reference, kind, coalesce(charge, ''), amount, currency,
+		status, created_at, updated_at
+		from payments
+		where reservation_id = $1
+		order by created_at, id`, reservationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p models.Payment
+		err := rows.Scan(
+			&p.ID,
+			&p.ReservationID,
+			&p.Provider,
+			&p.Reference,
+			&p.Kind,
+			&p.Charge,
+			&p.Amount,
+			&p.Currency,
+			&p.Status,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, p)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+//GetCancellationPolicyByID returns a cancellation policy
+func (m *postgresDBRepo) GetCancellationPolicyByID(ctx context.Context, id int) (models.CancellationPolicy, error) {
+	ctx, done := m.begin(ctx, "GetCancellationPolicyByID")
+	defer done()
+
+	var p models.CancellationPolicy
+	err := m.DB.QueryRowContext(ctx, `
+		select id, name, free_days, penalty_percent, created_at, updated_at
+		from cancellation_policies where id = $1`, id,
+	).Scan(&p.ID, &p.Name, &p.FreeDays, &p.PenaltyPercent, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return p, err
+	}
+	return p, nil
+}
+
+//CancelReservation records c and marks its reservation cancelled, freeing the room's dates.
+//It returns repository.ErrAlreadyCancelled when the reservation was cancelled before
+func (m *postgresDBRepo) CancelReservation(ctx context.Context, c models.Cancellation) error {
+	ctx, done := m.begin(ctx, "CancelReservation")
+	defer done()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	//locking the reservation makes two admins cancelling it at once wait for each other
+	var cancelledAt sql.NullTime
+	err = tx.QueryRowContext(ctx, `select cancelled_at from reservations where id = $1 for update`,
+		c.ReservationID).Scan(&cancelledAt)
+	if err != nil {
+		return err
+	}
+	if cancelledAt.Valid {
+		return repository.ErrAlreadyCancelled
+	}
+
+	now := time.Now()
+	userID := sql.NullInt64{Int64: int64(c.UserID), Valid: c.UserID != 0}
+	_, err = tx.ExecContext(ctx, `
+		insert into cancellations (reservation_id, reason, actor, user_id, penalty, refund,
+			created_at, updated_at)
+		values ($1, $2, $3, $4, $5, $6, $7, $7)`,
+		c.ReservationID, c.Reason, c.Actor, userID, c.Penalty, c.Refund, now)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `update reservations set cancelled_at = $1, updated_at = $1 where id = $2`,
+		now, c.ReservationID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `delete from room_restrictions where reservation_id = $1`, c.ReservationID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+//GetCancellationByReservationID returns the cancellation of a reservation, sql.ErrNoRows when
+//it stands
+func (m *postgresDBRepo) GetCancellationByReservationID(ctx context.Context, reservationID int) (models.Cancellation, error) {
+	ctx, done := m.begin(ctx, "GetCancellationByReservationID")
+	defer done()
+
+	var c models.Cancellation
+	var userID sql.NullInt64
+	err := m.DB.QueryRowContext(ctx, `
+		select id, reservation_id, reason, actor, user_id, penalty, refund, created_at, updated_at
+		from cancellations where reservation_id = $1`, reservationID,
+	).Scan(&c.ID, &c.ReservationID, &c.Reason, &c.Actor, &userID, &c.Penalty, &c.Refund, &c.CreatedAt, &c.UpdatedAt)
+	if err != nil {
+		return c, err
+	}
+	c.UserID = int(userID.Int64)
+	return c, nil
+}
+
+//GetInvoiceByReservationID returns the invoice issued for a reservation, with what it bills,
+//sql.ErrNoRows when none has been
+func (m *postgresDBRepo) GetInvoiceByReservationID(ctx context.Context, reservationID int) (models.Invoice, error) {
+	ctx, done := m.begin(ctx, "GetInvoiceByReservationID")
+	defer done()
+
+	return queryInvoice(ctx, m.DB, reservationID)
+}
+
+//IssueInvoice issues inv for its reservation with the next number, saving what it bills. A
+//reservation has one invoice, so the one issued already is returned instead when there is one.
+//Numbers have no gaps, so invoices are issued one at a time
+func (m *postgresDBRepo) IssueInvoice(ctx context.Context, inv models.Invoice) (models.Invoice, error) {
+	ctx, done := m.begin(ctx, "IssueInvoice")
+	defer done()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return inv, err
+	}
+	defer tx.Rollback()
+
+	//the lock lets readers through but makes a second issuer wait for the first one's number
+	_, err = tx.ExecContext(ctx, `lock table invoices in share row exclusive mode`)
+	if err != nil {
+		return inv, err
+	}
+
+	issued, err := queryInvoice(ctx, tx, inv.ReservationID)
+	if err == nil {
+		return issued, tx.Commit()
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return inv, err
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		insert into invoices (number, reservation_id, total, paid, created_at, updated_at)
+		select coalesce(max(number), 0) + 1, $1, $2, $3, $4, $4 from invoices
+		returning id, number, created_at, updated_at`, inv.ReservationID, inv.Quote.Total, inv.Paid, time.Now(),
+	).Scan(&inv.ID, &inv.Number, &inv.CreatedAt, &inv.UpdatedAt)
+	if err != nil {
+		return inv, err
+	}
+
+	err = insertQuote(ctx, tx, "invoice_lines", "invoice_id", inv.ID, inv.Quote)
+	if err != nil {
+		return inv, err
+	}
+
+	return inv, tx.Commit()
+}
+
+//queryInvoice returns the invoice of a reservation with q, sql.ErrNoRows when it has none
+func queryInvoice(ctx context.Context, q rowQueryer, reservationID int) (models.Invoice, error) {
+	var inv models.Invoice
+	err := q.QueryRowContext(ctx, `
+		select id, number, reservation_id, total, paid, created_at, updated_at
+		from invoices where reservation_id = $1`, reservationID,
+	).Scan(&inv.ID, &inv.Number, &inv.ReservationID, &inv.Quote.Total, &inv.Paid, &inv.CreatedAt, &inv.UpdatedAt)
+	if err != nil {
+		return inv, err
+	}
+
+	total := inv.Quote.Total
+	inv.Quote, err = queryQuote(ctx, q, "invoice_lines", "invoice_id", inv.ID)
+	inv.Quote.Total = total
+	return inv, err
+}
+
+//GetRoomByID gets a room by ID
+func (m *postgresDBRepo) GetRoomByID(ctx context.Context, id int) (models.Room, error) {
+	ctx, done := m.begin(ctx, "GetRoomByID")
+	defer done()
 
 	var room models.Room
 
 	query := `
-		select id, room_name, created_at, updated_at from rooms where id = $1
+		select id, room_name, room_type_id, created_at, updated_at from rooms where id = $1
 	`
 
 	row := m.DB.QueryRowContext(ctx, query, id)
 
 	err := row.Scan(
-		&room.ID, &room.RoomName, &room.CreatedAt, &room.UpdatedAt,
+		&room.ID, &room.RoomName, &room.RoomTypeID, &room.CreatedAt, &room.UpdatedAt,
 	)
 
 	if err != nil {
@@ -172,11 +884,34 @@ func (m *postgresDBRepo) GetRoomByID(id int) (models.Room, error) {
 
 }
 
-//GetUserByID gets a user by ID from the DB
-func (m *postgresDBRepo) GetUserByID(id int) (models.User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+//GetRoomTypeByID gets a room type by ID
+func (m *postgresDBRepo) GetRoomTypeByID(ctx context.Context, id int) (models.RoomType, error) {
+	ctx, done := m.begin(ctx, "GetRoomTypeByID")
+	defer done()
+
+	var rt models.RoomType
+
+	query := `
+		select id, name, max_occupancy, included_guests, nightly_rate,
+		extra_adult_rate, extra_child_rate, cancellation_policy_id, created_at, updated_at
+		from room_types where id = $1
+	`
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&rt.ID, &rt.Name, &rt.MaxOccupancy, &rt.IncludedGuests, &rt.NightlyRate,
+		&rt.ExtraAdultRate, &rt.ExtraChildRate, &rt.CancellationPolicyID, &rt.CreatedAt, &rt.UpdatedAt,
+	)
+
+	if err != nil {
+		return rt, err
+	}
+	return rt, nil
+}
 
-	defer cancel()
+//GetUserByID gets a user by ID from the DB
+func (m *postgresDBRepo) GetUserByID(ctx context.Context, id int) (models.User, error) {
+	ctx, done := m.begin(ctx, "GetUserByID")
+	defer done()
 
 	query := `
 	select id, first_name, last_name, email, password, access_level, created_at ,updated_at
@@ -206,10 +941,9 @@ func (m *postgresDBRepo) GetUserByID(id int) (models.User, error) {
 }
 
 //UpdateUser updates user in a DB
-func (m *postgresDBRepo) UpdateUser(u models.User) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-
-	defer cancel()
+func (m *postgresDBRepo) UpdateUser(ctx context.Context, u models.User) error {
+	ctx, done := m.begin(ctx, "UpdateUser")
+	defer done()
 
 	query := `
 		update users set first_name = $1,last_name = $2, email =$3, access_level = $4, updated_at =$5
@@ -227,10 +961,9 @@ func (m *postgresDBRepo) UpdateUser(u models.User) error {
 }
 
 //Authenticate authenticates a user
-func (m *postgresDBRepo) Authenticate(email, testPassword string) (int, string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-
-	defer cancel()
+func (m *postgresDBRepo) Authenticate(ctx context.Context, email, testPassword string) (int, string, error) {
+	ctx, done := m.begin(ctx, "Authenticate")
+	defer done()
 
 	var id int
 	var hashedPassword string
@@ -254,18 +987,17 @@ func (m *postgresDBRepo) Authenticate(email, testPassword string) (int, string,
 }
 
 //AllReservations returns a slice of all reservations
-func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
+func (m *postgresDBRepo) AllReservations(ctx context.Context) ([]models.Reservation, error) {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-
-	defer cancel()
+	ctx, done := m.begin(ctx, "AllReservations")
+	defer done()
 
 	var reservations []models.Reservation
 
 	query := `
 		select r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, 
 		r.end_date, r.room_id, r.created_at, r.updated_at, r.processed,
-		rm.id, rm.room_name
+		r.cancelled_at, rm.id, rm.room_name
 		from reservations r
 		left join rooms rm on (r.room_id = rm.id)
 		order by r.start_date asc
@@ -280,6 +1012,7 @@ func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
 
 	for rows.Next() {
 		var i models.Reservation
+		var cancelledAt sql.NullTime
 		err := rows.Scan(
 			&i.ID,
 			&i.FirstName,
@@ -292,12 +1025,14 @@ func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.Processed,
+			&cancelledAt,
 			&i.Room.ID,
 			&i.Room.RoomName,
 		)
 		if err != nil {
 			return reservations, err
 		}
+		i.CancelledAt = cancelledAt.Time
 
 		reservations = append(reservations, i)
 	}
@@ -309,11 +1044,10 @@ func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
 }
 
 //AllNewReservations returns a slice of all reservations
-func (m *postgresDBRepo) AllNewReservations() ([]models.Reservation, error) {
-
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) AllNewReservations(ctx context.Context) ([]models.Reservation, error) {
 
-	defer cancel()
+	ctx, done := m.begin(ctx, "AllNewReservations")
+	defer done()
 
 	var reservations []models.Reservation
 
@@ -323,7 +1057,7 @@ func (m *postgresDBRepo) AllNewReservations() ([]models.Reservation, error) {
 		rm.id, rm.room_name
 		from reservations r
 		left join rooms rm on (r.room_id = rm.id)
-		where processed = 0
+		where processed = 0 and r.cancelled_at is null
 		order by r.start_date asc
 	`
 
@@ -364,24 +1098,40 @@ func (m *postgresDBRepo) AllNewReservations() ([]models.Reservation, error) {
 }
 
 //GetReservationByID gets on reservation by ID
-func (m *postgresDBRepo) GetReservationByID(id int) (models.Reservation, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+func (m *postgresDBRepo) GetReservationByID(ctx context.Context, id int) (models.Reservation, error) {
+	ctx, done := m.begin(ctx, "GetReservationByID")
+	defer done()
 
-	defer cancel()
+	return m.queryReservation(ctx, "r.id = $1", id)
+}
+
+//GetReservationByToken gets the reservation a guest's access token opens, sql.ErrNoRows when
+//there is none
+func (m *postgresDBRepo) GetReservationByToken(ctx context.Context, token string) (models.Reservation, error) {
+	ctx, done := m.begin(ctx, "GetReservationByToken")
+	defer done()
 
+	return m.queryReservation(ctx, "r.access_token = $1", token)
+}
+
+//queryReservation gets the reservation matching where, which compares a column with $1
+func (m *postgresDBRepo) queryReservation(ctx context.Context, where string, arg interface{}) (models.Reservation, error) {
 	var res models.Reservation
+	var cancelledAt sql.NullTime
 
 	query := `
 		select r.id, r.first_name, r.last_name, r.email,
 		r.phone, r.start_date, r.end_date, r.room_id, 
-		r.created_at, r.updated_at, r.processed, 
-		rm.id, rm.room_name
+		r.created_at, r.updated_at, r.processed, r.locale,
+		r.adults, r.children, r.total, r.deposit, r.cancelled_at,
+		coalesce(r.access_token, ''),
+		rm.id, rm.room_name, rm.room_type_id, rt.id, rt.name, rt.cancellation_policy_id
 		from reservations r
 		left join rooms rm on (r.room_id = rm.id)
-		where r.id = $1
-	`
+		left join room_types rt on (rm.room_type_id = rt.id)
+		where ` + where
 
-	row := m.DB.QueryRowContext(ctx, query, id)
+	row := m.DB.QueryRowContext(ctx, query, arg)
 	err := row.Scan(
 		&res.ID,
 		&res.FirstName,
@@ -394,22 +1144,99 @@ func (m *postgresDBRepo) GetReservationByID(id int) (models.Reservation, error)
 		&res.CreatedAt,
 		&res.UpdatedAt,
 		&res.Processed,
+		&res.Locale,
+		&res.Adults,
+		&res.Children,
+		&res.Total,
+		&res.Deposit,
+		&cancelledAt,
+		&res.AccessToken,
 		&res.Room.ID,
 		&res.Room.RoomName,
+		&res.Room.RoomTypeID,
+		&res.RoomType.ID,
+		&res.RoomType.Name,
+		&res.RoomType.CancellationPolicyID,
 	)
 
 	if err != nil {
 		return res, err
 	}
+	res.RoomTypeID = res.RoomType.ID
+	res.CancelledAt = cancelledAt.Time
+
+	res.Quote, err = queryQuote(ctx, m.DB, "reservation_lines", "reservation_id", res.ID)
+	if err != nil {
+		return res, err
+	}
+	if len(res.Quote.Lines) > 0 {
+		res.Quote.Total = res.Total
+	}
 
 	return res, nil
 }
 
-//UpdateReservvation updates reservation in a DB
-func (m *postgresDBRepo) UpdateReservation(u models.Reservation) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+//insertQuote saves the lines and taxes of quote in table, a reservation_lines like one whose
+//owner column refers to id
+func insertQuote(ctx context.Context, tx *sql.Tx, table, owner string, id int, quote pricing.Quote) error {
+	stmt := `insert into ` + table + ` (` + owner + `, position, kind, description,
+		quantity, unit_amount, amount, inclusive)
+		values ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	position := 0
+	for _, l := range quote.Lines {
+		position++
+		_, err := tx.ExecContext(ctx, stmt, id, position, "line", l.Key, l.Quantity, l.Unit, l.Amount, false)
+		if err != nil {
+			return err
+		}
+	}
+	for _, t := range quote.Taxes {
+		position++
+		_, err := tx.ExecContext(ctx, stmt, id, position, "tax", t.Name, 0, 0, t.Amount, t.Inclusive)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//queryQuote returns the lines and taxes insertQuote saved for id with q. Its Total is left for
+//the caller, which keeps it with the owner
+func queryQuote(ctx context.Context, q rowQueryer, table, owner string, id int) (pricing.Quote, error) {
+	var quote pricing.Quote
+
+	rows, err := q.QueryContext(ctx, `
+		select kind, description, quantity, unit_amount, amount, inclusive
+		from `+table+` where `+owner+` = $1 order by position`, id)
+	if err != nil {
+		return quote, err
+	}
+	defer rows.Close()
 
-	defer cancel()
+	for rows.Next() {
+		var kind, description string
+		var l pricing.Line
+		var inclusive bool
+		err := rows.Scan(&kind, &description, &l.Quantity, &l.Unit, &l.Amount, &inclusive)
+		if err != nil {
+			return quote, err
+		}
+		if kind == "tax" {
+			quote.Taxes = append(quote.Taxes, pricing.TaxLine{Name: description, Amount: l.Amount, Inclusive: inclusive})
+			continue
+		}
+		l.Key = description
+		quote.Lines = append(quote.Lines, l)
+	}
+
+	return quote, rows.Err()
+}
+
+//UpdateReservvation updates reservation in a DB
+func (m *postgresDBRepo) UpdateReservation(ctx context.Context, u models.Reservation) error {
+	ctx, done := m.begin(ctx, "UpdateReservation")
+	defer done()
 
 	query := `
 		update reservations set first_name = $1,last_name = $2, email =$3, phone = $4, updated_at = $5
@@ -428,27 +1255,44 @@ func (m *postgresDBRepo) UpdateReservation(u models.Reservation) error {
 }
 
 //DeleteReservation deletes one reservation from the DB
-func (m *postgresDBRepo) DeleteReservation(id int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	query := `
-		delete from reservations where id = $1
-	`
+func (m *postgresDBRepo) DeleteReservation(ctx context.Context, id int) error {
+	ctx, done := m.begin(ctx, "DeleteReservation")
+	defer done()
 
-	_, err := m.DB.ExecContext(ctx, query, id)
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	//locking the reservation makes a payment or invoice being recorded for it wait
+	var billed bool
+	err = tx.QueryRowContext(ctx, `
+		select exists (select 1 from payments where reservation_id = r.id)
+			or exists (select 1 from invoices where reservation_id = r.id)
+		from reservations r where r.id = $1 for update`, id).Scan(&billed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if billed {
+		return repository.ErrReservationBilled
+	}
 
+	_, err = tx.ExecContext(ctx, `delete from reservations where id = $1`, id)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return tx.Commit()
 }
 
 //UpdateProcessedForReservation updates if the reservation has been processed
-func (m *postgresDBRepo) UpdateProcessedForReservation(id, processed int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+func (m *postgresDBRepo) UpdateProcessedForReservation(ctx context.Context, id, processed int) error {
+	ctx, done := m.begin(ctx, "UpdateProcessedForReservation")
+	defer done()
 
 	query := `
 		update reservations set processed = $1 where id = $2
@@ -463,13 +1307,13 @@ func (m *postgresDBRepo) UpdateProcessedForReservation(id, processed int) error
 	return nil
 }
 
-func (m *postgresDBRepo) AllRooms() ([]models.Room, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+func (m *postgresDBRepo) AllRooms(ctx context.Context) ([]models.Room, error) {
+	ctx, done := m.begin(ctx, "AllRooms")
+	defer done()
 
 	var rooms []models.Room
 
-	query := `select id, room_name, created_at, updated_at from rooms order by room_name`
+	query := `select id, room_name, room_type_id, created_at, updated_at from rooms order by room_type_id, room_name`
 
 	rows, err := m.DB.QueryContext(ctx, query)
 
@@ -482,6 +1326,7 @@ func (m *postgresDBRepo) AllRooms() ([]models.Room, error) {
 		err := rows.Scan(
 			&rm.ID,
 			&rm.RoomName,
+			&rm.RoomTypeID,
 			&rm.CreatedAt,
 			&rm.UpdatedAt,
 		)
@@ -501,9 +1346,9 @@ func (m *postgresDBRepo) AllRooms() ([]models.Room, error) {
 }
 
 //GetRestrictionsForRoomByDate returns the room restrictions for each day
-func (m *postgresDBRepo) GetRestrictionsForRoomByDate(roomId int, start, end time.Time) ([]models.RoomRestriction, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+func (m *postgresDBRepo) GetRestrictionsForRoomByDate(ctx context.Context, roomId int, start, end time.Time) ([]models.RoomRestriction, error) {
+	ctx, done := m.begin(ctx, "GetRestrictionsForRoomByDate")
+	defer done()
 
 	var restrictions []models.RoomRestriction
 
@@ -511,7 +1356,7 @@ func (m *postgresDBRepo) GetRestrictionsForRoomByDate(roomId int, start, end tim
 		select id, coalesce (reservation_id, 0), restriction_id, room_id,
 		start_date, end_date
 		from room_restrictions where $1 < end_date and $2 >= start_date
-		and room_id = $3
+		and room_id = $3 and (expires_at is null or expires_at > now())
 	`
 
 	rows, err := m.DB.QueryContext(ctx, query, start, end, roomId)
@@ -543,9 +1388,9 @@ func (m *postgresDBRepo) GetRestrictionsForRoomByDate(roomId int, start, end tim
 }
 
 //InsertBlockForRoom inserts a new block for each room
-func (m *postgresDBRepo) InsertBlockForRoom(id int, startDate time.Time) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+func (m *postgresDBRepo) InsertBlockForRoom(ctx context.Context, id int, startDate time.Time) error {
+	ctx, done := m.begin(ctx, "InsertBlockForRoom")
+	defer done()
 
 	query := `insert into room_restrictions 
 	(start_date, end_date, room_id, restriction_id,
@@ -554,7 +1399,6 @@ func (m *postgresDBRepo) InsertBlockForRoom(id int, startDate time.Time) error {
 	_, err := m.DB.ExecContext(ctx, query, startDate, startDate.AddDate(0, 0, 1), id, 2, time.Now(), time.Now())
 
 	if err != nil {
-		log.Println(err)
 		return err
 	}
 
@@ -562,16 +1406,15 @@ func (m *postgresDBRepo) InsertBlockForRoom(id int, startDate time.Time) error {
 }
 
 //DeleteBlockByID deletes a block for each room
-func (m *postgresDBRepo) DeleteBlockByID(id int) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+func (m *postgresDBRepo) DeleteBlockByID(ctx context.Context, id int) error {
+	ctx, done := m.begin(ctx, "DeleteBlockByID")
+	defer done()
 
 	query := `delete from room_restrictions where id = $1`
 
 	_, err := m.DB.ExecContext(ctx, query, id)
 
 	if err != nil {
-		log.Println(err)
 		return err
 	}
 
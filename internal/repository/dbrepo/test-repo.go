@@ -1,19 +1,24 @@
 package dbrepo
 
 import (
+	"context"
+	"database/sql"
 	"errors"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/darinmilner/goserver/internal/models"
+	"github.com/darinmilner/goserver/internal/pricing"
+	"github.com/darinmilner/goserver/internal/repository"
 )
 
-func (m *testDBRepo) AllUsers() bool {
+func (m *testDBRepo) AllUsers(ctx context.Context) bool {
 	return true
 }
 
 //InsertReservation inserts a reservation to the DB
-func (m *testDBRepo) InsertReservation(res models.Reservation) (int, error) {
+func (m *testDBRepo) InsertReservation(ctx context.Context, res models.Reservation) (int, error) {
 
 	if res.RoomID == 2 {
 		return 0, errors.New("An error occurred")
@@ -21,8 +26,20 @@ func (m *testDBRepo) InsertReservation(res models.Reservation) (int, error) {
 	return 1, nil
 }
 
+//BookReservation books a reservation as 1, it fails to insert one in room 2 and to turn the
+//hold on room 200000 into its restriction, and the hold on room 300000 has run out
+func (m *testDBRepo) BookReservation(ctx context.Context, res models.Reservation, holdID int) (int, error) {
+	switch res.RoomID {
+	case 2, 200_000:
+		return 0, errors.New("An error occurred")
+	case 300_000:
+		return 0, repository.ErrHoldExpired
+	}
+	return 1, nil
+}
+
 //InsertRoomRestriction inserts a room restriction into the DB
-func (m *testDBRepo) InsertRoomRestriction(r models.RoomRestriction) error {
+func (m *testDBRepo) InsertRoomRestriction(ctx context.Context, r models.RoomRestriction) error {
 
 	if r.RoomID == 200_000 {
 		return errors.New("An error occurred")
@@ -31,7 +48,7 @@ func (m *testDBRepo) InsertRoomRestriction(r models.RoomRestriction) error {
 }
 
 //SearchAvailabilityByRoomID returns true if roomID room is available and false if not available
-func (m *testDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error) {
+func (m *testDBRepo) SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end time.Time, roomID int) (bool, error) {
 
 	layout := "2006-01-02"
 	str := "2049-12-31"
@@ -60,16 +77,225 @@ func (m *testDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time, roo
 	return true, nil
 }
 
-//SearchAvailabilityForAllRooms return a slice of available rooms on a date range
-func (m *testDBRepo) SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error) {
+//SearchAvailabilityForAllRooms returns the room types with free rooms on a date range
+func (m *testDBRepo) SearchAvailabilityForAllRooms(ctx context.Context, start, end time.Time, guests int) ([]models.RoomTypeAvailability, error) {
 
-	var rooms []models.Room
+	var types []models.RoomTypeAvailability
 
-	return rooms, nil
+	return types, nil
+}
+
+//FreeRoomsOfType returns the free rooms of a type, one room with the type's id when the
+//dates are available the way SearchAvailabilityByDatesByRoomID sees them
+func (m *testDBRepo) FreeRoomsOfType(ctx context.Context, typeID int, start, end time.Time) ([]models.Room, error) {
+	available, err := m.SearchAvailabilityByDatesByRoomID(ctx, start, end, typeID)
+	if err != nil || !available {
+		return nil, err
+	}
+	return []models.Room{{ID: typeID, RoomName: "Room", RoomTypeID: typeID}}, nil
+}
+
+//ReassignRoom moves a reservation to another room. Room 3 is always taken and room 4 is of
+//another type
+func (m *testDBRepo) ReassignRoom(ctx context.Context, reservationID, roomID int) error {
+	switch roomID {
+	case 3:
+		return repository.ErrRoomNotFree
+	case 4:
+		return repository.ErrRoomTypeMismatch
+	}
+	return nil
+}
+
+//StayRulesForDates returns the test rule: arrivals in 2045 stay between two and thirty nights and
+//room type 2 takes no arrivals on Sundays then. Dates from 2047 fail the query
+func (m *testDBRepo) StayRulesForDates(ctx context.Context, start, end time.Time) ([]models.StayRule, error) {
+	if start.Year() == 2047 {
+		return nil, errors.New("An error")
+	}
+
+	return []models.StayRule{{
+		StartDate: time.Date(2045, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2045, 12, 31, 0, 0, 0, 0, time.UTC),
+		MinNights: 2,
+		MaxNights: 30,
+	}, {
+		RoomTypeID: 2,
+		StartDate:  time.Date(2045, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:    time.Date(2045, 12, 31, 0, 0, 0, 0, time.UTC),
+		NoArrival:  1 << time.Sunday,
+	}}, nil
+}
+
+//TaxRulesForDates returns the test taxes: from 2046 a tourist tax of 2.00 a person a night on
+//top and 10% VAT included in the rates of room type 1. Dates from 2048 fail the query
+func (m *testDBRepo) TaxRulesForDates(ctx context.Context, start, end time.Time) ([]models.TaxRule, error) {
+	if start.Year() == 2048 {
+		return nil, errors.New("An error")
+	}
+
+	from := time.Date(2046, 1, 1, 0, 0, 0, 0, time.UTC)
+	return []models.TaxRule{{
+		Name:      "Tourist tax",
+		Amount:    200,
+		Per:       pricing.PerPersonNight,
+		StartDate: from,
+	}, {
+		RoomTypeID: 1,
+		Name:       "VAT",
+		Percent:    true,
+		Amount:     1000,
+		Inclusive:  true,
+		StartDate:  from,
+	}}, nil
+}
+
+//HoldRoom holds the room FreeRoomsOfType gives for the type, as hold 1
+func (m *testDBRepo) HoldRoom(ctx context.Context, typeID int, start, end time.Time, ttl time.Duration) (models.RoomRestriction, error) {
+	rooms, err := m.FreeRoomsOfType(ctx, typeID, start, end)
+	if err != nil {
+		return models.RoomRestriction{}, err
+	}
+	if len(rooms) == 0 {
+		return models.RoomRestriction{}, repository.ErrRoomNotFree
+	}
+	return models.RoomRestriction{
+		ID:            1,
+		StartDate:     start,
+		EndDate:       end,
+		RoomID:        rooms[0].ID,
+		RestrictionID: models.RestrictionHold,
+		ExpiresAt:     time.Now().Add(ttl),
+		Room:          rooms[0],
+	}, nil
+}
+
+//ExtendHold extends a hold, hold 2 has always expired
+func (m *testDBRepo) ExtendHold(ctx context.Context, id int, ttl time.Duration) error {
+	if id == 2 {
+		return repository.ErrHoldExpired
+	}
+	return nil
+}
+
+func (m *testDBRepo) ReleaseHold(ctx context.Context, id int) error {
+	return nil
+}
+
+//ClaimHoldPayment claims a hold, hold 4 is already being paid for and hold 6 was left with an
+//intent the provider doesn't know
+func (m *testDBRepo) ClaimHoldPayment(ctx context.Context, id int, ttl time.Duration) (string, error) {
+	switch id {
+	case 4:
+		return "", repository.ErrHoldPaying
+	case 6:
+		return "fake_pi_gone", nil
+	}
+	return "", nil
+}
+
+func (m *testDBRepo) SetHoldPaymentIntent(ctx context.Context, id int, intentID string) error {
+	return nil
+}
+
+func (m *testDBRepo) UnclaimHoldPayment(ctx context.Context, id int, intentID string) error {
+	return nil
+}
+
+//GetReservationByHold finds reservation 1 for hold 8, the other holds haven't been booked
+func (m *testDBRepo) GetReservationByHold(ctx context.Context, holdID int) (models.Reservation, error) {
+	if holdID != 8 {
+		return models.Reservation{}, sql.ErrNoRows
+	}
+	return models.Reservation{ID: 1, AccessToken: strings.Repeat("a", 32)}, nil
+}
+
+func (m *testDBRepo) DeleteExpiredHolds(ctx context.Context) (int64, []string, error) {
+	return 0, nil, nil
+}
+
+//InsertPayment records a payment, reservation 3 fails to
+func (m *testDBRepo) InsertPayment(ctx context.Context, p models.Payment) (int, error) {
+	if p.ReservationID == 3 {
+		return 0, errors.New("An error occurred")
+	}
+	return 1, nil
+}
+
+//UpdatePaymentStatus updates a payment, the reference unknown has no record
+func (m *testDBRepo) UpdatePaymentStatus(ctx context.Context, provider, reference, status string) error {
+	if reference == "unknown" {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+//PaymentsForReservation returns a deposit of 3000 cents with a 1000 refund
+func (m *testDBRepo) PaymentsForReservation(ctx context.Context, reservationID int) ([]models.Payment, error) {
+	return []models.Payment{
+		{ID: 1, ReservationID: reservationID, Provider: "fake", Reference: "fake_pi_1", Kind: "charge", Amount: 3000, Currency: "usd", Status: "succeeded"},
+		{ID: 2, ReservationID: reservationID, Provider: "fake", Reference: "fake_re_2", Kind: "refund", Charge: "fake_pi_1", Amount: 1000, Currency: "usd", Status: "succeeded"},
+	}, nil
+}
+
+//GetCancellationPolicyByID returns the standard policy, 14 free days then a 50% penalty
+func (m *testDBRepo) GetCancellationPolicyByID(ctx context.Context, id int) (models.CancellationPolicy, error) {
+	if id > 2 {
+		return models.CancellationPolicy{}, errors.New("An error")
+	}
+	return models.CancellationPolicy{ID: id, Name: "Standard", FreeDays: 14, PenaltyPercent: 50}, nil
+}
+
+//CancelReservation fails for reservation 3 and finds reservation 2 cancelled by someone else
+func (m *testDBRepo) CancelReservation(ctx context.Context, c models.Cancellation) error {
+	switch c.ReservationID {
+	case 2:
+		return repository.ErrAlreadyCancelled
+	case 3:
+		return errors.New("An error")
+	}
+	return nil
+}
+
+//GetCancellationByReservationID returns a cancellation by the owner with 2000 cents refunded
+func (m *testDBRepo) GetCancellationByReservationID(ctx context.Context, reservationID int) (models.Cancellation, error) {
+	return models.Cancellation{ID: 1, ReservationID: reservationID, Reason: "Change of plans", Actor: "owner", UserID: 1, Refund: 2000}, nil
+}
+
+//IssueInvoice issues inv as invoice 42, failing for reservation 3
+func (m *testDBRepo) IssueInvoice(ctx context.Context, inv models.Invoice) (models.Invoice, error) {
+	if inv.ReservationID == 3 {
+		return models.Invoice{}, errors.New("An error")
+	}
+	inv.ID, inv.Number, inv.CreatedAt = 1, 42, time.Date(2039, 12, 1, 0, 0, 0, 0, time.UTC)
+	return inv, nil
+}
+
+//GetInvoiceByReservationID returns invoice 42, billing the stay at 20000 with 2000 paid, for
+//reservations 1, 4 and 7. Reading it fails for reservation 10 and the others have none
+func (m *testDBRepo) GetInvoiceByReservationID(ctx context.Context, reservationID int) (models.Invoice, error) {
+	switch reservationID {
+	case 1, 4, 7:
+	case 10:
+		return models.Invoice{}, errors.New("An error")
+	default:
+		return models.Invoice{}, sql.ErrNoRows
+	}
+	return models.Invoice{
+		ID:            1,
+		Number:        42,
+		ReservationID: reservationID,
+		Quote: pricing.Quote{
+			Lines: []pricing.Line{{Key: "quote.room", Quantity: 2, Unit: 10000, Amount: 20000}},
+			Total: 20000,
+		},
+		Paid:      2000,
+		CreatedAt: time.Date(2039, 12, 1, 0, 0, 0, 0, time.UTC),
+	}, nil
 }
 
 //GetRoomByID gets a room by ID
-func (m *testDBRepo) GetRoomByID(id int) (models.Room, error) {
+func (m *testDBRepo) GetRoomByID(ctx context.Context, id int) (models.Room, error) {
 	var room models.Room
 	if id > 2 {
 		return room, errors.New("An error")
@@ -79,18 +305,33 @@ func (m *testDBRepo) GetRoomByID(id int) (models.Room, error) {
 
 }
 
-func (m *testDBRepo) GetUserByID(id int) (models.User, error) {
+//GetRoomTypeByID gets a room type by ID
+func (m *testDBRepo) GetRoomTypeByID(ctx context.Context, id int) (models.RoomType, error) {
+	var rt models.RoomType
+	if id > 2 {
+		return rt, errors.New("An error")
+	}
+
+	//every type sleeps two, at 100.00 a night
+	rt.ID = id
+	rt.MaxOccupancy = 2
+	rt.IncludedGuests = 2
+	rt.NightlyRate = 10000
+	return rt, nil
+}
+
+func (m *testDBRepo) GetUserByID(ctx context.Context, id int) (models.User, error) {
 	var u models.User
 
 	return u, nil
 }
 
-func (m *testDBRepo) UpdateUser(models.User) error {
+func (m *testDBRepo) UpdateUser(ctx context.Context, u models.User) error {
 
 	return nil
 }
 
-func (m *testDBRepo) Authenticate(email, testPassword string) (int, string, error) {
+func (m *testDBRepo) Authenticate(ctx context.Context, email, testPassword string) (int, string, error) {
 	if email == "me@me.com" {
 		return 1, "", nil
 	}
@@ -98,7 +339,7 @@ func (m *testDBRepo) Authenticate(email, testPassword string) (int, string, erro
 }
 
 //AllReservations returns a slice of all reservations
-func (m *testDBRepo) AllReservations() ([]models.Reservation, error) {
+func (m *testDBRepo) AllReservations(ctx context.Context) ([]models.Reservation, error) {
 
 	var reservations []models.Reservation
 
@@ -107,7 +348,7 @@ func (m *testDBRepo) AllReservations() ([]models.Reservation, error) {
 }
 
 //AllReservations returns a slice of all reservations
-func (m *testDBRepo) AllNewReservations() ([]models.Reservation, error) {
+func (m *testDBRepo) AllNewReservations(ctx context.Context) ([]models.Reservation, error) {
 
 	var reservations []models.Reservation
 
@@ -115,46 +356,104 @@ func (m *testDBRepo) AllNewReservations() ([]models.Reservation, error) {
 
 }
 
-//GetReservationByID gets on reservation by ID
-func (m *testDBRepo) GetReservationByID(id int) (models.Reservation, error) {
+//GetReservationByID gets on reservation by ID. Reservation 7 has been cancelled, reservation 8
+//fails and reservation 9 has a phone saved before phones were checked
+func (m *testDBRepo) GetReservationByID(ctx context.Context, id int) (models.Reservation, error) {
+
+	res := models.Reservation{ID: id}
+	switch id {
+	case 7:
+		res.CancelledAt = time.Date(2039, 12, 1, 0, 0, 0, 0, time.UTC)
+	case 8:
+		return res, errors.New("An error")
+	case 9:
+		res.Phone = "555-555-5555"
+	}
+
+	return res, nil
+}
 
-	var res models.Reservation
+//GetReservationByToken finds a two night stay in 2040, quoted at the room rate alone, for any
+//token but "unknown", which opens nothing, and "fails". It is reservation 1, or reservation 2,
+//which hasn't been invoiced, for the token "uninvoiced". The token "cancelled" finds it
+//cancelled and "arrived" finds a stay that started in 2020
+func (m *testDBRepo) GetReservationByToken(ctx context.Context, token string) (models.Reservation, error) {
+	res := models.Reservation{
+		ID:          1,
+		FirstName:   "Ali",
+		LastName:    "Jamal",
+		Email:       "aJamal@abc.com",
+		StartDate:   time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:     time.Date(2040, 1, 3, 0, 0, 0, 0, time.UTC),
+		RoomID:      1,
+		Room:        models.Room{ID: 1, RoomName: "General's Quarters 1", RoomTypeID: 1},
+		RoomTypeID:  1,
+		RoomType:    models.RoomType{ID: 1, Name: "General's Quarters", CancellationPolicyID: 1},
+		Adults:      1,
+		Total:       20000,
+		Deposit:     6000,
+		AccessToken: token,
+		Quote: pricing.Quote{
+			Lines: []pricing.Line{{Key: "quote.room", Quantity: 2, Unit: 10000, Amount: 20000}},
+			Total: 20000,
+		},
+	}
 
+	switch token {
+	case "unknown":
+		return models.Reservation{}, sql.ErrNoRows
+	case "fails":
+		return models.Reservation{}, errors.New("An error")
+	case "uninvoiced":
+		res.ID = 2
+	case "cancelled":
+		res.CancelledAt = time.Date(2039, 12, 1, 0, 0, 0, 0, time.UTC)
+	case "arrived":
+		res.StartDate = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		res.EndDate = time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC)
+	}
 	return res, nil
 }
 
-func (m *testDBRepo) UpdateReservation(u models.Reservation) error {
+func (m *testDBRepo) UpdateReservation(ctx context.Context, u models.Reservation) error {
 	return nil
 }
 
-//DeleteReservation deletes one reservation from the DB
-func (m *testDBRepo) DeleteReservation(id int) error {
+//DeleteReservation deletes one reservation from the DB, reservation 5 has been paid and
+//deleting 6 fails
+func (m *testDBRepo) DeleteReservation(ctx context.Context, id int) error {
+	switch id {
+	case 5:
+		return repository.ErrReservationBilled
+	case 6:
+		return errors.New("An error")
+	}
 	return nil
 }
 
-func (m *testDBRepo) UpdateProcessedForReservation(id, processed int) error {
+func (m *testDBRepo) UpdateProcessedForReservation(ctx context.Context, id, processed int) error {
 	return nil
 }
 
-func (m *testDBRepo) AllRooms() ([]models.Room, error) {
+func (m *testDBRepo) AllRooms(ctx context.Context) ([]models.Room, error) {
 	var rooms []models.Room
 	return rooms, nil
 }
 
 //GetRestrictionsForRoomByDate returns the room restrictions for each day
-func (m *testDBRepo) GetRestrictionsForRoomByDate(roomId int, start, end time.Time) ([]models.RoomRestriction, error) {
+func (m *testDBRepo) GetRestrictionsForRoomByDate(ctx context.Context, roomId int, start, end time.Time) ([]models.RoomRestriction, error) {
 
 	var restrictions []models.RoomRestriction
 
 	return restrictions, nil
 }
 
-func (m *testDBRepo) DeleteBlockByID(id int) error {
+func (m *testDBRepo) DeleteBlockByID(ctx context.Context, id int) error {
 
 	return nil
 }
 
-func (m *testDBRepo) InsertBlockForRoom(id int, startDate time.Time) error {
+func (m *testDBRepo) InsertBlockForRoom(ctx context.Context, id int, startDate time.Time) error {
 
 	return nil
 }
@@ -1,37 +1,87 @@
 package repository
 
 import (
+	"context"
+	"errors"
 	"time"
 
 	"github.com/darinmilner/goserver/internal/models"
 )
 
+//ErrRoomNotFree is returned by ReassignRoom when the target room is booked or blocked for
+//some of the reservation's nights
+var ErrRoomNotFree = errors.New("room is not free for those dates")
+
+//ErrRoomTypeMismatch is returned by ReassignRoom when the target room is of another type than
+//the one the guest booked
+var ErrRoomTypeMismatch = errors.New("room is of another type")
+
+//ErrHoldExpired is returned by ExtendHold when the hold has run out or was released
+var ErrHoldExpired = errors.New("hold has expired")
+
+//ErrHoldPaying is returned by ClaimHoldPayment when another checkout is taking the hold's payment
+var ErrHoldPaying = errors.New("hold is already being paid for")
+
+//ErrReservationBilled is returned by DeleteReservation when the reservation has payments or an
+//invoice, which are kept, so it is cancelled instead
+var ErrReservationBilled = errors.New("reservation has payments or an invoice")
+
+//ErrAlreadyCancelled is returned by CancelReservation when the reservation was cancelled before
+var ErrAlreadyCancelled = errors.New("reservation is already cancelled")
+
 type DatabaseRepo interface {
-	AllUsers() bool
+	AllUsers(ctx context.Context) bool
+
+	InsertReservation(ctx context.Context, res models.Reservation) (int, error)
+	BookReservation(ctx context.Context, res models.Reservation, holdID int) (int, error)
+	InsertRoomRestriction(ctx context.Context, r models.RoomRestriction) error
+	SearchAvailabilityByDatesByRoomID(ctx context.Context, start, end time.Time, roomID int) (bool, error)
+	SearchAvailabilityForAllRooms(ctx context.Context, start, end time.Time, guests int) ([]models.RoomTypeAvailability, error)
+	FreeRoomsOfType(ctx context.Context, typeID int, start, end time.Time) ([]models.Room, error)
+	ReassignRoom(ctx context.Context, reservationID, roomID int) error
+	StayRulesForDates(ctx context.Context, start, end time.Time) ([]models.StayRule, error)
+	TaxRulesForDates(ctx context.Context, start, end time.Time) ([]models.TaxRule, error)
+
+	HoldRoom(ctx context.Context, typeID int, start, end time.Time, ttl time.Duration) (models.RoomRestriction, error)
+	ExtendHold(ctx context.Context, id int, ttl time.Duration) error
+	ReleaseHold(ctx context.Context, id int) error
+	ClaimHoldPayment(ctx context.Context, id int, ttl time.Duration) (string, error)
+	SetHoldPaymentIntent(ctx context.Context, id int, intentID string) error
+	UnclaimHoldPayment(ctx context.Context, id int, intentID string) error
+	GetReservationByHold(ctx context.Context, holdID int) (models.Reservation, error)
+	DeleteExpiredHolds(ctx context.Context) (int64, []string, error)
+
+	InsertPayment(ctx context.Context, p models.Payment) (int, error)
+	UpdatePaymentStatus(ctx context.Context, provider, reference, status string) error
+	PaymentsForReservation(ctx context.Context, reservationID int) ([]models.Payment, error)
+
+	GetCancellationPolicyByID(ctx context.Context, id int) (models.CancellationPolicy, error)
+	CancelReservation(ctx context.Context, c models.Cancellation) error
+	GetCancellationByReservationID(ctx context.Context, reservationID int) (models.Cancellation, error)
 
-	InsertReservation(res models.Reservation) (int, error)
-	InsertRoomRestriction(r models.RoomRestriction) error
-	SearchAvailabilityByDatesByRoomID(start, end time.Time, roomID int) (bool, error)
-	SearchAvailabilityForAllRooms(start, end time.Time) ([]models.Room, error)
+	IssueInvoice(ctx context.Context, inv models.Invoice) (models.Invoice, error)
+	GetInvoiceByReservationID(ctx context.Context, reservationID int) (models.Invoice, error)
 
-	GetRoomByID(id int) (models.Room, error)
-	GetUserByID(id int) (models.User, error)
+	GetRoomByID(ctx context.Context, id int) (models.Room, error)
+	GetRoomTypeByID(ctx context.Context, id int) (models.RoomType, error)
+	GetUserByID(ctx context.Context, id int) (models.User, error)
 
-	UpdateUser(m models.User) error
+	UpdateUser(ctx context.Context, m models.User) error
 
-	Authenticate(email, testPassword string) (int, string, error)
-	AllReservations() ([]models.Reservation, error)
-	AllNewReservations() ([]models.Reservation, error)
-	GetReservationByID(id int) (models.Reservation, error)
-	DeleteReservation(id int) error
+	Authenticate(ctx context.Context, email, testPassword string) (int, string, error)
+	AllReservations(ctx context.Context) ([]models.Reservation, error)
+	AllNewReservations(ctx context.Context) ([]models.Reservation, error)
+	GetReservationByID(ctx context.Context, id int) (models.Reservation, error)
+	GetReservationByToken(ctx context.Context, token string) (models.Reservation, error)
+	DeleteReservation(ctx context.Context, id int) error
 
-	UpdateReservation(u models.Reservation) error
-	UpdateProcessedForReservation(id, processed int) error
+	UpdateReservation(ctx context.Context, u models.Reservation) error
+	UpdateProcessedForReservation(ctx context.Context, id, processed int) error
 
-	DeleteBlockByID(id int) error
+	DeleteBlockByID(ctx context.Context, id int) error
 
-	InsertBlockForRoom(id int, startDate time.Time) error
+	InsertBlockForRoom(ctx context.Context, id int, startDate time.Time) error
 
-	AllRooms() ([]models.Room, error)
-	GetRestrictionsForRoomByDate(roomID int, start, end time.Time) ([]models.RoomRestriction, error)
+	AllRooms(ctx context.Context) ([]models.Room, error)
+	GetRestrictionsForRoomByDate(ctx context.Context, roomID int, start, end time.Time) ([]models.RoomRestriction, error)
 }
@@ -0,0 +1,116 @@
+package security
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+type contextKey int
+
+const nonceKey contextKey = iota
+
+//Policy is a Content Security Policy, directive name to sources. The nonce placeholder
+//is replaced with the request's nonce when the header is written
+type Policy map[string][]string
+
+//NonceSource stands for 'nonce-<request nonce>' in a Policy
+const NonceSource = "'nonce'"
+
+//With returns a copy of p with directive set to sources, replacing what p had for it
+func (p Policy) With(directive string, sources ...string) Policy {
+	c := make(Policy, len(p)+1)
+	for k, v := range p {
+		c[k] = v
+	}
+	c[directive] = sources
+	return c
+}
+
+//Header returns the policy as a header value using nonce. default-src comes first,
+//then the other directives in name order so the header is stable
+func (p Policy) Header(nonce string) string {
+	names := make([]string, 0, len(p))
+	for name := range p {
+		if name != "default-src" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if _, ok := p["default-src"]; ok {
+		names = append([]string{"default-src"}, names...)
+	}
+
+	var parts []string
+	for _, name := range names {
+		d := name
+		for _, src := range p[name] {
+			if src == NonceSource {
+				src = "'nonce-" + nonce + "'"
+			}
+			d += " " + src
+		}
+		parts = append(parts, d)
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+//Headers returns middleware setting the security headers on every response. Each request gets
+//a fresh nonce for p, available to templates through Nonce. HSTS is only sent when hsts is set,
+//as it pins the host to HTTPS
+func Headers(p Policy, hsts bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			nonce := newNonce()
+
+			h := w.Header()
+			h.Set("Content-Security-Policy", p.Header(nonce))
+			h.Set("X-Frame-Options", "DENY")
+			h.Set("X-Content-Type-Options", "nosniff")
+			h.Set("Referrer-Policy", "strict-origin-when-cross-origin")
+			h.Set("Permissions-Policy", "camera=(), microphone=(), geolocation=(), payment=()")
+			h.Set("Cross-Origin-Opener-Policy", "same-origin")
+			if hsts {
+				h.Set("Strict-Transport-Security", "max-age=63072000; includeSubDomains")
+			}
+
+			ctx := context.WithValue(r.Context(), nonceKey, nonce)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+//Override returns middleware replacing the Content Security Policy for a group of routes.
+//It must run after Headers, the request keeps the nonce Headers gave it
+func Override(p Policy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Security-Policy", p.Header(Nonce(r.Context())))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+//Nonce returns the CSP nonce of the request, or an empty string outside Headers
+func Nonce(ctx context.Context) string {
+	n, _ := ctx.Value(nonceKey).(string)
+	return n
+}
+
+func newNonce() string {
+	b := make([]byte, 16)
+	//crypto/rand.Read never returns an error on supported platforms
+	_, _ = rand.Read(b)
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+//NewToken returns a random URL safe secret, for links that only whoever was sent them can open
+func NewToken() string {
+	b := make([]byte, 24)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,82 @@
+package security
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPolicyHeader(t *testing.T) {
+	p := Policy{
+		"script-src":  {"'self'", NonceSource},
+		"default-src": {"'self'"},
+		"img-src":     {"'self'", "data:"},
+	}
+
+	got := p.Header("abc")
+	want := "default-src 'self'; img-src 'self' data:; script-src 'self' 'nonce-abc'"
+	if got != want {
+		t.Errorf("expected %q but got %q", want, got)
+	}
+
+	o := p.With("script-src", "'none'")
+	if !strings.Contains(o.Header("abc"), "script-src 'none'") {
+		t.Errorf("With did not replace script-src: %s", o.Header("abc"))
+	}
+	if p["script-src"][0] != "'self'" {
+		t.Error("With changed the original policy")
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	p := Policy{"script-src": {NonceSource}}
+
+	var nonce string
+	h := Headers(p, true)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce = Nonce(r.Context())
+	}))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+	if nonce == "" {
+		t.Fatal("no nonce in the request context")
+	}
+	if csp := rr.Header().Get("Content-Security-Policy"); csp != "script-src 'nonce-"+nonce+"'" {
+		t.Errorf("CSP does not use the request nonce: %s", csp)
+	}
+	for _, name := range []string{"X-Frame-Options", "X-Content-Type-Options", "Referrer-Policy", "Strict-Transport-Security"} {
+		if rr.Header().Get(name) == "" {
+			t.Errorf("%s not set", name)
+		}
+	}
+
+	first := nonce
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if nonce == first {
+		t.Error("nonce was reused between requests")
+	}
+
+	rr = httptest.NewRecorder()
+	Headers(p, false)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Header().Get("Strict-Transport-Security") != "" {
+		t.Error("HSTS sent when disabled")
+	}
+}
+
+func TestOverride(t *testing.T) {
+	admin := Policy{"script-src": {"'self'", NonceSource}}
+
+	var nonce string
+	h := Headers(Policy{"script-src": {"'none'"}}, false)(Override(admin)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce = Nonce(r.Context())
+	})))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/admin/dashboard", nil))
+
+	if csp := rr.Header().Get("Content-Security-Policy"); csp != "script-src 'self' 'nonce-"+nonce+"'" {
+		t.Errorf("expected the override policy with the request nonce but got %s", csp)
+	}
+}
@@ -0,0 +1,78 @@
+//Package stayrules decides whether a stay can be booked under the owner's stay rules, such as
+//a minimum number of nights at weekends or no arrivals on Sundays
+package stayrules
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/darinmilner/goserver/internal/dates"
+	"github.com/darinmilner/goserver/internal/models"
+)
+
+//Violation is the first rule a stay breaks. Key is the catalog key explaining it, in the
+//stay_rule section, and Args its arguments: dates as time.Time, weekdays as time.Weekday
+type Violation struct {
+	Key  string
+	Args []interface{}
+}
+
+func (v *Violation) Error() string {
+	return fmt.Sprint(v.Key, v.Args)
+}
+
+//Check returns the first of rules that a stay of roomTypeID from start to end, booked today,
+//breaks, or nil when it breaks none. Every rule whose dates hold the arrival day applies,
+//except the departure weekdays, which come from the rules whose dates hold the departure day.
+//Rules of other room types are skipped so all of a search's rules can be passed in
+func Check(rules []models.StayRule, roomTypeID int, start, end, today time.Time) *Violation {
+	start, end, today = dates.Day(start), dates.Day(end), dates.Day(today)
+	nights := dates.Between(start, end)
+	lead := dates.Between(today, start)
+
+	for _, r := range rules {
+		if r.RoomTypeID != 0 && r.RoomTypeID != roomTypeID {
+			continue
+		}
+
+		if covers(r, end) && closed(r.NoDeparture, end.Weekday()) {
+			return &Violation{Key: "stay_rule.no_departure", Args: []interface{}{end.Weekday()}}
+		}
+
+		if !covers(r, start) {
+			continue
+		}
+
+		switch {
+		case closed(r.NoArrival, start.Weekday()):
+			return &Violation{Key: "stay_rule.no_arrival", Args: []interface{}{start.Weekday()}}
+		case r.MinNights > 0 && nights < r.MinNights:
+			return &Violation{Key: "stay_rule.min_nights", Args: []interface{}{start, r.MinNights}}
+		case r.MaxNights > 0 && nights > r.MaxNights:
+			return &Violation{Key: "stay_rule.max_nights", Args: []interface{}{start, r.MaxNights}}
+		case r.MinLeadDays > 0 && lead < r.MinLeadDays:
+			return &Violation{Key: "stay_rule.min_lead", Args: []interface{}{r.MinLeadDays}}
+		case r.MaxAdvanceDays > 0 && lead > r.MaxAdvanceDays:
+			return &Violation{Key: "stay_rule.max_advance", Args: []interface{}{r.MaxAdvanceDays}}
+		}
+	}
+	return nil
+}
+
+//Weekdays returns the bits of days, for the NoArrival and NoDeparture fields
+func Weekdays(days ...time.Weekday) int {
+	bits := 0
+	for _, d := range days {
+		bits |= 1 << d
+	}
+	return bits
+}
+
+func closed(bits int, d time.Weekday) bool {
+	return bits&(1<<d) != 0
+}
+
+//covers reports whether d falls within the rule's dates, both ends included
+func covers(r models.StayRule, d time.Time) bool {
+	return !d.Before(dates.Day(r.StartDate)) && !d.After(dates.Day(r.EndDate))
+}
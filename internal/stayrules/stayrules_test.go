@@ -0,0 +1,67 @@
+package stayrules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/darinmilner/goserver/internal/models"
+)
+
+func date(s string) time.Time {
+	t, _ := time.Parse("2006-01-02", s)
+	return t
+}
+
+var rules = []models.StayRule{
+	//weekends in January 2045 need two nights and can't start on a Sunday
+	{RoomTypeID: 0, StartDate: date("2045-01-06"), EndDate: date("2045-01-08"), MinNights: 2, NoArrival: Weekdays(time.Sunday)},
+	//room type 2 takes stays of up to a week, booked 3 to 100 days ahead, leaving any day but Monday
+	{RoomTypeID: 2, StartDate: date("2045-01-01"), EndDate: date("2045-01-31"), MaxNights: 7, MinLeadDays: 3, MaxAdvanceDays: 100, NoDeparture: Weekdays(time.Monday)},
+}
+
+func TestCheck(t *testing.T) {
+	today := date("2044-12-01")
+
+	tests := []struct {
+		name     string
+		roomType int
+		start    string
+		end      string
+		today    time.Time
+		key      string
+	}{
+		{"no rule", 1, "2045-02-01", "2045-02-02", today, ""},
+		{"long enough weekend", 1, "2045-01-06", "2045-01-08", today, ""},
+		{"one night weekend", 1, "2045-01-07", "2045-01-08", today, "stay_rule.min_nights"},
+		{"sunday arrival", 1, "2045-01-08", "2045-01-10", today, "stay_rule.no_arrival"},
+		{"other room type", 1, "2045-01-10", "2045-01-30", today, ""},
+		{"too long", 2, "2045-01-10", "2045-01-20", today, "stay_rule.max_nights"},
+		{"monday departure", 2, "2045-01-10", "2045-01-16", today, "stay_rule.no_departure"},
+		{"too late to book", 2, "2045-01-10", "2045-01-12", date("2045-01-09"), "stay_rule.min_lead"},
+		{"too early to book", 2, "2045-01-10", "2045-01-12", date("2044-06-01"), "stay_rule.max_advance"},
+		{"lead counted in days", 2, "2045-01-10", "2045-01-12", time.Date(2045, 1, 7, 23, 59, 0, 0, time.UTC), ""},
+	}
+
+	for _, tt := range tests {
+		v := Check(rules, tt.roomType, date(tt.start), date(tt.end), tt.today)
+		got := ""
+		if v != nil {
+			got = v.Key
+		}
+		if got != tt.key {
+			t.Errorf("%s: expected %q but got %q", tt.name, tt.key, got)
+		}
+	}
+}
+
+func TestViolationArgs(t *testing.T) {
+	v := Check(rules, 1, date("2045-01-08"), date("2045-01-10"), date("2044-12-01"))
+	if v == nil || len(v.Args) != 1 || v.Args[0] != time.Sunday {
+		t.Errorf("expected Sunday as the argument, got %v", v)
+	}
+
+	v = Check(rules, 1, date("2045-01-07"), date("2045-01-08"), date("2044-12-01"))
+	if v == nil || !v.Args[0].(time.Time).Equal(date("2045-01-07")) || v.Args[1] != 2 {
+		t.Errorf("expected the arrival date and 2 nights, got %v", v)
+	}
+}
@@ -0,0 +1,65 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/darinmilner/goserver/internal/config"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSetup(t *testing.T) {
+	defer otel.SetTracerProvider(otel.GetTracerProvider())
+
+	tests := []struct {
+		exporter string
+		wantErr  bool
+	}{
+		{"none", false},
+		{"stdout", false},
+		{"zipkin", true},
+	}
+
+	for _, e := range tests {
+		flush, err := Setup(context.Background(), config.TracingConfig{Exporter: e.exporter, SampleRatio: 1}, "test")
+		if e.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error", e.exporter)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", e.exporter, err)
+			continue
+		}
+		if err := flush(context.Background()); err != nil {
+			t.Errorf("%s: flush failed %v", e.exporter, err)
+		}
+	}
+}
+
+func TestNewProviderSampling(t *testing.T) {
+	exp := tracetest.NewInMemoryExporter()
+
+	tp := NewProvider(sdktrace.NewSimpleSpanProcessor(exp), 0, "test")
+	_, span := tp.Tracer(Name).Start(context.Background(), "dropped")
+	span.End()
+
+	if got := len(exp.GetSpans()); got != 0 {
+		t.Errorf("expected a sample ratio of 0 to drop the span but %d were recorded", got)
+	}
+
+	tp = NewProvider(sdktrace.NewSimpleSpanProcessor(exp), 1, "test")
+	_, span = tp.Tracer(Name).Start(context.Background(), "kept")
+	span.End()
+
+	spans := exp.GetSpans()
+	if len(spans) != 1 || spans[0].Name != "kept" {
+		t.Fatalf("expected the kept span but got %v", spans)
+	}
+	if v, ok := spans[0].Resource.Set().Value("service.name"); !ok || v.AsString() != ServiceName {
+		t.Errorf("expected service.name %s but got %v", ServiceName, v)
+	}
+}
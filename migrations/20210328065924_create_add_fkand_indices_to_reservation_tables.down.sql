@@ -0,0 +1,3 @@
+ALTER TABLE room_restrictions DROP CONSTRAINT IF EXISTS room_restrictions_reservations_id_fk;
+DROP INDEX IF EXISTS reservations_email_idx;
+DROP INDEX IF EXISTS reservations_last_name_idx;
@@ -0,0 +1,3 @@
+-- owner blocks have no reservation, remove them before restoring the constraint
+DELETE FROM room_restrictions WHERE reservation_id IS NULL;
+ALTER TABLE room_restrictions ALTER COLUMN reservation_id SET NOT NULL;
@@ -1,3 +1,3 @@
 INSERT INTO public.rooms (room_name,created_at,updated_at) VALUES
 	 ('General''s Quarters','2021-04-03 00:00:00','2021-04-03 00:00:00'),
-	 ('Major''s Suite','2021-04-05 00:00:00','2021-04-05 00:00:00');
\ No newline at end of file
+	 ('Major''s Suite','2021-04-05 00:00:00','2021-04-05 00:00:00');
@@ -1,3 +1,3 @@
 INSERT INTO public.restrictions (restriction_name,created_at,updated_at) VALUES
 	 ('Reservation','2021-04-03 00:00:00','2021-04-03 00:00:00'),
-	 ('OwnerBlock','2021-04-04 00:00:00','2021-04-03 00:00:00');
\ No newline at end of file
+	 ('OwnerBlock','2021-04-04 00:00:00','2021-04-03 00:00:00');
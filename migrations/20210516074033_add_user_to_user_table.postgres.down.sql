@@ -1 +0,0 @@
-delete from users where email = "admin@admin.com"
\ No newline at end of file
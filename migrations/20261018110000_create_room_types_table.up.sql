@@ -0,0 +1,18 @@
+CREATE TABLE room_types (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+-- every existing room becomes a type of its own, with the same id so links keep working
+INSERT INTO room_types (id, name, created_at, updated_at)
+    SELECT id, room_name, created_at, updated_at FROM rooms;
+SELECT setval(pg_get_serial_sequence('room_types', 'id'), coalesce(max(id), 0) + 1, false) FROM room_types;
+
+ALTER TABLE rooms ADD COLUMN room_type_id INTEGER;
+UPDATE rooms SET room_type_id = id;
+ALTER TABLE rooms ALTER COLUMN room_type_id SET NOT NULL;
+ALTER TABLE rooms ADD CONSTRAINT rooms_room_types_id_fk
+    FOREIGN KEY (room_type_id) REFERENCES room_types (id) ON UPDATE CASCADE ON DELETE RESTRICT;
+CREATE INDEX rooms_room_type_id_idx ON rooms (room_type_id);
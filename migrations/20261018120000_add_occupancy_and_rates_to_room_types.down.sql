@@ -0,0 +1,8 @@
+ALTER TABLE reservations DROP COLUMN IF EXISTS adults, DROP COLUMN IF EXISTS children, DROP COLUMN IF EXISTS total;
+
+ALTER TABLE room_types
+    DROP COLUMN IF EXISTS max_occupancy,
+    DROP COLUMN IF EXISTS included_guests,
+    DROP COLUMN IF EXISTS nightly_rate,
+    DROP COLUMN IF EXISTS extra_adult_rate,
+    DROP COLUMN IF EXISTS extra_child_rate;
@@ -0,0 +1,16 @@
+-- rates are in cents
+ALTER TABLE room_types
+    ADD COLUMN max_occupancy INTEGER NOT NULL DEFAULT 2,
+    ADD COLUMN included_guests INTEGER NOT NULL DEFAULT 2,
+    ADD COLUMN nightly_rate BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN extra_adult_rate BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN extra_child_rate BIGINT NOT NULL DEFAULT 0;
+
+UPDATE room_types SET nightly_rate = 12000 WHERE name = 'General''s Quarters';
+UPDATE room_types SET max_occupancy = 4, nightly_rate = 18000, extra_adult_rate = 3000, extra_child_rate = 1500
+    WHERE name = 'Major''s Suite';
+
+ALTER TABLE reservations
+    ADD COLUMN adults INTEGER NOT NULL DEFAULT 1,
+    ADD COLUMN children INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN total BIGINT NOT NULL DEFAULT 0;
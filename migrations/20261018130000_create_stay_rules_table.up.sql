@@ -0,0 +1,19 @@
+-- no_arrival_days and no_departure_days are weekdays as bits, 1 is Sunday, 2 Monday up to 64
+-- for Saturday. A null room_type_id applies to every type, and zero limits don't apply
+CREATE TABLE stay_rules (
+    id SERIAL PRIMARY KEY,
+    room_type_id INTEGER REFERENCES room_types (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    start_date DATE NOT NULL,
+    end_date DATE NOT NULL,
+    min_nights INTEGER NOT NULL DEFAULT 0,
+    max_nights INTEGER NOT NULL DEFAULT 0,
+    no_arrival_days SMALLINT NOT NULL DEFAULT 0,
+    no_departure_days SMALLINT NOT NULL DEFAULT 0,
+    min_lead_days INTEGER NOT NULL DEFAULT 0,
+    max_advance_days INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    CHECK (end_date >= start_date)
+);
+
+CREATE INDEX stay_rules_dates_idx ON stay_rules (start_date, end_date);
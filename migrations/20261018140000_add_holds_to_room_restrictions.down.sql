@@ -0,0 +1,4 @@
+-- holds are found by name, so a restriction that took id 3 some other way is left alone
+DELETE FROM room_restrictions WHERE restriction_id IN (SELECT id FROM restrictions WHERE restriction_name = 'Hold');
+ALTER TABLE room_restrictions DROP COLUMN IF EXISTS expires_at;
+DELETE FROM restrictions WHERE restriction_name = 'Hold';
@@ -0,0 +1,8 @@
+-- a hold keeps a room for a guest while they fill in the reservation form, it stops counting
+-- once expires_at has passed and the sweeper deletes it
+INSERT INTO restrictions (id, restriction_name, created_at, updated_at) VALUES (3, 'Hold', now(), now());
+SELECT setval(pg_get_serial_sequence('restrictions', 'id'), coalesce(max(id), 0) + 1, false) FROM restrictions;
+
+ALTER TABLE room_restrictions ADD COLUMN expires_at TIMESTAMP;
+
+CREATE INDEX room_restrictions_expires_at_idx ON room_restrictions (expires_at) WHERE expires_at IS NOT NULL;
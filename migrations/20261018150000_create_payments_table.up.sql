@@ -0,0 +1,21 @@
+-- amounts are cents, a refund is a row of its own with kind 'refund'. reference is the
+-- provider's id of the charge or refund, webhooks find the row by it
+CREATE TABLE payments (
+    id SERIAL PRIMARY KEY,
+    reservation_id INTEGER NOT NULL REFERENCES reservations (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL,
+    reference VARCHAR(255) NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    amount BIGINT NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    UNIQUE (provider, reference),
+    CHECK (amount >= 0),
+    CHECK (kind IN ('charge', 'refund'))
+);
+
+CREATE INDEX payments_reservation_id_idx ON payments (reservation_id);
+
+ALTER TABLE reservations ADD COLUMN deposit BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+ALTER TABLE reservations DROP COLUMN IF EXISTS cancelled_at;
+DROP TABLE IF EXISTS cancellations;
+ALTER TABLE room_types DROP COLUMN IF EXISTS cancellation_policy_id;
+DROP TABLE IF EXISTS cancellation_policies;
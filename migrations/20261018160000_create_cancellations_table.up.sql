@@ -0,0 +1,37 @@
+-- a policy lets a guest cancel for free until free_days before arrival, after that
+-- penalty_percent of the total is kept. every room type has one, the seeded one to start
+CREATE TABLE cancellation_policies (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    free_days INTEGER NOT NULL DEFAULT 0,
+    penalty_percent INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    CHECK (free_days >= 0),
+    CHECK (penalty_percent BETWEEN 0 AND 100)
+);
+
+INSERT INTO cancellation_policies (id, name, free_days, penalty_percent, created_at, updated_at)
+VALUES (1, 'Standard', 14, 50, now(), now());
+SELECT setval(pg_get_serial_sequence('cancellation_policies', 'id'), coalesce(max(id), 0) + 1, false) FROM cancellation_policies;
+
+ALTER TABLE room_types ADD COLUMN cancellation_policy_id INTEGER NOT NULL DEFAULT 1
+    REFERENCES cancellation_policies (id) ON UPDATE CASCADE ON DELETE RESTRICT;
+
+-- a reservation is cancelled once, penalty and refund are cents worked out under the policy
+-- at the time. actor is who asked for it, 'owner' or 'guest', and user_id the admin who did it
+CREATE TABLE cancellations (
+    id SERIAL PRIMARY KEY,
+    reservation_id INTEGER NOT NULL UNIQUE REFERENCES reservations (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    reason TEXT NOT NULL,
+    actor VARCHAR(20) NOT NULL,
+    user_id INTEGER REFERENCES users (id) ON UPDATE CASCADE ON DELETE SET NULL,
+    penalty BIGINT NOT NULL,
+    refund BIGINT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    CHECK (actor IN ('owner', 'guest')),
+    CHECK (penalty >= 0 AND refund >= 0)
+);
+
+ALTER TABLE reservations ADD COLUMN cancelled_at TIMESTAMP;
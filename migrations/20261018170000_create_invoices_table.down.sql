@@ -0,0 +1,2 @@
+ALTER TABLE reservations DROP COLUMN IF EXISTS access_token;
+DROP TABLE IF EXISTS invoices;
@@ -0,0 +1,13 @@
+-- number is the invoice's place in one sequence shared by every reservation, with no gaps.
+-- a reservation has one invoice, issued the first time it is asked for, and can't be deleted
+-- once it has
+CREATE TABLE invoices (
+    id SERIAL PRIMARY KEY,
+    number INTEGER NOT NULL UNIQUE,
+    reservation_id INTEGER NOT NULL UNIQUE REFERENCES reservations (id) ON UPDATE CASCADE ON DELETE RESTRICT,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+-- access_token is the secret in the link to the guest's own reservation page
+ALTER TABLE reservations ADD COLUMN access_token VARCHAR(64) UNIQUE;
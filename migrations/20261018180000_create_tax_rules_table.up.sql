@@ -0,0 +1,21 @@
+-- a tax or fee charged on stays. amount is cents when kind is 'fixed', charged per 'stay',
+-- 'night', 'person' or 'person_night', and hundredths of a percent of the stay when it is
+-- 'percent'. an inclusive one is part of the nightly rates rather than added to them. a null
+-- room_type_id applies to every type and null dates leave the rule open at that end
+CREATE TABLE tax_rules (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    amount BIGINT NOT NULL,
+    per VARCHAR(20) NOT NULL DEFAULT 'stay',
+    inclusive BOOLEAN NOT NULL DEFAULT false,
+    room_type_id INTEGER REFERENCES room_types (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    start_date DATE,
+    end_date DATE,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    CHECK (kind IN ('percent', 'fixed')),
+    CHECK (per IN ('stay', 'night', 'person', 'person_night')),
+    CHECK (amount >= 0),
+    CHECK (end_date >= start_date)
+);
@@ -0,0 +1,3 @@
+-- the intent a guest is paying their hold with. only one is taken per hold, so a form sent
+-- twice can't charge the guest twice
+ALTER TABLE room_restrictions ADD COLUMN payment_intent VARCHAR(255);
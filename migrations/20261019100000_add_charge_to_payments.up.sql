@@ -0,0 +1,3 @@
+-- the reference of the charge a refund gives back, so what is left to refund of each charge
+-- is known. charges have none
+ALTER TABLE payments ADD COLUMN charge VARCHAR(255);
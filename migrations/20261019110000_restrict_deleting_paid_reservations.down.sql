@@ -0,0 +1,3 @@
+ALTER TABLE payments DROP CONSTRAINT IF EXISTS payments_reservation_id_fkey,
+    ADD CONSTRAINT payments_reservation_id_fkey FOREIGN KEY (reservation_id)
+    REFERENCES reservations (id) ON UPDATE CASCADE ON DELETE CASCADE;
@@ -0,0 +1 @@
+ALTER TABLE room_restrictions DROP COLUMN IF EXISTS paying_until;
@@ -0,0 +1,3 @@
+-- set while a checkout is taking the hold's payment, so the form sent again waits for it rather
+-- than paying too. it runs out on its own when that checkout never finishes
+ALTER TABLE room_restrictions ADD COLUMN paying_until TIMESTAMP;
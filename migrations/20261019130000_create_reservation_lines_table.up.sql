@@ -0,0 +1,16 @@
+-- the quote a reservation was booked at, kept so it reads the same after rates and taxes
+-- change. a 'line' is described by the catalog key in description and a 'tax' by its name.
+-- position keeps them in the order they were quoted
+CREATE TABLE reservation_lines (
+    id SERIAL PRIMARY KEY,
+    reservation_id INTEGER NOT NULL REFERENCES reservations (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    description VARCHAR(255) NOT NULL,
+    quantity INTEGER NOT NULL DEFAULT 0,
+    unit_amount BIGINT NOT NULL DEFAULT 0,
+    amount BIGINT NOT NULL,
+    inclusive BOOLEAN NOT NULL DEFAULT false,
+    UNIQUE (reservation_id, position),
+    CHECK (kind IN ('line', 'tax'))
+);
@@ -0,0 +1,3 @@
+ALTER TABLE invoices DROP COLUMN IF EXISTS paid;
+ALTER TABLE invoices DROP COLUMN IF EXISTS total;
+DROP TABLE IF EXISTS invoice_lines;
@@ -0,0 +1,34 @@
+-- what an invoice bills, saved when it is issued so a later download reads the same. the lines
+-- are kept like reservation_lines, total is what they come to and paid what had been paid by then
+CREATE TABLE invoice_lines (
+    id SERIAL PRIMARY KEY,
+    invoice_id INTEGER NOT NULL REFERENCES invoices (id) ON UPDATE CASCADE ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    description VARCHAR(255) NOT NULL,
+    quantity INTEGER NOT NULL DEFAULT 0,
+    unit_amount BIGINT NOT NULL DEFAULT 0,
+    amount BIGINT NOT NULL,
+    inclusive BOOLEAN NOT NULL DEFAULT false,
+    UNIQUE (invoice_id, position),
+    CHECK (kind IN ('line', 'tax'))
+);
+
+ALTER TABLE invoices ADD COLUMN total BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE invoices ADD COLUMN paid BIGINT NOT NULL DEFAULT 0;
+
+-- invoices issued before now bill the stay as one line, or the penalty once cancelled
+UPDATE invoices i SET total = coalesce(c.penalty, r.total),
+    paid = coalesce((SELECT sum(CASE WHEN p.kind = 'refund' THEN -p.amount ELSE p.amount END)
+        FROM payments p WHERE p.reservation_id = i.reservation_id AND p.status = 'succeeded'), 0)
+FROM reservations r LEFT JOIN cancellations c ON (c.reservation_id = r.id)
+WHERE r.id = i.reservation_id;
+
+INSERT INTO invoice_lines (invoice_id, position, kind, description, quantity, amount)
+SELECT i.id, 1, 'line',
+    CASE WHEN c.id IS NULL THEN 'invoice.stay' ELSE 'invoice.cancellation_fee' END,
+    CASE WHEN c.id IS NULL THEN r.end_date - r.start_date ELSE 0 END,
+    i.total
+FROM invoices i JOIN reservations r ON (r.id = i.reservation_id)
+LEFT JOIN cancellations c ON (c.reservation_id = r.id)
+WHERE i.total > 0;
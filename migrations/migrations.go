@@ -0,0 +1,9 @@
+//Package migrations holds the SQL schema migrations that are embedded into the binary.
+//Files are named <version>_<name>.up.sql and <version>_<name>.down.sql
+package migrations
+
+import "embed"
+
+//FS holds every migration file
+//go:embed *.sql
+var FS embed.FS
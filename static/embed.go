@@ -0,0 +1,8 @@
+//Package static holds the css, js, images and admin theme served under /static
+package static
+
+import "embed"
+
+//FS holds the static files, rooted at this directory
+//go:embed admin css img js
+var FS embed.FS
@@ -0,0 +1,8 @@
+//Package templates holds the page and layout templates that are embedded into the binary
+package templates
+
+import "embed"
+
+//FS holds every template file
+//go:embed *.html
+var FS embed.FS
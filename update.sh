@@ -1,13 +1,14 @@
-#1/bin/bash
+#!/bin/bash
 
 git pull 
 
-soda migrate 
+go build -ldflags "-X main.version=$(git describe --tags --always) -X main.commit=$(git rev-parse --short HEAD) -X main.buildTime=$(date -u +%FT%TZ)" -o bookings cmd/web/*.go 
 
-go build -o bookings cmd/web/*.go 
+./bookings migrate up
 
-sudo supervisiorctl stop book 
-sudo supervisiorctl start book
+sudo supervisorctl stop book 
+sudo supervisorctl start book
 
 #shell script to restart application and update migrations if the server shutdowns or encounters an error or is updated
-#cmod 777 update.sh to make it executable
\ No newline at end of file
+#migrations are embedded in the binary and read their database settings from config.yml or GOSERVER_* variables
+#cmod 777 update.sh to make it executable